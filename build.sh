@@ -21,7 +21,7 @@ go mod tidy
 
 # 编译项目
 echo "编译项目..."
-go build -o miemie main.go
+go build -tags sqlite_fts5 -o miemie main.go
 
 # 检查编译结果
 if [ $? -eq 0 ]; then
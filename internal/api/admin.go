@@ -0,0 +1,369 @@
+package api
+
+import (
+	"miemie/internal/auth"
+	"miemie/internal/middleware"
+	"miemie/internal/storage"
+	"miemie/internal/workspace"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminUser 管理后台的用户概况
+type adminUser struct {
+	UserID        string `json:"user_id"`
+	Role          string `json:"role"`
+	HasWorkspace  bool   `json:"has_workspace"`
+	Cached        bool   `json:"cached"`
+	Connections   int    `json:"connections"`
+	Subscriptions int    `json:"subscriptions"`
+}
+
+// ListUsers 列出用户：磁盘上已有工作空间的用户和分配了角色的用户
+func (h *SimpleAPIHandler) ListUsers(c *gin.Context) {
+	userIDs, err := h.workspaceManager.ListAllUsers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to list users",
+			"error":   err.Error(),
+		})
+		return
+	}
+	assignments, err := h.authStore.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to list roles",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	users := make(map[string]*adminUser, len(userIDs))
+	for _, userID := range userIDs {
+		users[userID] = &adminUser{UserID: userID, Role: auth.RoleUser, HasWorkspace: true}
+	}
+	for _, assignment := range assignments {
+		if user, ok := users[assignment.UserID]; ok {
+			user.Role = assignment.Role
+		} else {
+			users[assignment.UserID] = &adminUser{UserID: assignment.UserID, Role: assignment.Role}
+		}
+	}
+
+	cached := make(map[string]bool)
+	for _, userID := range h.workspaceManager.ListWorkspaces() {
+		cached[userID] = true
+	}
+
+	roleFilter := c.Query("role")
+	result := make([]*adminUser, 0, len(users))
+	for _, user := range users {
+		if roleFilter != "" && user.Role != roleFilter {
+			continue
+		}
+		user.Cached = cached[user.UserID]
+		user.Connections = h.wsManager.GetUserClientCount(user.UserID)
+		user.Subscriptions = h.wsManager.GetUserSubscriptionCount(user.UserID)
+		result = append(result, user)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].UserID < result[j].UserID })
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"users": result,
+			"total": len(result),
+		},
+	})
+}
+
+// GetUserDetail 查看用户的工作空间、角色、连接和密钥
+// 工作空间统计只在工作空间已存在时计算，查看不会为不存在的用户创建工作空间
+func (h *SimpleAPIHandler) GetUserDetail(c *gin.Context) {
+	userID, ok := adminUserParam(c)
+	if !ok {
+		return
+	}
+
+	info, err := h.workspaceManager.InspectWorkspace(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to inspect workspace",
+			"error":   err.Error(),
+		})
+		return
+	}
+	role, err := h.authStore.GetRole(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get role",
+			"error":   err.Error(),
+		})
+		return
+	}
+	keys, err := h.authStore.ListKeys(auth.OwnerUser, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to list API keys",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	data := gin.H{
+		"user_id":       userID,
+		"role":          role,
+		"workspace":     info,
+		"connections":   h.wsManager.GetUserClientCount(userID),
+		"subscriptions": h.wsManager.GetUserSubscriptionCount(userID),
+		"api_keys":      keys,
+	}
+
+	if info.Exists {
+		ws, err := h.workspaceManager.GetUserWorkspace(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to get user workspace",
+				"error":   err.Error(),
+			})
+			return
+		}
+		userStorage := storage.NewUserMessageStorage(ws)
+		stats, err := userStorage.GetUserStats()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to get user stats",
+				"error":   err.Error(),
+			})
+			return
+		}
+		latestSeq, err := userStorage.GetLatestSeq()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to get latest seq",
+				"error":   err.Error(),
+			})
+			return
+		}
+		data["stats"] = stats
+		data["latest_seq"] = latestSeq
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    data,
+	})
+}
+
+// SetUserRole 分配用户角色
+func (h *SimpleAPIHandler) SetUserRole(c *gin.Context) {
+	userID, ok := adminUserParam(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	grantedBy := middleware.GetPrincipal(c).ID
+	if err := h.authStore.SetRole(userID, req.Role, grantedBy); err != nil {
+		switch err {
+		case auth.ErrInvalidRole:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid role",
+				"allowed": auth.AssignableRoles,
+			})
+		case auth.ErrLastAdmin:
+			c.JSON(http.StatusConflict, gin.H{
+				"code":    409,
+				"message": "Cannot remove the last admin",
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to set role",
+				"error":   err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Role updated",
+		"data": gin.H{
+			"user_id":     userID,
+			"role":        req.Role,
+			"permissions": auth.RolePermissions[req.Role],
+		},
+	})
+}
+
+// ListRoles 列出角色的权限和全部角色分配
+func (h *SimpleAPIHandler) ListRoles(c *gin.Context) {
+	assignments, err := h.authStore.ListRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to list roles",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"roles":       auth.RolePermissions,
+			"assignments": assignments,
+		},
+	})
+}
+
+// EvictWorkspace 强制从缓存中释放用户工作空间并关闭其数据库连接，下次访问时重新打开
+func (h *SimpleAPIHandler) EvictWorkspace(c *gin.Context) {
+	userID, ok := adminUserParam(c)
+	if !ok {
+		return
+	}
+
+	info, err := h.workspaceManager.InspectWorkspace(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to inspect workspace",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err := h.workspaceManager.RemoveWorkspace(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to evict workspace",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Workspace evicted",
+		"data": gin.H{
+			"user_id": userID,
+			"evicted": info.Cached,
+		},
+	})
+}
+
+// PauseDelivery 暂停投递
+func (h *SimpleAPIHandler) PauseDelivery(c *gin.Context) {
+	changed := h.deliverySystem.Pause()
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Delivery paused",
+		"data": gin.H{
+			"paused":  true,
+			"changed": changed,
+		},
+	})
+}
+
+// ResumeDelivery 恢复投递
+func (h *SimpleAPIHandler) ResumeDelivery(c *gin.Context) {
+	changed := h.deliverySystem.Resume()
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Delivery resumed",
+		"data": gin.H{
+			"paused":  false,
+			"changed": changed,
+		},
+	})
+}
+
+// ApproveSender 批准发送者申请
+func (h *SimpleAPIHandler) ApproveSender(c *gin.Context) {
+	h.reviewSender(c, true)
+}
+
+// RejectSender 拒绝发送者申请
+func (h *SimpleAPIHandler) RejectSender(c *gin.Context) {
+	h.reviewSender(c, false)
+}
+
+// reviewSender 审核发送者申请
+func (h *SimpleAPIHandler) reviewSender(c *gin.Context, approve bool) {
+	sender, err := h.authStore.ReviewSender(c.Param("id"), approve)
+	if err != nil {
+		if err == auth.ErrSenderNotPending {
+			c.JSON(http.StatusConflict, gin.H{
+				"code":    409,
+				"message": "Sender is not pending approval",
+			})
+			return
+		}
+		h.senderError(c, err)
+		return
+	}
+
+	message := "Sender rejected"
+	if approve {
+		message = "Sender approved"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": message,
+		"data":    sender,
+	})
+}
+
+// adminUserParam 获取并校验路径中的用户ID
+func adminUserParam(c *gin.Context) (string, bool) {
+	userID := c.Param("user_id")
+	if !workspace.IsValidUserID(userID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid user id",
+		})
+		return "", false
+	}
+	return userID, true
+}
+
+// legacyAlias 旧管理路径通过 Deprecation 和 Link 响应头指向 /api/admin/v1 下的新路径
+func legacyAlias(path string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		segments := strings.Split(path, "/")
+		for i, segment := range segments {
+			if strings.HasPrefix(segment, ":") {
+				segments[i] = c.Param(segment[1:])
+			}
+		}
+		c.Header("Deprecation", "true")
+		c.Header("Link", "</api/admin/v1"+strings.Join(segments, "/")+`>; rel="successor-version"`)
+	}
+}
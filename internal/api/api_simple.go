@@ -2,15 +2,19 @@ package api
 
 import (
 	"fmt"
+	"miemie/internal/auth"
 	"miemie/internal/config"
+	"miemie/internal/dedup"
 	"miemie/internal/delivery"
 	"miemie/internal/logger"
 	"miemie/internal/middleware"
 	"miemie/internal/models"
+	"miemie/internal/ratelimit"
 	"miemie/internal/storage"
 	"miemie/internal/websocket"
 	"miemie/internal/workspace"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -23,53 +27,255 @@ type SimpleAPIHandler struct {
 	wsManager       *websocket.Manager
 	config          *config.Config
 	deliverySystem  *delivery.DeliverySystem // 新增投递系统
+	authStore       *auth.Store
+	jwtVerifier     *auth.JWTVerifier
+	rateLimiter     *ratelimit.Limiter // 未启用限流时为nil
+	dedupStore      *dedup.Store
+	expirySweeper   *storage.ExpirySweeper
+	retentionWorker *storage.RetentionWorker
 }
 
-func SetupSimpleRoutes(r *gin.Engine, cfg *config.Config, wsManager *websocket.Manager) {
+// SetupSimpleRoutes 注册API路由，返回的处理器需要在服务退出时 Close
+func SetupSimpleRoutes(r *gin.Engine, cfg *config.Config, wsManager *websocket.Manager) *SimpleAPIHandler {
 	workspaceManager := workspace.NewManagerWithConfig(cfg.Server.UserStorage, cfg)
 
 	// 创建投递系统
 	deliverySystem := delivery.NewDeliverySystemWithConfig(workspaceManager, wsManager, cfg)
+	// 已读事件同步到投递回执，需在启动投递（重放日志会打开工作空间）之前注册
+	workspaceManager.SetReadHook(deliverySystem.MarkRead)
 	if err := deliverySystem.Start(); err != nil {
 		panic(fmt.Sprintf("Failed to start delivery system: %v", err))
 	}
 
+	authStore, err := auth.OpenStore(cfg.API.Auth.DBPath)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to open auth store: %v", err))
+	}
+	if !cfg.API.Auth.AllowUserIDHeader {
+		keyFile := filepath.Join(filepath.Dir(cfg.API.Auth.DBPath), "bootstrap.key")
+		created, err := authStore.EnsureBootstrapKey(cfg.API.Auth.BootstrapUser, keyFile)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to create bootstrap API key: %v", err))
+		}
+		if created {
+			logger.Warnf("Auth: created admin API key for user %s in %s", cfg.API.Auth.BootstrapUser, keyFile)
+		}
+	}
+
+	assigned, err := authStore.EnsureBootstrapAdmin(cfg.API.Auth.BootstrapUser)
+	if err != nil {
+		panic(fmt.Sprintf("Failed to assign bootstrap admin: %v", err))
+	}
+	if assigned {
+		logger.Warnf("Auth: no admin found, granted admin role to %s", cfg.API.Auth.BootstrapUser)
+	}
+
+	var jwtVerifier *auth.JWTVerifier
+	if cfg.API.Auth.JWT.Enabled {
+		jwtVerifier, err = auth.NewJWTVerifier(cfg.API.Auth.JWT)
+		if err != nil {
+			panic(fmt.Sprintf("Failed to initialize JWT verifier: %v", err))
+		}
+		logger.Infof("Auth: accepting bearer JWTs, user id from claim %q", cfg.API.Auth.JWT.UserClaim)
+	}
+
+	var rateLimiter *ratelimit.Limiter
+	if cfg.API.RateLimit.Enabled {
+		rateLimiter = ratelimit.NewLimiter(cfg.API.RateLimit)
+	}
+
+	dedupStore, err := dedup.NewStore(authStore.DB(), cfg.API.Dedup.GetWindow())
+	if err != nil {
+		panic(fmt.Sprintf("Failed to initialize dedup store: %v", err))
+	}
+
+	// 过期消息清理后通知在线客户端
+	expirySweeper := storage.NewExpirySweeper(workspaceManager, cfg.Database.GetExpirySweepInterval(),
+		func(userID string, messageIDs []string) {
+			wsManager.NotifyExpired(userID, messageIDs)
+		})
+
 	handler := &SimpleAPIHandler{
 		workspaceManager: workspaceManager,
 		wsManager:       wsManager,
 		config:          cfg,
 		deliverySystem:  deliverySystem,
+		authStore:       authStore,
+		jwtVerifier:     jwtVerifier,
+		rateLimiter:     rateLimiter,
+		dedupStore:      dedupStore,
+		expirySweeper:   expirySweeper,
+		retentionWorker: storage.NewRetentionWorker(workspaceManager, cfg.Database.GetRetentionInterval()),
+	}
+
+	// WebSocket 命令与断线重放
+	wsHandler := &wsCommandHandler{h: handler}
+	wsManager.SetCommandHandler(wsHandler)
+	wsManager.SetReplaySource(wsHandler)
+
+	// API密钥或 JWT 认证，只有开发模式才信任 User-ID 头
+	authCfg := cfg.API.Auth
+	if authCfg.AllowUserIDHeader {
+		logger.Warn("Auth: allow_user_id_header is enabled, requests without an API key are trusted by User-ID header")
 	}
+	r.Use(middleware.AuthFailureLimit(rateLimiter), middleware.AuthMiddleware(authStore, jwtVerifier, authCfg.AllowUserIDHeader))
 
-	// 添加用户ID中间件
-	r.Use(middleware.UserIDMiddleware())
+	// 发送和读取接口分别限流
+	limitRead := handler.RateLimit(ratelimit.ClassRead)
+	limitSend := handler.RateLimit(ratelimit.ClassSend)
 
 	api := r.Group("/api/v3")
+	read := api.Group("", middleware.RequireScope(auth.ScopeRead), limitRead)
+	send := api.Group("", middleware.RequireScope(auth.ScopeSend), limitSend)
+	manage := api.Group("", middleware.RequireScope(auth.ScopeSend), limitRead) // 修改频道需要可写的权限范围，按读取接口限流
+	self := api.Group("", limitRead)
 	{
 		// 消息相关API
-		api.POST("/messages", handler.CreateMessage)
-		api.GET("/messages", handler.GetMessages)
-		api.GET("/messages/:id", handler.GetMessage)
+		send.POST("/messages", handler.CreateMessage)
+		read.GET("/messages", handler.GetMessages)
+		read.GET("/messages/search", handler.SearchMessages)
+		read.GET("/messages/sync", handler.SyncMessages)
+		read.GET("/messages/poll", handler.PollMessages)
+		self.GET("/messages/scheduled", middleware.RequireScope(auth.ScopeSend), handler.ListScheduledMessages)
+		self.DELETE("/messages/scheduled/:id", middleware.RequireScope(auth.ScopeSend), handler.CancelScheduledMessage)
+		read.GET("/messages/:id", handler.GetMessage)
+		self.GET("/messages/:id/status", middleware.RequireScope(auth.ScopeSend, auth.ScopeRead), handler.GetMessageStatus)
+
+		// SSE 推送
+		read.GET("/stream", handler.StreamMessages)
 
 		// 频道相关API
-		api.GET("/channels", handler.GetChannels)
-		api.GET("/channels/:id", handler.GetChannel)
-		api.POST("/channels", handler.CreateChannel)
+		read.GET("/channels", handler.GetChannels)
+		read.GET("/channels/:id", handler.GetChannel)
+		manage.POST("/channels", handler.CreateChannel)
+		manage.PATCH("/channels/:id", handler.UpdateChannel)
+		manage.DELETE("/channels/:id", handler.DeleteChannel)
+		manage.PUT("/channels/:id/retention", handler.SetChannelRetention)
+		manage.PUT("/channels/:id/mute", handler.MuteChannel)
+		manage.DELETE("/channels/:id/mute", handler.UnmuteChannel)
 
 		// 批量操作API
-		api.POST("/messages/batch", handler.CreateMessagesBatch)
+		send.POST("/messages/batch", handler.CreateMessagesBatch)
 
 		// 用户相关API
-		api.GET("/user/stats", handler.GetUserStats)
-		api.POST("/messages/:id/read", handler.MarkAsRead)
-		api.GET("/messages/unread-count", handler.GetUnreadCount)
+		read.GET("/user/stats", handler.GetUserStats)
+		read.GET("/user/stats/history", handler.GetUserStatsHistory)
+		read.POST("/messages/:id/read", handler.MarkAsRead)
+		read.POST("/messages/read", handler.MarkMessagesRead)
+		read.POST("/messages/unread", handler.MarkMessagesUnread)
+		read.PUT("/messages/:id/star", handler.StarMessage)
+		read.DELETE("/messages/:id/star", handler.UnstarMessage)
+		read.PUT("/messages/:id/archive", handler.ArchiveMessage)
+		read.DELETE("/messages/:id/archive", handler.UnarchiveMessage)
+		read.POST("/channels/:id/read", handler.MarkChannelRead)
+		read.PUT("/channels/:id/position", handler.SetReadingPosition)
+		read.GET("/messages/unread-count", handler.GetUnreadCount)
+
+		// API密钥自助管理
+		self.GET("/keys", handler.ListMyKeys)
+		self.POST("/keys", handler.CreateMyKey)
+		self.DELETE("/keys/:id", handler.RevokeMyKey)
+
+		// 发送者账户申请
+		self.GET("/senders", handler.ListMySenders)
+		self.POST("/senders", handler.ApplySender)
+	}
 
-		// 投递系统API
-		api.GET("/delivery/stats", handler.GetDeliveryStats)
+	// 迁移到 /api/admin/v1 之前的管理接口路径，保留为别名，权限检查与新路径相同
+	legacy := api.Group("", middleware.RequireScope(auth.ScopeAdmin), limitRead)
+	{
+		legacy.GET("/delivery/stats", legacyAlias("/delivery/stats"), middleware.RequirePermission(auth.PermDeliveryView), handler.GetDeliveryStats)
+		legacy.GET("/workspace/cache/stats", legacyAlias("/workspaces/cache"), middleware.RequirePermission(auth.PermUsersView), handler.GetWorkspaceCacheStats)
+		legacy.GET("/delivery/dead-letters", legacyAlias("/delivery/dead-letters"), middleware.RequirePermission(auth.PermDeliveryView), handler.ListDeadLetters)
+		legacy.DELETE("/delivery/dead-letters", legacyAlias("/delivery/dead-letters"), middleware.RequirePermission(auth.PermDeliveryManage), handler.PurgeDeadLetters)
+		legacy.POST("/delivery/dead-letters/replay", legacyAlias("/delivery/dead-letters/replay"), middleware.RequirePermission(auth.PermDeliveryManage), handler.ReplayDeadLetters)
+		legacy.GET("/delivery/dead-letters/:id", legacyAlias("/delivery/dead-letters/:id"), middleware.RequirePermission(auth.PermDeliveryView), handler.GetDeadLetter)
+		legacy.DELETE("/delivery/dead-letters/:id", legacyAlias("/delivery/dead-letters/:id"), middleware.RequirePermission(auth.PermDeliveryManage), handler.DeleteDeadLetter)
+		legacy.POST("/delivery/dead-letters/:id/replay", legacyAlias("/delivery/dead-letters/:id/replay"), middleware.RequirePermission(auth.PermDeliveryManage), handler.ReplayDeadLetter)
+		legacy.GET("/users/:user_id/keys", legacyAlias("/users/:user_id/keys"), middleware.RequirePermission(auth.PermKeysManage), handler.ListUserKeys)
+		legacy.POST("/users/:user_id/keys", legacyAlias("/users/:user_id/keys"), middleware.RequirePermission(auth.PermKeysManage), handler.CreateUserKey)
+		legacy.DELETE("/users/:user_id/keys/:key_id", legacyAlias("/users/:user_id/keys/:key_id"), middleware.RequirePermission(auth.PermKeysManage), handler.RevokeUserKey)
+		// GET/POST /api/v3/senders 已改为用户申请发送者账户，列出和创建发送者只能使用新路径
+		legacy.GET("/senders/:id", legacyAlias("/senders/:id"), middleware.RequirePermission(auth.PermSendersManage), handler.GetSender)
+		legacy.PUT("/senders/:id", legacyAlias("/senders/:id"), middleware.RequirePermission(auth.PermSendersManage), handler.UpdateSender)
+		legacy.DELETE("/senders/:id", legacyAlias("/senders/:id"), middleware.RequirePermission(auth.PermSendersManage), handler.DeleteSender)
+		legacy.GET("/senders/:id/keys", legacyAlias("/senders/:id/keys"), middleware.RequirePermission(auth.PermSendersManage), handler.ListSenderKeys)
+		legacy.POST("/senders/:id/keys", legacyAlias("/senders/:id/keys"), middleware.RequirePermission(auth.PermSendersManage), handler.CreateSenderKey)
+		legacy.DELETE("/senders/:id/keys/:key_id", legacyAlias("/senders/:id/keys/:key_id"), middleware.RequirePermission(auth.PermSendersManage), handler.RevokeSenderKey)
+	}
 
-		// 缓存管理API
-		api.GET("/workspace/cache/stats", handler.GetWorkspaceCacheStats)
+	// 管理接口：要求 admin 权限范围，并按角色权限逐项授权
+	admin := r.Group("/api/admin/v1", middleware.RequireScope(auth.ScopeAdmin), limitRead)
+	{
+		// 用户和工作空间
+		admin.GET("/users", middleware.RequirePermission(auth.PermUsersView), handler.ListUsers)
+		admin.GET("/users/:user_id", middleware.RequirePermission(auth.PermUsersView), handler.GetUserDetail)
+		admin.POST("/users/:user_id/workspace/evict", middleware.RequirePermission(auth.PermWorkspaceEvict), handler.EvictWorkspace)
+		admin.GET("/workspaces/cache", middleware.RequirePermission(auth.PermUsersView), handler.GetWorkspaceCacheStats)
+		admin.GET("/workspaces/retention", middleware.RequirePermission(auth.PermUsersView), handler.GetRetentionReport)
+		admin.POST("/workspaces/retention/run", middleware.RequirePermission(auth.PermWorkspaceMaintain), handler.RunRetention)
+
+		// 角色
+		admin.GET("/roles", middleware.RequirePermission(auth.PermRolesManage), handler.ListRoles)
+		admin.PUT("/users/:user_id/role", middleware.RequirePermission(auth.PermRolesManage), handler.SetUserRole)
+
+		// 用户密钥
+		admin.GET("/users/:user_id/keys", middleware.RequirePermission(auth.PermKeysManage), handler.ListUserKeys)
+		admin.POST("/users/:user_id/keys", middleware.RequirePermission(auth.PermKeysManage), handler.CreateUserKey)
+		admin.DELETE("/users/:user_id/keys/:key_id", middleware.RequirePermission(auth.PermKeysManage), handler.RevokeUserKey)
+
+		// 投递系统
+		admin.GET("/delivery/stats", middleware.RequirePermission(auth.PermDeliveryView), handler.GetDeliveryStats)
+		admin.POST("/delivery/pause", middleware.RequirePermission(auth.PermDeliveryManage), handler.PauseDelivery)
+		admin.POST("/delivery/resume", middleware.RequirePermission(auth.PermDeliveryManage), handler.ResumeDelivery)
+
+		// 死信队列
+		admin.GET("/delivery/dead-letters", middleware.RequirePermission(auth.PermDeliveryView), handler.ListDeadLetters)
+		admin.DELETE("/delivery/dead-letters", middleware.RequirePermission(auth.PermDeliveryManage), handler.PurgeDeadLetters)
+		admin.POST("/delivery/dead-letters/replay", middleware.RequirePermission(auth.PermDeliveryManage), handler.ReplayDeadLetters)
+		admin.GET("/delivery/dead-letters/:id", middleware.RequirePermission(auth.PermDeliveryView), handler.GetDeadLetter)
+		admin.DELETE("/delivery/dead-letters/:id", middleware.RequirePermission(auth.PermDeliveryManage), handler.DeleteDeadLetter)
+		admin.POST("/delivery/dead-letters/:id/replay", middleware.RequirePermission(auth.PermDeliveryManage), handler.ReplayDeadLetter)
+
+		// 发送者账户及审核
+		admin.GET("/senders", middleware.RequirePermission(auth.PermSendersManage), handler.ListSenders)
+		admin.POST("/senders", middleware.RequirePermission(auth.PermSendersManage), handler.CreateSender)
+		admin.GET("/senders/:id", middleware.RequirePermission(auth.PermSendersManage), handler.GetSender)
+		admin.PUT("/senders/:id", middleware.RequirePermission(auth.PermSendersManage), handler.UpdateSender)
+		admin.DELETE("/senders/:id", middleware.RequirePermission(auth.PermSendersManage), handler.DeleteSender)
+		admin.POST("/senders/:id/approve", middleware.RequirePermission(auth.PermSendersApprove), handler.ApproveSender)
+		admin.POST("/senders/:id/reject", middleware.RequirePermission(auth.PermSendersApprove), handler.RejectSender)
+		admin.GET("/senders/:id/keys", middleware.RequirePermission(auth.PermSendersManage), handler.ListSenderKeys)
+		admin.POST("/senders/:id/keys", middleware.RequirePermission(auth.PermSendersManage), handler.CreateSenderKey)
+		admin.DELETE("/senders/:id/keys/:key_id", middleware.RequirePermission(auth.PermSendersManage), handler.RevokeSenderKey)
+	}
+
+	return handler
+}
+
+// RateLimit 返回指定类别的限流中间件，未启用限流时直接放行
+func (h *SimpleAPIHandler) RateLimit(class string) gin.HandlerFunc {
+	return middleware.RateLimit(h.rateLimiter, class)
+}
+
+// Close 停止投递系统和后台清理，关闭认证数据库和所有工作空间
+func (h *SimpleAPIHandler) Close() error {
+	if err := h.deliverySystem.Stop(); err != nil {
+		logger.Warnf("Failed to stop delivery system: %v", err)
+	}
+	h.expirySweeper.Close()
+	h.retentionWorker.Close()
+	if h.jwtVerifier != nil {
+		h.jwtVerifier.Close()
+	}
+	if h.rateLimiter != nil {
+		h.rateLimiter.Close()
+	}
+	h.dedupStore.Close()
+	if err := h.authStore.Close(); err != nil {
+		logger.Warnf("Failed to close auth store: %v", err)
 	}
+	return h.workspaceManager.Close()
 }
 
 // CreateMessage 创建单条消息（使用投递系统）
@@ -88,6 +294,14 @@ func (h *SimpleAPIHandler) CreateMessage(c *gin.Context) {
 	if req.ChannelID == "" {
 		req.ChannelID = "default"
 	}
+	if !models.ValidChannelSlug(req.ChannelID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid channel_id",
+			"error":   errInvalidChannelRef.Error(),
+		})
+		return
+	}
 
 	// 设置默认值
 	if req.MessageType == "" {
@@ -113,29 +327,61 @@ func (h *SimpleAPIHandler) CreateMessage(c *gin.Context) {
 		"api":         "POST /api/v3/messages",
 	}).Info("API: Message creation request")
 
+	if err := h.checkMessageSize(&req); err != nil {
+		h.messageTooLarge(c, &req)
+		return
+	}
+
+	dedupKey, err := h.submissionKey(&req, c.GetHeader(IdempotencyKeyHeader))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid dedup key",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.validateCallbackURL(req.CallbackURL); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid callback_url",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// 解析接收者
+	recipients, err := h.resolveRecipients(&req, message)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid recipients",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// 发送者账户只能发送给允许的用户和频道，其他主体没有 messages:fanout 权限时只能发送给自己
+	principal := middleware.GetPrincipal(c)
+	if err := checkRecipientAccess(principal, &req, recipients); err != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "Recipients not allowed",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if principal.IsSender() {
+		message.Sender = principal.Sender.ID
+	}
+
 	// 通过投递系统异步处理消息
-	if h.deliverySystem != nil {
-		err := h.deliverySystem.SubmitMessage(message, []string{userID})
-		if err != nil {
-			logger.WithFields(logrus.Fields{
-				"user_id":    userID,
-				"message_id": message.ID,
-				"error":      err.Error(),
-				"api":        "POST /api/v3/messages",
-			}).Error("API: Failed to submit message to delivery system")
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "Failed to submit message to delivery system",
-				"error":   err.Error(),
-			})
-			return
-		}
-	} else {
+	if h.deliverySystem == nil {
 		logger.WithFields(logrus.Fields{
 			"user_id": userID,
 			"api":     "POST /api/v3/messages",
 		}).Warn("API: Delivery system not available")
-		// 降级处理：如果投递系统不可用，直接存储（兼容性）
 		c.JSON(http.StatusServiceUnavailable, gin.H{
 			"code":    503,
 			"message": "Delivery system not available",
@@ -143,59 +389,219 @@ func (h *SimpleAPIHandler) CreateMessage(c *gin.Context) {
 		return
 	}
 
+	deliverAt, err := h.deliverAt(&req)
+	if err == delivery.ErrSchedulingDisabled {
+		respondScheduleError(c, err, "")
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid delivery time",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	message.ExpiresAt, err = expiresAt(&req, deliverAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid expiry",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// 窗口内的重复提交直接返回首次提交的消息ID，不再投递
+	sub, err := h.claimSubmission(userID, dedupKey, &req, message)
+	if err != nil {
+		submissionError(c, err)
+		return
+	}
+	if sub.duplicate() {
+		logger.WithFields(logrus.Fields{
+			"user_id":    userID,
+			"message_id": sub.original.MessageID,
+			"api":        "POST /api/v3/messages",
+		}).Info("API: Duplicate submission, returning original message")
+		c.Header("Idempotent-Replayed", "true")
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "Duplicate submission, message already submitted",
+			"data":    duplicateResult(userID, sub.original),
+		})
+		return
+	}
+
+	// 消息计入每个接收者当天的配额，配额已满的接收者不投递
+	quota, err := h.reserveRecipients(recipients)
+	if err != nil {
+		h.releaseSubmission(userID, sub, message)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to check message quota",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if len(quota.reserved) == 0 {
+		h.releaseSubmission(userID, sub, message)
+		h.quotaExceeded(c, quota)
+		return
+	}
+
+	result := h.deliverySystem.SubmitFanout(message, quota.reserved, delivery.SubmitOptions{
+		SubmittedBy: userID,
+		CallbackURL: req.CallbackURL,
+		DeliverAt:   deliverAt,
+	})
+	rejected := h.settleRecipients(quota, result)
+	if len(result.Queued) == 0 {
+		h.releaseSubmission(userID, sub, message)
+		var submitErr string
+		for _, reason := range result.Rejected {
+			submitErr = reason
+			break
+		}
+		logger.WithFields(logrus.Fields{
+			"user_id":    userID,
+			"message_id": message.ID,
+			"error":      submitErr,
+			"api":        "POST /api/v3/messages",
+		}).Error("API: Failed to submit message to delivery system")
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to submit message to delivery system",
+			"error":   submitErr,
+		})
+		return
+	}
+
 	// 🎯 记录成功响应
 	logger.WithFields(logrus.Fields{
 		"user_id":    userID,
 		"message_id": message.ID,
 		"channel_id": req.ChannelID,
+		"recipients": len(recipients),
+		"rejected":   len(rejected),
 		"api":        "POST /api/v3/messages",
 	}).Info("API: Message submitted successfully")
 
+	data := gin.H{
+		"message_id":      message.ID,
+		"user_id":         userID,
+		"channel_id":      message.ChannelID,
+		"priority":        message.Priority,
+		"submitted_at":    time.Now(),
+		"recipient_count": len(recipients),
+		"queued_count":    len(result.Queued),
+		"recipients":      recipientOutcomes(recipients, rejected),
+	}
+	status := "Message submitted for delivery"
+	if !deliverAt.IsZero() {
+		data["deliver_at"] = deliverAt
+		status = "Message scheduled for delivery"
+	}
+
 	// 立即返回响应（异步投递）
 	c.JSON(http.StatusAccepted, gin.H{
 		"code":    202,
-		"message": "Message submitted for delivery",
-		"data": gin.H{
-			"message_id":   message.ID,
-			"user_id":      userID,
-			"channel_id":   message.ChannelID,
-			"priority":     message.Priority,
-			"submitted_at": time.Now(),
-		},
+		"message": status,
+		"data":    data,
 	})
 }
 
 // GetMessages 获取消息列表
+// 默认使用游标分页（cursor + direction），传入 offset 时沿用旧的偏移分页
 func (h *SimpleAPIHandler) GetMessages(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 	channelID := c.DefaultQuery("channel_id", "default")
 	limitStr := c.DefaultQuery("limit", "20")
-	offsetStr := c.DefaultQuery("offset", "0")
+	offsetStr := c.Query("offset")
+	cursorStr := c.Query("cursor")
+	direction := c.DefaultQuery("direction", storage.DirectionOlder)
 
 	limit, err := strconv.Atoi(limitStr)
 	if err != nil || limit <= 0 || limit > 100 {
 		limit = 20
 	}
 
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil || offset < 0 {
-		offset = 0
+	if direction != storage.DirectionOlder && direction != storage.DirectionNewer {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "direction must be older or newer",
+		})
+		return
 	}
 
-	// 获取用户工作空间
-	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	var cursor *storage.MessageCursor
+	if cursorStr != "" {
+		cursor, err = storage.DecodeCursor(cursorStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid cursor",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	filter, err := parseReadFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to get user workspace",
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid filter",
 			"error":   err.Error(),
 		})
 		return
 	}
 
-	// 从用户工作空间获取消息
+	// 获取用户工作空间
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
 	userStorage := storage.NewUserMessageStorage(ws)
-	messages, err := userStorage.GetMessages(channelID, limit, offset)
+	channelIDs, ok := resolveChannelRefs(c, userStorage, []string{channelID})
+	if !ok {
+		return
+	}
+	channelID = channelIDs[0]
+
+	// 兼容旧的偏移分页
+	if offsetStr != "" && cursor == nil {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			offset = 0
+		}
+
+		messages, err := userStorage.GetMessages(channelID, limit, offset, filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to get messages",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "success",
+			"data": gin.H{
+				"messages": messages,
+				"limit":    limit,
+				"offset":   offset,
+			},
+		})
+		return
+	}
+
+	messages, hasMore, err := userStorage.GetMessagesPage(channelID, cursor, direction, limit, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -205,14 +611,14 @@ func (h *SimpleAPIHandler) GetMessages(c *gin.Context) {
 		return
 	}
 
+	data := cursorPageData(messages, hasMore, cursorStr)
+	data["limit"] = limit
+	data["direction"] = direction
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
-		"data": gin.H{
-			"messages": messages,
-			"limit":    limit,
-			"offset":   offset,
-		},
+		"data":    data,
 	})
 }
 
@@ -224,11 +630,7 @@ func (h *SimpleAPIHandler) GetMessage(c *gin.Context) {
 	// 获取用户工作空间
 	ws, err := h.workspaceManager.GetUserWorkspace(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to get user workspace",
-			"error":   err.Error(),
-		})
+		workspaceError(c, err)
 		return
 	}
 
@@ -257,7 +659,9 @@ func (h *SimpleAPIHandler) CreateChannel(c *gin.Context) {
 
 	var req struct {
 		Name        string `json:"name" binding:"required"`
+		Slug        string `json:"slug"`
 		Description string `json:"description"`
+		Retention   *models.RetentionPolicy `json:"retention"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -268,27 +672,55 @@ func (h *SimpleAPIHandler) CreateChannel(c *gin.Context) {
 		})
 		return
 	}
+	if err := validateRetention(req.Retention); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid retention policy",
+			"error":   err.Error(),
+		})
+		return
+	}
 
 	// 获取用户工作空间
 	ws, err := h.workspaceManager.GetUserWorkspace(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to get user workspace",
-			"error":   err.Error(),
-		})
+		workspaceError(c, err)
 		return
 	}
 
-	// 创建频道
 	userStorage := storage.NewUserMessageStorage(ws)
+	if maxChannels := h.config.User.MaxChannels; maxChannels > 0 {
+		count, err := userStorage.CountChannels()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to count channels",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if count >= maxChannels {
+			h.channelQuotaExceeded(c, count)
+			return
+		}
+	}
+
+	if req.Slug != "" && !checkChannelSlug(c, userStorage, req.Slug, "") {
+		return
+	}
+
+	// 创建频道
 	channel := &models.Channel{
 		ID:          models.GenerateUUID(),
+		Slug:        req.Slug,
 		Name:        req.Name,
 		Description: req.Description,
 		CreatedBy:   userID,
 		CreatedAt:   time.Now(),
 	}
+	if !req.Retention.IsEmpty() {
+		channel.Retention = req.Retention
+	}
 
 	if err := userStorage.CreateChannel(channel); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -314,17 +746,13 @@ func (h *SimpleAPIHandler) GetChannel(c *gin.Context) {
 	// 获取用户工作空间
 	ws, err := h.workspaceManager.GetUserWorkspace(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to get user workspace",
-			"error":   err.Error(),
-		})
+		workspaceError(c, err)
 		return
 	}
 
-	// 从用户工作空间获取频道
+	// 从用户工作空间获取频道，id 也可以是频道标识
 	userStorage := storage.NewUserMessageStorage(ws)
-	channel, err := userStorage.GetChannel(id)
+	channel, err := userStorage.GetChannelByRef(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"code":    404,
@@ -333,6 +761,14 @@ func (h *SimpleAPIHandler) GetChannel(c *gin.Context) {
 		})
 		return
 	}
+	if err := userStorage.FillUnreadCounts([]*models.Channel{channel}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get unread count",
+			"error":   err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
@@ -341,18 +777,14 @@ func (h *SimpleAPIHandler) GetChannel(c *gin.Context) {
 	})
 }
 
-// GetChannels 获取所有频道
+// GetChannels 获取所有频道及各自的未读消息数
 func (h *SimpleAPIHandler) GetChannels(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
 	// 获取用户工作空间
 	ws, err := h.workspaceManager.GetUserWorkspace(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to get user workspace",
-			"error":   err.Error(),
-		})
+		workspaceError(c, err)
 		return
 	}
 
@@ -368,6 +800,16 @@ func (h *SimpleAPIHandler) GetChannels(c *gin.Context) {
 		return
 	}
 
+	// 每个频道只统计阅读位置之后的消息
+	if err := userStorage.FillUnreadCounts(channels); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get unread counts",
+			"error":   err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
@@ -392,16 +834,25 @@ func (h *SimpleAPIHandler) CreateMessagesBatch(c *gin.Context) {
 
 	// 从上下文获取用户ID
 	userID := middleware.GetUserID(c)
+	principal := middleware.GetPrincipal(c)
 
 	var submittedMessages []map[string]interface{}
 	var errors []string
+	duplicates := 0
+
+	// Idempotency-Key 作用于整批，按消息在批次中的序号区分
+	batchKey := c.GetHeader(IdempotencyKeyHeader)
 
 	// 🚀 通过投递系统批量处理消息
-	for _, msgReq := range req.Messages {
+	for i, msgReq := range req.Messages {
 		// 如果没有指定频道，使用默认频道
 		if msgReq.ChannelID == "" {
 			msgReq.ChannelID = "default"
 		}
+		if !models.ValidChannelSlug(msgReq.ChannelID) {
+			errors = append(errors, fmt.Sprintf("Invalid channel_id %q: %v", msgReq.ChannelID, errInvalidChannelRef))
+			continue
+		}
 
 		// 设置默认值
 		if msgReq.MessageType == "" {
@@ -414,22 +865,105 @@ func (h *SimpleAPIHandler) CreateMessagesBatch(c *gin.Context) {
 		// 创建消息
 		message := models.NewMessage(msgReq, userID)
 
+		if err := h.checkMessageSize(&msgReq); err != nil {
+			errors = append(errors, fmt.Sprintf("Message too large for message %s: %v", message.ID, err))
+			continue
+		}
+
+		headerKey := ""
+		if batchKey != "" {
+			headerKey = fmt.Sprintf("%s:%d", batchKey, i)
+		}
+		dedupKey, err := h.submissionKey(&msgReq, headerKey)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Invalid dedup key for message %s: %v", message.ID, err))
+			continue
+		}
+
+		if err := h.validateCallbackURL(msgReq.CallbackURL); err != nil {
+			errors = append(errors, fmt.Sprintf("Invalid callback_url for message %s: %v", message.ID, err))
+			continue
+		}
+
+		// 解析接收者
+		recipients, err := h.resolveRecipients(&msgReq, message)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Invalid recipients for message %s: %v", message.ID, err))
+			continue
+		}
+
+		if err := checkRecipientAccess(principal, &msgReq, recipients); err != nil {
+			errors = append(errors, fmt.Sprintf("Recipients not allowed for message %s: %v", message.ID, err))
+			continue
+		}
+		if principal.IsSender() {
+			message.Sender = principal.Sender.ID
+		}
+
 		// 🎯 通过投递系统异步投递
 		if h.deliverySystem != nil {
-			err := h.deliverySystem.SubmitMessage(message, []string{userID})
+			deliverAt, err := h.deliverAt(&msgReq)
 			if err != nil {
-				errors = append(errors, fmt.Sprintf("Failed to submit message %s: %v", message.ID, err))
+				errors = append(errors, fmt.Sprintf("Invalid delivery time for message %s: %v", message.ID, err))
+				continue
+			}
+			message.ExpiresAt, err = expiresAt(&msgReq, deliverAt)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("Invalid expiry for message %s: %v", message.ID, err))
 				continue
 			}
 
-			// 记录提交成功的消息信息
-			submittedMessages = append(submittedMessages, map[string]interface{}{
-				"message_id":   message.ID,
-				"user_id":      userID,
-				"channel_id":   message.ChannelID,
-				"priority":     message.Priority,
-				"submitted_at": time.Now(),
+			sub, err := h.claimSubmission(userID, dedupKey, &msgReq, message)
+			if err != nil {
+				errors = append(errors, fmt.Sprintf("Dedup check failed for message %s: %v", message.ID, err))
+				continue
+			}
+			if sub.duplicate() {
+				duplicates++
+				submittedMessages = append(submittedMessages, duplicateResult(userID, sub.original))
+				continue
+			}
+
+			// 每条消息计入各接收者当天的配额
+			quota, err := h.reserveRecipients(recipients)
+			if err != nil {
+				h.releaseSubmission(userID, sub, message)
+				errors = append(errors, fmt.Sprintf("Quota check failed for message %s: %v", message.ID, err))
+				continue
+			}
+			if len(quota.reserved) == 0 {
+				h.releaseSubmission(userID, sub, message)
+				errors = append(errors, fmt.Sprintf("Daily message quota exceeded for message %s: all %d recipients are over quota", message.ID, len(recipients)))
+				continue
+			}
+
+			result := h.deliverySystem.SubmitFanout(message, quota.reserved, delivery.SubmitOptions{
+				SubmittedBy: userID,
+				CallbackURL: msgReq.CallbackURL,
+				DeliverAt:   deliverAt,
 			})
+			rejected := h.settleRecipients(quota, result)
+			if len(result.Queued) == 0 {
+				h.releaseSubmission(userID, sub, message)
+				errors = append(errors, fmt.Sprintf("Failed to submit message %s: all %d recipients rejected", message.ID, len(recipients)))
+				continue
+			}
+
+			// 记录提交成功的消息信息
+			submitted := map[string]interface{}{
+				"message_id":      message.ID,
+				"user_id":         userID,
+				"channel_id":      message.ChannelID,
+				"priority":        message.Priority,
+				"submitted_at":    time.Now(),
+				"recipient_count": len(recipients),
+				"queued_count":    len(result.Queued),
+				"recipients":      recipientOutcomes(recipients, rejected),
+			}
+			if !deliverAt.IsZero() {
+				submitted["deliver_at"] = deliverAt
+			}
+			submittedMessages = append(submittedMessages, submitted)
 		} else {
 			// 降级处理：如果投递系统不可用
 			errors = append(errors, "Delivery system not available for message "+message.ID)
@@ -440,8 +974,9 @@ func (h *SimpleAPIHandler) CreateMessagesBatch(c *gin.Context) {
 		"code":    200,
 		"message": "Batch submission completed",
 		"data": gin.H{
-			"submitted": submittedMessages,
-			"count":     len(submittedMessages),
+			"submitted":  submittedMessages,
+			"count":      len(submittedMessages),
+			"duplicates": duplicates,
 		},
 	}
 
@@ -459,11 +994,7 @@ func (h *SimpleAPIHandler) GetUserStats(c *gin.Context) {
 	// 获取用户工作空间
 	ws, err := h.workspaceManager.GetUserWorkspace(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to get user workspace",
-			"error":   err.Error(),
-		})
+		workspaceError(c, err)
 		return
 	}
 
@@ -479,6 +1010,30 @@ func (h *SimpleAPIHandler) GetUserStats(c *gin.Context) {
 		return
 	}
 
+	// 当前用量与配额，max_channels 为 0 表示不限制
+	usage, err := h.authStore.GetMessageUsage(userID, h.config.User.MaxMessagesPerDay)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get message quota",
+			"error":   err.Error(),
+		})
+		return
+	}
+	stats["quota"] = gin.H{
+		"messages_per_day": gin.H{
+			"used":      usage.Used,
+			"limit":     usage.Limit,
+			"remaining": usage.Remaining(),
+			"reset_at":  usage.ResetAt,
+		},
+		"channels": gin.H{
+			"used":  stats["total_channels"],
+			"limit": h.config.User.MaxChannels,
+		},
+		"message_size_limit": h.config.User.MessageSizeLimit,
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code":    200,
 		"message": "success",
@@ -494,17 +1049,13 @@ func (h *SimpleAPIHandler) MarkAsRead(c *gin.Context) {
 	// 获取用户工作空间
 	ws, err := h.workspaceManager.GetUserWorkspace(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to get user workspace",
-			"error":   err.Error(),
-		})
+		workspaceError(c, err)
 		return
 	}
 
 	// 从用户工作空间标记已读
 	userStorage := storage.NewUserMessageStorage(ws)
-	err = userStorage.MarkAsRead(messageID, "api_client")
+	err = userStorage.MarkAsRead(messageID, readDevice)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code":    500,
@@ -528,16 +1079,19 @@ func (h *SimpleAPIHandler) GetUnreadCount(c *gin.Context) {
 	// 获取用户工作空间
 	ws, err := h.workspaceManager.GetUserWorkspace(userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code":    500,
-			"message": "Failed to get user workspace",
-			"error":   err.Error(),
-		})
+		workspaceError(c, err)
 		return
 	}
 
 	// 从用户工作空间获取未读数量
 	userStorage := storage.NewUserMessageStorage(ws)
+	if channelID != "" {
+		channelIDs, ok := resolveChannelRefs(c, userStorage, []string{channelID})
+		if !ok {
+			return
+		}
+		channelID = channelIDs[0]
+	}
 	count, err := userStorage.GetUnreadCount(channelID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -576,16 +1130,26 @@ func (h *SimpleAPIHandler) GetDeliveryStats(c *gin.Context) {
 			"total_delivered":     stats.TotalDelivered,
 			"total_failed":        stats.TotalFailed,
 			"total_retried":       stats.TotalRetried,
+			"total_dead_lettered": stats.TotalDeadLettered,
 			"avg_delivery_time":   stats.AvgDeliveryTime.String(),
 			"queue_depth":         stats.QueueDepth,
 			"active_workers":      stats.ActiveWorkers,
-			"success_rate":        float64(stats.TotalDelivered) / float64(stats.TotalReceived) * 100,
-			"failure_rate":        float64(stats.TotalFailed) / float64(stats.TotalReceived) * 100,
+			"paused":              stats.Paused,
+			"success_rate":        percentOf(stats.TotalDelivered, stats.TotalReceived),
+			"failure_rate":        percentOf(stats.TotalFailed, stats.TotalReceived),
 			"last_update":         stats.LastUpdate,
 		},
 	})
 }
 
+// percentOf 计算百分比，total 为 0 时返回 0（NaN 无法编码为 JSON）
+func percentOf(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) / float64(total) * 100
+}
+
 // GetWorkspaceCacheStats 获取工作空间缓存统计
 func (h *SimpleAPIHandler) GetWorkspaceCacheStats(c *gin.Context) {
 	if h.workspaceManager == nil {
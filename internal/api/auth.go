@@ -0,0 +1,434 @@
+package api
+
+import (
+	"errors"
+	"miemie/internal/auth"
+	"miemie/internal/middleware"
+	"miemie/internal/workspace"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createKeyRequest 创建API密钥请求
+type createKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 表示不过期
+}
+
+// ListMyKeys 列出当前用户的API密钥
+func (h *SimpleAPIHandler) ListMyKeys(c *gin.Context) {
+	principal, ok := requireUserPrincipal(c)
+	if !ok {
+		return
+	}
+	h.listKeys(c, auth.OwnerUser, principal.ID)
+}
+
+// CreateMyKey 为当前用户创建API密钥，权限范围不能超过当前凭证
+func (h *SimpleAPIHandler) CreateMyKey(c *gin.Context) {
+	principal, ok := requireUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		for _, scope := range []string{auth.ScopeSend, auth.ScopeRead} {
+			if principal.HasScope(scope) {
+				req.Scopes = append(req.Scopes, scope)
+			}
+		}
+	}
+	for _, scope := range req.Scopes {
+		if !principal.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "Cannot grant a scope the current credential does not have",
+				"scope":   scope,
+			})
+			return
+		}
+	}
+
+	h.issueKey(c, auth.OwnerUser, principal.ID, &req)
+}
+
+// RevokeMyKey 吊销当前用户的API密钥
+func (h *SimpleAPIHandler) RevokeMyKey(c *gin.Context) {
+	principal, ok := requireUserPrincipal(c)
+	if !ok {
+		return
+	}
+	h.revokeKey(c, auth.OwnerUser, principal.ID, c.Param("id"))
+}
+
+// ListUserKeys 管理员列出指定用户的API密钥
+func (h *SimpleAPIHandler) ListUserKeys(c *gin.Context) {
+	h.listKeys(c, auth.OwnerUser, c.Param("user_id"))
+}
+
+// CreateUserKey 管理员为指定用户创建API密钥
+func (h *SimpleAPIHandler) CreateUserKey(c *gin.Context) {
+	userID := c.Param("user_id")
+	if !workspace.IsValidUserID(userID) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid user id",
+		})
+		return
+	}
+
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = []string{auth.ScopeSend, auth.ScopeRead}
+	}
+
+	h.issueKey(c, auth.OwnerUser, userID, &req)
+}
+
+// RevokeUserKey 管理员吊销指定用户的API密钥
+func (h *SimpleAPIHandler) RevokeUserKey(c *gin.Context) {
+	h.revokeKey(c, auth.OwnerUser, c.Param("user_id"), c.Param("key_id"))
+}
+
+// ListSenders 列出发送者账户，可按 status、owner 过滤（如 status=pending 查看待审核申请）
+func (h *SimpleAPIHandler) ListSenders(c *gin.Context) {
+	h.listSenders(c, c.Query("status"), c.Query("owner"))
+}
+
+// ListMySenders 列出当前用户申请的发送者账户
+func (h *SimpleAPIHandler) ListMySenders(c *gin.Context) {
+	principal, ok := requireUserPrincipal(c)
+	if !ok {
+		return
+	}
+	h.listSenders(c, c.Query("status"), principal.ID)
+}
+
+// ApplySender 用户申请发送者账户，申请处于 pending 状态，管理员批准后才能签发密钥
+func (h *SimpleAPIHandler) ApplySender(c *gin.Context) {
+	principal, ok := requireUserPrincipal(c)
+	if !ok {
+		return
+	}
+
+	var sender auth.Sender
+	if err := c.ShouldBindJSON(&sender); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+	sender.Owner = principal.ID
+	sender.Status = auth.SenderPending
+
+	if err := h.authStore.CreateSender(&sender); err != nil {
+		h.senderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": "Sender application submitted, waiting for approval",
+		"data":    sender,
+	})
+}
+
+// listSenders 列出发送者账户
+func (h *SimpleAPIHandler) listSenders(c *gin.Context, status, owner string) {
+	senders, err := h.authStore.ListSenders(status, owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to list senders",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    senders,
+	})
+}
+
+// CreateSender 创建发送者账户
+func (h *SimpleAPIHandler) CreateSender(c *gin.Context) {
+	var sender auth.Sender
+	if err := c.ShouldBindJSON(&sender); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	if err := h.authStore.CreateSender(&sender); err != nil {
+		h.senderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": "Sender created successfully",
+		"data":    sender,
+	})
+}
+
+// GetSender 获取发送者账户
+func (h *SimpleAPIHandler) GetSender(c *gin.Context) {
+	sender, err := h.authStore.GetSender(c.Param("id"))
+	if err != nil {
+		h.senderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    sender,
+	})
+}
+
+// UpdateSender 更新发送者账户（名称、状态和允许范围）
+func (h *SimpleAPIHandler) UpdateSender(c *gin.Context) {
+	var sender auth.Sender
+	if err := c.ShouldBindJSON(&sender); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+	sender.ID = c.Param("id")
+
+	if err := h.authStore.UpdateSender(&sender); err != nil {
+		h.senderError(c, err)
+		return
+	}
+
+	updated, err := h.authStore.GetSender(sender.ID)
+	if err != nil {
+		h.senderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Sender updated successfully",
+		"data":    updated,
+	})
+}
+
+// DeleteSender 删除发送者账户并吊销其密钥
+func (h *SimpleAPIHandler) DeleteSender(c *gin.Context) {
+	if err := h.authStore.DeleteSender(c.Param("id")); err != nil {
+		h.senderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Sender deleted successfully",
+	})
+}
+
+// ListSenderKeys 列出发送者的API密钥
+func (h *SimpleAPIHandler) ListSenderKeys(c *gin.Context) {
+	if _, err := h.authStore.GetSender(c.Param("id")); err != nil {
+		h.senderError(c, err)
+		return
+	}
+	h.listKeys(c, auth.OwnerSender, c.Param("id"))
+}
+
+// CreateSenderKey 为发送者创建API密钥，发送者密钥只有 send 权限，待审核的申请不能签发
+func (h *SimpleAPIHandler) CreateSenderKey(c *gin.Context) {
+	senderID := c.Param("id")
+	sender, err := h.authStore.GetSender(senderID)
+	if err != nil {
+		h.senderError(c, err)
+		return
+	}
+	if sender.Status == auth.SenderPending || sender.Status == auth.SenderRejected {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "Sender application has not been approved",
+			"status":  sender.Status,
+		})
+		return
+	}
+
+	var req createKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+	req.Scopes = []string{auth.ScopeSend}
+
+	h.issueKey(c, auth.OwnerSender, senderID, &req)
+}
+
+// RevokeSenderKey 吊销发送者的API密钥
+func (h *SimpleAPIHandler) RevokeSenderKey(c *gin.Context) {
+	h.revokeKey(c, auth.OwnerSender, c.Param("id"), c.Param("key_id"))
+}
+
+// issueKey 创建密钥并返回明文，明文只在此响应中出现一次
+func (h *SimpleAPIHandler) issueKey(c *gin.Context, ownerType, ownerID string, req *createKeyRequest) {
+	if req.ExpiresInDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "expires_in_days cannot be negative",
+		})
+		return
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().UTC().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	key, rawKey, err := h.authStore.CreateKey(ownerType, ownerID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		if err == auth.ErrInvalidScope {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid scopes",
+				"allowed": auth.AllScopes,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to create API key",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"code":    201,
+		"message": "API key created, store it now: it will not be shown again",
+		"data": gin.H{
+			"key":     rawKey,
+			"api_key": key,
+		},
+	})
+}
+
+// listKeys 列出所有者的密钥
+func (h *SimpleAPIHandler) listKeys(c *gin.Context, ownerType, ownerID string) {
+	keys, err := h.authStore.ListKeys(ownerType, ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to list API keys",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    keys,
+	})
+}
+
+// revokeKey 吊销所有者的密钥
+func (h *SimpleAPIHandler) revokeKey(c *gin.Context, ownerType, ownerID, keyID string) {
+	if err := h.authStore.RevokeKey(ownerType, ownerID, keyID); err != nil {
+		if err == auth.ErrKeyNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "API key not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to revoke API key",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "API key revoked",
+	})
+}
+
+// senderError 将发送者存储错误转换为响应
+func (h *SimpleAPIHandler) senderError(c *gin.Context, err error) {
+	switch err {
+	case auth.ErrSenderNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Sender not found",
+		})
+	case auth.ErrSenderExists:
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "Sender already exists",
+		})
+	default:
+		if errors.Is(err, auth.ErrInvalidSender) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid sender",
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to manage sender",
+			"error":   err.Error(),
+		})
+	}
+}
+
+// requireUserPrincipal 密钥和发送者申请的自助管理只对用户开放，发送者由管理员管理
+func requireUserPrincipal(c *gin.Context) (*auth.Principal, bool) {
+	principal := middleware.GetPrincipal(c)
+	if principal == nil || principal.IsSender() {
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    403,
+			"message": "Sender accounts cannot use self-service management",
+		})
+		return nil, false
+	}
+	return principal, true
+}
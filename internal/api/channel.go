@@ -0,0 +1,319 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"miemie/internal/middleware"
+	"miemie/internal/models"
+	"miemie/internal/storage"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 删除频道时对频道中消息的处理方式
+const (
+	channelDeleteMove    = "move"    // 移到默认频道（默认）
+	channelDeleteCascade = "cascade" // 和频道一起删除
+)
+
+// errInvalidChannelRef 消息的 channel_id 格式不正确
+var errInvalidChannelRef = errors.New("channel_id must be a channel ID or slug of 1-64 lowercase letters, digits, '-' or '_'")
+
+// updateChannelRequest 修改频道的请求，未提供的字段保持不变，slug 为空字符串时清除标识
+type updateChannelRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Slug        *string `json:"slug"`
+}
+
+// muteChannelRequest 静音频道的请求，都不提供时一直静音
+type muteChannelRequest struct {
+	Until           *time.Time `json:"until"`
+	DurationSeconds int        `json:"duration_seconds"`
+}
+
+// muteUntil 计算静音截止时间，nil 表示一直静音
+func (req *muteChannelRequest) muteUntil(now time.Time) (*time.Time, error) {
+	if req.Until != nil && req.DurationSeconds != 0 {
+		return nil, errors.New("until and duration_seconds cannot be used together")
+	}
+	if req.DurationSeconds < 0 {
+		return nil, errors.New("duration_seconds cannot be negative")
+	}
+	if req.DurationSeconds > 0 {
+		until := now.Add(time.Duration(req.DurationSeconds) * time.Second)
+		return &until, nil
+	}
+	if req.Until != nil && !req.Until.After(now) {
+		return nil, errors.New("until must be in the future")
+	}
+	return req.Until, nil
+}
+
+// checkChannelSlug 检查频道标识的格式，并且没有被其他频道使用，不可用时写入错误响应
+func checkChannelSlug(c *gin.Context, userStorage *storage.UserMessageStorage, slug, channelID string) bool {
+	if !models.ValidChannelSlug(slug) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid channel slug",
+			"error":   "slug must be 1-64 lowercase letters, digits, '-' or '_', starting with a letter or digit",
+		})
+		return false
+	}
+
+	existing, err := userStorage.GetChannelByRef(slug)
+	if err != nil && err != storage.ErrChannelNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to check channel slug",
+			"error":   err.Error(),
+		})
+		return false
+	}
+	if existing != nil && existing.ID != channelID {
+		c.JSON(http.StatusConflict, gin.H{
+			"code":    409,
+			"message": "Channel slug already in use",
+			"error":   "slug " + slug + " is used by channel " + existing.ID,
+		})
+		return false
+	}
+	return true
+}
+
+// resolveChannelRefs 把查询参数中的频道ID或标识解析为频道ID，不存在的频道原样保留
+func resolveChannelRefs(c *gin.Context, userStorage *storage.UserMessageStorage, refs []string) ([]string, bool) {
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		id, err := userStorage.ChannelIDOf(ref)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to get channel",
+				"error":   err.Error(),
+			})
+			return nil, false
+		}
+		ids = append(ids, id)
+	}
+	return ids, true
+}
+
+// channelForUpdate 获取要修改的频道，不存在时返回 404
+func (h *SimpleAPIHandler) channelForUpdate(c *gin.Context) (*storage.UserMessageStorage, string, bool) {
+	userID := middleware.GetUserID(c)
+	channelID := c.Param("id")
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return nil, "", false
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	channel, err := userStorage.GetChannelByRef(channelID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Channel not found",
+			"error":   err.Error(),
+		})
+		return nil, "", false
+	}
+	channelID = channel.ID
+	return userStorage, channelID, true
+}
+
+// respondChannel 返回频道的最新状态
+func respondChannel(c *gin.Context, userStorage *storage.UserMessageStorage, channelID, message string) {
+	channel, err := userStorage.GetChannel(channelID)
+	if err == nil {
+		err = userStorage.FillUnreadCounts([]*models.Channel{channel})
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get channel",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": message,
+		"data":    channel,
+	})
+}
+
+// UpdateChannel 修改频道名称、描述或标识
+func (h *SimpleAPIHandler) UpdateChannel(c *gin.Context) {
+	var req updateChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if req.Name == nil && req.Description == nil && req.Slug == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   "name, description or slug is required",
+		})
+		return
+	}
+	if req.Name != nil && strings.TrimSpace(*req.Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   "name cannot be empty",
+		})
+		return
+	}
+
+	userStorage, channelID, ok := h.channelForUpdate(c)
+	if !ok {
+		return
+	}
+	if req.Slug != nil && *req.Slug != "" && !checkChannelSlug(c, userStorage, *req.Slug, channelID) {
+		return
+	}
+	if err := userStorage.UpdateChannel(channelID, req.Name, req.Description, req.Slug); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to update channel",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	respondChannel(c, userStorage, channelID, "Channel updated")
+}
+
+// DeleteChannel 删除频道，mode=move（默认）把消息移到默认频道，mode=cascade 同时删除消息
+func (h *SimpleAPIHandler) DeleteChannel(c *gin.Context) {
+	mode := c.DefaultQuery("mode", channelDeleteMove)
+	if mode != channelDeleteMove && mode != channelDeleteCascade {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   "mode must be move or cascade",
+		})
+		return
+	}
+
+	// 不先检查频道是否存在：频道已删除但清理未完成时，重试的请求由存储层补做清理后返回404
+	ws, err := h.workspaceManager.GetUserWorkspace(middleware.GetUserID(c))
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+	userStorage := storage.NewUserMessageStorage(ws)
+	channelIDs, ok := resolveChannelRefs(c, userStorage, []string{c.Param("id")})
+	if !ok {
+		return
+	}
+	channelID := channelIDs[0]
+	if channelID == storage.DefaultChannelID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Cannot delete channel",
+			"error":   storage.ErrDefaultChannel.Error(),
+		})
+		return
+	}
+	count, err := userStorage.DeleteChannel(channelID, mode == channelDeleteCascade)
+	if err == storage.ErrChannelNotFound {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Channel not found",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to delete channel",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	data := gin.H{
+		"channel_id": channelID,
+		"mode":       mode,
+	}
+	if mode == channelDeleteCascade {
+		data["deleted_messages"] = count
+	} else {
+		data["moved_messages"] = count
+		data["moved_to"] = storage.DefaultChannelID
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Channel deleted",
+		"data":    data,
+	})
+}
+
+// MuteChannel 静音频道，可以指定截止时间；静音期间消息照常存储，但不推送也不显示未读数
+func (h *SimpleAPIHandler) MuteChannel(c *gin.Context) {
+	var req muteChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+	until, err := req.muteUntil(time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	userStorage, channelID, ok := h.channelForUpdate(c)
+	if !ok {
+		return
+	}
+	if err := userStorage.SetChannelMute(channelID, true, until); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to mute channel",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	respondChannel(c, userStorage, channelID, "Channel muted")
+}
+
+// UnmuteChannel 取消频道静音
+func (h *SimpleAPIHandler) UnmuteChannel(c *gin.Context) {
+	userStorage, channelID, ok := h.channelForUpdate(c)
+	if !ok {
+		return
+	}
+	if err := userStorage.SetChannelMute(channelID, false, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to unmute channel",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	respondChannel(c, userStorage, channelID, "Channel unmuted")
+}
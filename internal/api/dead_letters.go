@@ -0,0 +1,208 @@
+package api
+
+import (
+	"miemie/internal/delivery"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListDeadLetters 列出死信
+func (h *SimpleAPIHandler) ListDeadLetters(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	letters, total, err := h.deliverySystem.ListDeadLetters(delivery.DeadLetterFilter{
+		UserID: c.Query("user_id"),
+		Reason: c.Query("reason"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		h.respondDeadLetterError(c, err, "Failed to list dead letters")
+		return
+	}
+
+	// 列表中不返回完整任务，详情请使用单条查询接口
+	items := make([]gin.H, 0, len(letters))
+	for _, dl := range letters {
+		items = append(items, gin.H{
+			"id":           dl.ID,
+			"message_id":   dl.MessageID,
+			"channel_id":   dl.ChannelID,
+			"target_users": dl.TargetUsers,
+			"reason":       dl.Reason,
+			"attempts":     dl.Attempts,
+			"dead_at":      dl.DeadAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"dead_letters": items,
+			"total":        total,
+			"limit":        limit,
+			"offset":       offset,
+		},
+	})
+}
+
+// GetDeadLetter 查看单条死信（包含完整任务和每次尝试的错误）
+func (h *SimpleAPIHandler) GetDeadLetter(c *gin.Context) {
+	dl, err := h.deliverySystem.GetDeadLetter(c.Param("id"))
+	if err != nil {
+		h.respondDeadLetterError(c, err, "Failed to get dead letter")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    dl,
+	})
+}
+
+// ReplayDeadLetter 重新投递单条死信
+func (h *SimpleAPIHandler) ReplayDeadLetter(c *gin.Context) {
+	id := c.Param("id")
+
+	taskID, err := h.deliverySystem.ReplayDeadLetter(id)
+	if err != nil {
+		h.respondDeadLetterError(c, err, "Failed to replay dead letter")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    202,
+		"message": "Dead letter resubmitted for delivery",
+		"data": gin.H{
+			"id":      id,
+			"task_id": taskID,
+		},
+	})
+}
+
+// ReplayDeadLetters 批量重新投递死信
+func (h *SimpleAPIHandler) ReplayDeadLetters(c *gin.Context) {
+	var req struct {
+		IDs    []string `json:"ids"`
+		All    bool     `json:"all"`
+		UserID string   `json:"user_id"`
+		Reason string   `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// 防止误操作：未指定ID时必须显式声明 all 或给出过滤条件
+	if len(req.IDs) == 0 && !req.All && req.UserID == "" && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Specify ids, a filter (user_id/reason) or all=true",
+		})
+		return
+	}
+
+	replayed, failed, err := h.deliverySystem.ReplayDeadLetters(req.IDs, delivery.DeadLetterFilter{
+		UserID: req.UserID,
+		Reason: req.Reason,
+	})
+	if err != nil {
+		h.respondDeadLetterError(c, err, "Failed to replay dead letters")
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    202,
+		"message": "Dead letters resubmitted for delivery",
+		"data": gin.H{
+			"replayed":       replayed,
+			"failed":         failed,
+			"replayed_count": len(replayed),
+			"failed_count":   len(failed),
+		},
+	})
+}
+
+// DeleteDeadLetter 删除单条死信
+func (h *SimpleAPIHandler) DeleteDeadLetter(c *gin.Context) {
+	if err := h.deliverySystem.DeleteDeadLetter(c.Param("id")); err != nil {
+		h.respondDeadLetterError(c, err, "Failed to delete dead letter")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Dead letter deleted",
+	})
+}
+
+// PurgeDeadLetters 清理死信，可通过 before 参数（RFC3339）只清理更早的条目
+func (h *SimpleAPIHandler) PurgeDeadLetters(c *gin.Context) {
+	var before time.Time
+	if beforeStr := c.Query("before"); beforeStr != "" {
+		t, err := time.Parse(time.RFC3339, beforeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid before parameter, expected RFC3339 time",
+				"error":   err.Error(),
+			})
+			return
+		}
+		before = t
+	}
+
+	purged, err := h.deliverySystem.PurgeDeadLetters(before)
+	if err != nil {
+		h.respondDeadLetterError(c, err, "Failed to purge dead letters")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Dead letters purged",
+		"data": gin.H{
+			"purged": purged,
+		},
+	})
+}
+
+// respondDeadLetterError 将死信相关错误映射为HTTP响应
+func (h *SimpleAPIHandler) respondDeadLetterError(c *gin.Context, err error, message string) {
+	switch err {
+	case delivery.ErrDeadLetterNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Dead letter not found",
+		})
+	case delivery.ErrDeadLettersDisabled:
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    503,
+			"message": "Dead letter queue not enabled",
+			"error":   err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": message,
+			"error":   err.Error(),
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"fmt"
+	"miemie/internal/dedup"
+	"miemie/internal/logger"
+	"miemie/internal/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader 客户端重试时携带的幂等键请求头
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// submission 一次已登记去重键的提交
+type submission struct {
+	key      string
+	original *dedup.Entry // 重复提交时为首次提交的登记
+}
+
+// duplicate 是否为窗口内的重复提交
+func (s *submission) duplicate() bool {
+	return s.original != nil
+}
+
+// submissionKey 消息的去重键：dedup_key 字段优先，其次是 Idempotency-Key 头，
+// 都没有时如果开启了按内容去重则使用内容摘要；返回空字符串表示不去重
+func (h *SimpleAPIHandler) submissionKey(req *models.CreateMessageRequest, headerKey string) (string, error) {
+	key := req.DedupKey
+	if key == "" {
+		key = headerKey
+	}
+	if len(key) > dedup.MaxKeyLength {
+		return "", fmt.Errorf("dedup key longer than %d characters", dedup.MaxKeyLength)
+	}
+	if key == "" && h.config.API.Dedup.ContentHash {
+		key = "sha256:" + dedup.Fingerprint(req)
+	}
+	return key, nil
+}
+
+// claimSubmission 为提交者登记消息的去重键，key 为空时不去重
+// 窗口内重复提交时返回首次提交的登记；去重键用于不同内容时返回 dedup.ErrKeyMismatch
+func (h *SimpleAPIHandler) claimSubmission(userID, key string, req *models.CreateMessageRequest, message *models.Message) (*submission, error) {
+	sub := &submission{key: key}
+	if key == "" {
+		return sub, nil
+	}
+
+	entry, claimed, err := h.dedupStore.Claim(userID, key, dedup.Fingerprint(req), message.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		sub.original = entry
+	}
+	return sub, nil
+}
+
+// releaseSubmission 提交失败时释放去重键，客户端可以用同一个键重试
+func (h *SimpleAPIHandler) releaseSubmission(userID string, sub *submission, message *models.Message) {
+	if sub == nil || sub.key == "" || sub.duplicate() {
+		return
+	}
+	if err := h.dedupStore.Release(userID, sub.key, message.ID); err != nil {
+		logger.Warnf("Failed to release dedup key for %s: %v", userID, err)
+	}
+}
+
+// submissionError 登记去重键失败时的响应
+func submissionError(c *gin.Context, err error) {
+	if err == dedup.ErrKeyMismatch {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"code":    422,
+			"message": "Dedup key already used for a different message",
+			"error":   err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code":    500,
+		"message": "Failed to check dedup key",
+		"error":   err.Error(),
+	})
+}
+
+// duplicateResult 重复提交的结果，返回首次提交的消息ID
+func duplicateResult(userID string, original *dedup.Entry) gin.H {
+	return gin.H{
+		"message_id":   original.MessageID,
+		"user_id":      userID,
+		"duplicate":    true,
+		"submitted_at": original.CreatedAt,
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"database/sql"
+	"miemie/internal/config"
+	"miemie/internal/dedup"
+	"miemie/internal/models"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newDedupHandler(t *testing.T, contentHash bool) *SimpleAPIHandler {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := dedup.NewStore(db, time.Hour)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(store.Close)
+
+	cfg := &config.Config{}
+	cfg.API.Dedup.ContentHash = contentHash
+	return &SimpleAPIHandler{config: cfg, dedupStore: store}
+}
+
+func TestSubmissionKeyPrecedence(t *testing.T) {
+	h := newDedupHandler(t, true)
+	req := &models.CreateMessageRequest{ChannelID: "default", Title: "t", Content: "c"}
+
+	key, err := h.submissionKey(req, "header-key")
+	if err != nil || key != "header-key" {
+		t.Fatalf("submissionKey with header = %q, %v", key, err)
+	}
+
+	req.DedupKey = "body-key"
+	if key, _ := h.submissionKey(req, "header-key"); key != "body-key" {
+		t.Fatalf("submissionKey = %q, want dedup_key to win", key)
+	}
+
+	req.DedupKey = ""
+	key, err = h.submissionKey(req, "")
+	if err != nil || !strings.HasPrefix(key, "sha256:") {
+		t.Fatalf("submissionKey with content hash = %q, %v", key, err)
+	}
+
+	if _, err := h.submissionKey(req, strings.Repeat("k", dedup.MaxKeyLength+1)); err == nil {
+		t.Fatalf("submissionKey accepted an over-long key")
+	}
+
+	h = newDedupHandler(t, false)
+	if key, _ := h.submissionKey(req, ""); key != "" {
+		t.Fatalf("submissionKey without content hash = %q, want no dedup", key)
+	}
+}
+
+func TestClaimSubmissionDuplicateAndMismatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	h := newDedupHandler(t, false)
+
+	req := &models.CreateMessageRequest{ChannelID: "default", Title: "deploy", Content: "done", DedupKey: "deploy-42"}
+	first := &models.Message{ID: "msg-1"}
+	sub, err := h.claimSubmission("alice", "deploy-42", req, first)
+	if err != nil || sub.duplicate() {
+		t.Fatalf("first claimSubmission = %+v, %v", sub, err)
+	}
+
+	// 同样的请求重试，返回首次提交的消息
+	sub, err = h.claimSubmission("alice", "deploy-42", req, &models.Message{ID: "msg-2"})
+	if err != nil || !sub.duplicate() || sub.original.MessageID != "msg-1" {
+		t.Fatalf("retry claimSubmission = %+v, %v", sub, err)
+	}
+
+	// 同一个键用于不同内容时返回422
+	changed := *req
+	changed.Content = "failed"
+	_, err = h.claimSubmission("alice", "deploy-42", &changed, &models.Message{ID: "msg-3"})
+	if err != dedup.ErrKeyMismatch {
+		t.Fatalf("claimSubmission with changed content error = %v, want ErrKeyMismatch", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	submissionError(c, err)
+	if w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), `"code":422`) {
+		t.Fatalf("submissionError = %d %s, want 422", w.Code, w.Body.String())
+	}
+
+	// 首次提交失败释放后可以用同一个键重新提交
+	h.releaseSubmission("alice", &submission{key: "deploy-42"}, first)
+	sub, err = h.claimSubmission("alice", "deploy-42", &changed, &models.Message{ID: "msg-4"})
+	if err != nil || sub.duplicate() {
+		t.Fatalf("claimSubmission after release = %+v, %v", sub, err)
+	}
+}
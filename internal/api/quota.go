@@ -0,0 +1,170 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"miemie/internal/auth"
+	"miemie/internal/delivery"
+	"miemie/internal/logger"
+	"miemie/internal/models"
+	"miemie/internal/ratelimit"
+	"miemie/internal/workspace"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 配额名称，出现在配额错误的 quota.name 中
+const (
+	QuotaMessagesPerDay = "messages_per_day"
+	QuotaMessageSize    = "message_size"
+	QuotaChannels       = "channels"
+	QuotaWorkspaces     = "workspaces"
+)
+
+// messageSize 消息大小：标题、正文和元数据 JSON 的字节数
+func messageSize(req *models.CreateMessageRequest) int64 {
+	size := int64(len(req.Title) + len(req.Content))
+	if len(req.Metadata) > 0 {
+		metadataJSON, _ := json.Marshal(req.Metadata)
+		size += int64(len(metadataJSON))
+	}
+	return size
+}
+
+// checkMessageSize 检查消息是否超过 user.message_size_limit
+func (h *SimpleAPIHandler) checkMessageSize(req *models.CreateMessageRequest) error {
+	limit := h.config.User.MessageSizeLimit
+	if size := messageSize(req); size > limit {
+		return fmt.Errorf("message size %d bytes exceeds limit of %d bytes", size, limit)
+	}
+	return nil
+}
+
+// messageTooLarge 返回 413 错误
+func (h *SimpleAPIHandler) messageTooLarge(c *gin.Context, req *models.CreateMessageRequest) {
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"code":    413,
+		"message": "Message too large",
+		"error":   "message_too_large",
+		"quota": gin.H{
+			"name":  QuotaMessageSize,
+			"limit": h.config.User.MessageSizeLimit,
+			"used":  messageSize(req),
+		},
+	})
+}
+
+// recipientQuota 一条消息在各接收者当天配额中的预占结果
+type recipientQuota struct {
+	day      string
+	reserved []string                      // 已预占配额的接收者
+	exceeded map[string]*auth.MessageUsage // 当天配额已满的接收者
+}
+
+// reserveRecipients 消息写入每个接收者的工作空间，计入接收者当天的消息配额，每个接收者一条
+func (h *SimpleAPIHandler) reserveRecipients(recipients []string) (*recipientQuota, error) {
+	day, exceeded, err := h.authStore.ReserveMessages(recipients, h.config.User.MaxMessagesPerDay)
+	if err != nil {
+		return nil, err
+	}
+
+	quota := &recipientQuota{day: day, exceeded: exceeded}
+	for _, userID := range recipients {
+		if _, ok := exceeded[userID]; !ok {
+			quota.reserved = append(quota.reserved, userID)
+		}
+	}
+	return quota, nil
+}
+
+// releaseRecipients 归还接收者 day 当天预占但未投递的消息配额
+func (h *SimpleAPIHandler) releaseRecipients(day string, userIDs []string) {
+	if err := h.authStore.ReleaseMessages(userIDs, day); err != nil {
+		logger.Warnf("Failed to release message quota for %d recipients: %v", len(userIDs), err)
+	}
+}
+
+// settleRecipients 归还投递系统拒绝的接收者的配额，返回配额已满和被投递系统拒绝的全部接收者及原因
+func (h *SimpleAPIHandler) settleRecipients(quota *recipientQuota, result delivery.FanoutResult) map[string]string {
+	rejected := make(map[string]string, len(quota.exceeded)+len(result.Rejected))
+	for userID := range quota.exceeded {
+		rejected[userID] = auth.ErrQuotaExceeded.Error()
+	}
+
+	released := make([]string, 0, len(result.Rejected))
+	for userID, reason := range result.Rejected {
+		rejected[userID] = reason
+		released = append(released, userID)
+	}
+	h.releaseRecipients(quota.day, released)
+	return rejected
+}
+
+// quotaExceeded 所有接收者当天配额都已满时返回 429 并带上 Retry-After（距离 UTC 零点的秒数）
+// 只有一个接收者时 quota 中带上该接收者的用量
+func (h *SimpleAPIHandler) quotaExceeded(c *gin.Context, quota *recipientQuota) {
+	var usage *auth.MessageUsage
+	for _, u := range quota.exceeded {
+		usage = u
+		break
+	}
+
+	retryAfter := ratelimit.CeilSeconds(time.Until(usage.ResetAt))
+	detail := gin.H{
+		"name":      QuotaMessagesPerDay,
+		"limit":     usage.Limit,
+		"requested": 1,
+		"reset_at":  usage.ResetAt,
+	}
+	if len(quota.exceeded) == 1 {
+		detail["used"] = usage.Used
+	} else {
+		detail["recipients"] = len(quota.exceeded)
+	}
+
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"code":        429,
+		"message":     "Daily message quota exceeded",
+		"error":       "quota_exceeded",
+		"quota":       detail,
+		"retry_after": retryAfter,
+	})
+}
+
+// channelQuotaExceeded 返回频道数量超限的 429 错误
+func (h *SimpleAPIHandler) channelQuotaExceeded(c *gin.Context, used int) {
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"code":    429,
+		"message": "Channel quota exceeded",
+		"error":   "quota_exceeded",
+		"quota": gin.H{
+			"name":  QuotaChannels,
+			"limit": h.config.User.MaxChannels,
+			"used":  used,
+		},
+	})
+}
+
+// workspaceError 获取工作空间失败，工作空间数量达到上限时返回 503
+func workspaceError(c *gin.Context, err error) {
+	if err == workspace.ErrWorkspaceLimit {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    503,
+			"message": "Workspace limit reached",
+			"error":   "quota_exceeded",
+			"quota": gin.H{
+				"name": QuotaWorkspaces,
+			},
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"code":    500,
+		"message": "Failed to get user workspace",
+		"error":   err.Error(),
+	})
+}
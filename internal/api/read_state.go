@@ -0,0 +1,300 @@
+package api
+
+import (
+	"fmt"
+	"miemie/internal/middleware"
+	"miemie/internal/models"
+	"miemie/internal/storage"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readDevice 通过 HTTP 接口标记已读时记录的设备
+const readDevice = "api_client"
+
+// bulkReadRequest 批量修改已读状态的请求
+type bulkReadRequest struct {
+	MessageIDs []string `json:"message_ids" binding:"required,min=1,max=1000"`
+}
+
+// parseReadFilter 解析 starred、archived、unread 查询参数，未提供的参数不过滤
+func parseReadFilter(c *gin.Context) (*storage.ReadFilter, error) {
+	filter := &storage.ReadFilter{}
+	for name, dest := range map[string]**bool{
+		"starred":  &filter.Starred,
+		"archived": &filter.Archived,
+		"unread":   &filter.Unread,
+	} {
+		value := c.Query(name)
+		if value == "" {
+			continue
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be true or false", name)
+		}
+		*dest = &b
+	}
+	return filter, nil
+}
+
+// StarMessage 标记星标
+func (h *SimpleAPIHandler) StarMessage(c *gin.Context) {
+	h.setMessageState(c, "Message starred", func(s *storage.UserMessageStorage, id string) (*models.ReadStatus, error) {
+		return s.SetStarred(id, true)
+	})
+}
+
+// UnstarMessage 取消星标
+func (h *SimpleAPIHandler) UnstarMessage(c *gin.Context) {
+	h.setMessageState(c, "Message unstarred", func(s *storage.UserMessageStorage, id string) (*models.ReadStatus, error) {
+		return s.SetStarred(id, false)
+	})
+}
+
+// ArchiveMessage 归档消息
+func (h *SimpleAPIHandler) ArchiveMessage(c *gin.Context) {
+	h.setMessageState(c, "Message archived", func(s *storage.UserMessageStorage, id string) (*models.ReadStatus, error) {
+		return s.SetArchived(id, true)
+	})
+}
+
+// UnarchiveMessage 取消归档
+func (h *SimpleAPIHandler) UnarchiveMessage(c *gin.Context) {
+	h.setMessageState(c, "Message unarchived", func(s *storage.UserMessageStorage, id string) (*models.ReadStatus, error) {
+		return s.SetArchived(id, false)
+	})
+}
+
+// setMessageState 修改单条消息的状态，消息不存在时返回 404
+func (h *SimpleAPIHandler) setMessageState(c *gin.Context, message string, update func(s *storage.UserMessageStorage, id string) (*models.ReadStatus, error)) {
+	userID := middleware.GetUserID(c)
+	messageID := c.Param("id")
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	if _, err := userStorage.GetMessage(messageID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Message not found",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	status, err := update(userStorage, messageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to update message state",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": message,
+		"data":    status,
+	})
+}
+
+// MarkMessagesRead 批量标记已读，不存在或已过期的消息ID会被忽略
+func (h *SimpleAPIHandler) MarkMessagesRead(c *gin.Context) {
+	h.bulkUpdateRead(c, "Messages marked as read", func(s *storage.UserMessageStorage, ids []string) (int, error) {
+		return len(ids), s.MarkMultipleAsRead(ids, readDevice)
+	})
+}
+
+// MarkMessagesUnread 批量标记未读，保留星标和归档状态
+func (h *SimpleAPIHandler) MarkMessagesUnread(c *gin.Context) {
+	h.bulkUpdateRead(c, "Messages marked as unread", func(s *storage.UserMessageStorage, ids []string) (int, error) {
+		return s.MarkMultipleAsUnread(ids)
+	})
+}
+
+// bulkUpdateRead 批量修改已读状态，update 返回实际更新的消息数
+func (h *SimpleAPIHandler) bulkUpdateRead(c *gin.Context, message string, update func(s *storage.UserMessageStorage, ids []string) (int, error)) {
+	userID := middleware.GetUserID(c)
+
+	var req bulkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	ids, err := userStorage.ExistingMessageIDs(req.MessageIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to look up messages",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	updated := 0
+	if len(ids) > 0 {
+		updated, err = update(userStorage, ids)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to update read status",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": message,
+		"data": gin.H{
+			"updated": updated,
+			"ignored": len(req.MessageIDs) - len(ids),
+		},
+	})
+}
+
+// MarkChannelRead 将频道的阅读位置推进到最新消息，频道中的消息全部变为已读
+func (h *SimpleAPIHandler) MarkChannelRead(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	channelID := c.Param("id")
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	channel, err := userStorage.GetChannelByRef(channelID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Channel not found",
+			"error":   err.Error(),
+		})
+		return
+	}
+	channelID = channel.ID
+
+	ids, err := userStorage.MarkChannelAsRead(channelID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to mark channel as read",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Channel marked as read",
+		"data": gin.H{
+			"channel_id": channelID,
+			"updated":    len(ids),
+		},
+	})
+}
+
+// SetReadingPosition 将频道的阅读位置推进到指定消息，该消息及之前的消息都视为已读
+// 位置只前进不后退，多个设备同时上报时以最远的为准
+func (h *SimpleAPIHandler) SetReadingPosition(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	channelID := c.Param("id")
+
+	var req struct {
+		MessageID string `json:"message_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	channel, err := userStorage.GetChannelByRef(channelID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Channel not found",
+			"error":   err.Error(),
+		})
+		return
+	}
+	channelID = channel.ID
+	message, err := userStorage.GetMessage(req.MessageID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Message not found",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if message.ChannelID != channelID {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Message does not belong to this channel",
+		})
+		return
+	}
+
+	position, _, err := userStorage.AdvanceReadingPosition(message)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to update reading position",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	unread, err := userStorage.GetUnreadCount(channelID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get unread count",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Reading position updated",
+		"data": gin.H{
+			"position":     position,
+			"unread_count": unread,
+		},
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"miemie/internal/delivery"
+	"miemie/internal/middleware"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMessageStatus 获取消息的投递状态
+// 提交者可以看到全部接收者的回执，接收者只能看到自己的回执
+func (h *SimpleAPIHandler) GetMessageStatus(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	messageID := c.Param("id")
+
+	if h.deliverySystem == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    503,
+			"message": "Delivery system not available",
+		})
+		return
+	}
+
+	receipts, err := h.deliverySystem.GetReceipts(messageID)
+	if err != nil {
+		if err == delivery.ErrReceiptsDisabled {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"code":    503,
+				"message": "Delivery receipts not enabled",
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get message status",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	visible := make([]*delivery.Receipt, 0, len(receipts))
+	for _, receipt := range receipts {
+		if receipt.SubmittedBy == userID || receipt.UserID == userID {
+			visible = append(visible, receipt)
+		}
+	}
+
+	if len(visible) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Message status not found",
+		})
+		return
+	}
+
+	summary := make(map[string]int)
+	for _, receipt := range visible {
+		summary[receipt.State]++
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"message_id": messageID,
+			"summary":    summary,
+			"recipients": visible,
+		},
+	})
+}
+
+// validateCallbackURL 校验回调地址，只允许 http/https，且不能指向内部地址
+func (h *SimpleAPIHandler) validateCallbackURL(callbackURL string) error {
+	if callbackURL == "" {
+		return nil
+	}
+	return h.deliverySystem.CheckCallbackURL(callbackURL)
+}
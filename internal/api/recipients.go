@@ -0,0 +1,132 @@
+package api
+
+import (
+	"fmt"
+	"miemie/internal/auth"
+	"miemie/internal/models"
+	"miemie/internal/workspace"
+)
+
+// resolveRecipients 根据请求中的接收者选择器计算最终接收用户列表（去重并保持顺序）
+// 未指定任何选择器时，投递给消息自身的 user_id
+func (h *SimpleAPIHandler) resolveRecipients(req *models.CreateMessageRequest, message *models.Message) ([]string, error) {
+	if !req.HasRecipientSelectors() {
+		return []string{message.UserID}, nil
+	}
+
+	seen := make(map[string]bool)
+	var recipients []string
+	add := func(userID string) error {
+		if !workspace.IsValidUserID(userID) {
+			return fmt.Errorf("invalid recipient user id: %q", userID)
+		}
+		if !seen[userID] {
+			seen[userID] = true
+			recipients = append(recipients, userID)
+		}
+		return nil
+	}
+
+	for _, userID := range req.Recipients {
+		if err := add(userID); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, group := range req.Groups {
+		members, exists := h.config.Recipients.Groups[group]
+		if !exists {
+			return nil, fmt.Errorf("unknown user group: %s", group)
+		}
+		for _, userID := range members {
+			if err := add(userID); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if req.Broadcast {
+		users, err := h.workspaceManager.ListAllUsers()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list workspaces: %w", err)
+		}
+		for _, userID := range users {
+			if err := add(userID); err != nil {
+				// 目录名不合法的工作空间直接跳过
+				continue
+			}
+		}
+	}
+
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("recipient selectors matched no users")
+	}
+
+	if max := h.config.Recipients.MaxPerMessage; max > 0 && len(recipients) > max {
+		return nil, fmt.Errorf("too many recipients: %d (max %d)", len(recipients), max)
+	}
+
+	return recipients, nil
+}
+
+// recipientOutcomes 将群发提交结果整理为按接收者的状态列表
+func recipientOutcomes(recipients []string, rejected map[string]string) []map[string]interface{} {
+	outcomes := make([]map[string]interface{}, 0, len(recipients))
+	for _, userID := range recipients {
+		outcome := map[string]interface{}{
+			"user_id": userID,
+			"status":  "queued",
+		}
+		if reason, failed := rejected[userID]; failed {
+			outcome["status"] = "rejected"
+			outcome["error"] = reason
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	return outcomes
+}
+
+// checkRecipientAccess 检查主体能否投递给这些接收者：发送者账户按允许列表检查，
+// 拥有 messages:fanout 权限的主体不受限制，其他主体只能投递给自己
+func checkRecipientAccess(principal *auth.Principal, req *models.CreateMessageRequest, recipients []string) error {
+	if principal == nil {
+		return fmt.Errorf("request is not authenticated")
+	}
+	if principal.IsSender() {
+		return checkSenderAccess(principal.Sender, req, recipients)
+	}
+	if principal.Can(auth.PermMessagesFanout) {
+		return nil
+	}
+	if req.Broadcast {
+		return fmt.Errorf("broadcast requires the %s permission", auth.PermMessagesFanout)
+	}
+	if len(req.Groups) > 0 {
+		return fmt.Errorf("sending to user groups requires the %s permission", auth.PermMessagesFanout)
+	}
+	for _, userID := range recipients {
+		if userID != principal.ID {
+			return fmt.Errorf("sending to user %s requires the %s permission", userID, auth.PermMessagesFanout)
+		}
+	}
+	return nil
+}
+
+// checkSenderAccess 发送者账户必须显式指定接收者，且只能发送给允许的用户和频道
+func checkSenderAccess(sender *auth.Sender, req *models.CreateMessageRequest, recipients []string) error {
+	if !req.HasRecipientSelectors() {
+		return fmt.Errorf("sender accounts must specify recipients, groups or broadcast")
+	}
+	if !sender.AllowsChannel(req.ChannelID) {
+		return fmt.Errorf("sender %s may not post to channel %s", sender.ID, req.ChannelID)
+	}
+	if req.Broadcast && !sender.AllowsAnyUser() {
+		return fmt.Errorf("sender %s may not broadcast", sender.ID)
+	}
+	for _, userID := range recipients {
+		if !sender.AllowsUser(userID) {
+			return fmt.Errorf("sender %s may not post to user %s", sender.ID, userID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"miemie/internal/auth"
+	"miemie/internal/models"
+	"testing"
+)
+
+func userPrincipal(id, role string, scopes ...string) *auth.Principal {
+	return &auth.Principal{Type: auth.PrincipalUser, ID: id, Role: role, Scopes: scopes}
+}
+
+func TestCheckRecipientAccessUserOnlyReachesSelf(t *testing.T) {
+	alice := userPrincipal("alice", auth.RoleUser, auth.ScopeSend, auth.ScopeRead)
+
+	if err := checkRecipientAccess(alice, &models.CreateMessageRequest{}, []string{"alice"}); err != nil {
+		t.Fatalf("own workspace rejected: %v", err)
+	}
+	req := &models.CreateMessageRequest{Recipients: []string{"alice"}}
+	if err := checkRecipientAccess(alice, req, []string{"alice"}); err != nil {
+		t.Fatalf("explicit self recipient rejected: %v", err)
+	}
+
+	denied := []struct {
+		name       string
+		req        *models.CreateMessageRequest
+		recipients []string
+	}{
+		{"other user", &models.CreateMessageRequest{Recipients: []string{"alice", "bob"}}, []string{"alice", "bob"}},
+		{"group", &models.CreateMessageRequest{Groups: []string{"ops"}}, []string{"alice"}},
+		{"broadcast", &models.CreateMessageRequest{Broadcast: true}, []string{"alice", "bob"}},
+	}
+	for _, tc := range denied {
+		if err := checkRecipientAccess(alice, tc.req, tc.recipients); err == nil {
+			t.Errorf("%s: expected access to be denied", tc.name)
+		}
+	}
+}
+
+func TestCheckRecipientAccessFanoutPermission(t *testing.T) {
+	req := &models.CreateMessageRequest{Broadcast: true, Groups: []string{"ops"}}
+	recipients := []string{"alice", "bob"}
+
+	for _, role := range []string{auth.RoleAdmin, auth.RoleOperator} {
+		if err := checkRecipientAccess(userPrincipal("root", role, auth.ScopeAdmin), req, recipients); err != nil {
+			t.Errorf("%s with admin scope rejected: %v", role, err)
+		}
+	}
+
+	// 管理权限还要求凭证带有 admin 权限范围
+	sendOnly := userPrincipal("root", auth.RoleAdmin, auth.ScopeSend)
+	if err := checkRecipientAccess(sendOnly, req, recipients); err == nil {
+		t.Fatal("admin role without admin scope should not fan out")
+	}
+
+	if err := checkRecipientAccess(nil, &models.CreateMessageRequest{}, []string{"alice"}); err == nil {
+		t.Fatal("unauthenticated request should be denied")
+	}
+}
+
+func TestCheckRecipientAccessSender(t *testing.T) {
+	sender := &auth.Principal{
+		Type:   auth.PrincipalSender,
+		ID:     "monitoring",
+		Role:   auth.RoleSender,
+		Scopes: []string{auth.ScopeSend},
+		Sender: &auth.Sender{ID: "monitoring", AllowedUsers: []string{"alice"}, AllowedChannels: []string{"*"}},
+	}
+
+	req := &models.CreateMessageRequest{ChannelID: "alerts", Recipients: []string{"alice"}}
+	if err := checkRecipientAccess(sender, req, []string{"alice"}); err != nil {
+		t.Fatalf("allowed recipient rejected: %v", err)
+	}
+	req = &models.CreateMessageRequest{ChannelID: "alerts", Recipients: []string{"bob"}}
+	if err := checkRecipientAccess(sender, req, []string{"bob"}); err == nil {
+		t.Fatal("sender reached a user outside allowed_users")
+	}
+	req = &models.CreateMessageRequest{ChannelID: "alerts", Broadcast: true}
+	if err := checkRecipientAccess(sender, req, []string{"alice"}); err == nil {
+		t.Fatal("sender without wildcard users broadcast")
+	}
+}
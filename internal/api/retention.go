@@ -0,0 +1,113 @@
+package api
+
+import (
+	"errors"
+	"miemie/internal/middleware"
+	"miemie/internal/models"
+	"miemie/internal/storage"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validateRetention 检查频道保留策略，nil 表示不设置
+func validateRetention(policy *models.RetentionPolicy) error {
+	if policy == nil {
+		return nil
+	}
+	if policy.MaxAgeDays < 0 {
+		return errors.New("max_age_days cannot be negative")
+	}
+	if policy.MaxMessages < 0 {
+		return errors.New("max_messages cannot be negative")
+	}
+	return nil
+}
+
+// SetChannelRetention 设置频道的保留策略，max_age_days 和 max_messages 都为 0 时取消策略
+func (h *SimpleAPIHandler) SetChannelRetention(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	channelID := c.Param("id")
+
+	var policy models.RetentionPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if err := validateRetention(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid retention policy",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	channel, err := userStorage.GetChannelByRef(channelID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Channel not found",
+			"error":   err.Error(),
+		})
+		return
+	}
+	channelID = channel.ID
+	if err := userStorage.SetChannelRetention(channelID, &policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to set channel retention",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	channel, err = userStorage.GetChannel(channelID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get channel",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Channel retention updated",
+		"data":    channel,
+	})
+}
+
+// GetRetentionReport 查看最近一轮保留策略的执行结果
+func (h *SimpleAPIHandler) GetRetentionReport(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"interval_minutes": h.config.Database.RetentionIntervalMinutes,
+			"last_run":         h.retentionWorker.LastReport(),
+		},
+	})
+}
+
+// RunRetention 立即对所有工作空间执行保留策略并压缩数据库，返回本轮结果
+func (h *SimpleAPIHandler) RunRetention(c *gin.Context) {
+	report := h.retentionWorker.Run()
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Retention completed",
+		"data":    report,
+	})
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"miemie/internal/auth"
+	"miemie/internal/delivery"
+	"miemie/internal/middleware"
+	"miemie/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// deliverAt 解析消息的定时投递时间，返回零值表示立即投递
+// deliver_at 已经过去时也立即投递
+func (h *SimpleAPIHandler) deliverAt(req *models.CreateMessageRequest) (time.Time, error) {
+	if req.DeliverAt != nil && req.DelaySeconds != 0 {
+		return time.Time{}, errors.New("deliver_at and delay_seconds cannot both be set")
+	}
+	if req.DelaySeconds < 0 {
+		return time.Time{}, errors.New("delay_seconds cannot be negative")
+	}
+
+	now := time.Now()
+	var at time.Time
+	switch {
+	case req.DeliverAt != nil:
+		at = *req.DeliverAt
+	case req.DelaySeconds > 0:
+		at = now.Add(time.Duration(req.DelaySeconds) * time.Second)
+	}
+	if !at.After(now) {
+		return time.Time{}, nil
+	}
+
+	if maxDelay := h.config.Delivery.Schedule.GetMaxDelay(); at.Sub(now) > maxDelay {
+		return time.Time{}, fmt.Errorf("delivery time more than %d days ahead", h.config.Delivery.Schedule.MaxDelayDays)
+	}
+	if !h.deliverySystem.SchedulingEnabled() {
+		return time.Time{}, delivery.ErrSchedulingDisabled
+	}
+	return at.UTC(), nil
+}
+
+// expiresAt 解析消息的过期时间，返回 nil 表示不过期
+// ttl_seconds 从投递时间（定时消息为计划投递时间）开始计算
+func expiresAt(req *models.CreateMessageRequest, deliverAt time.Time) (*time.Time, error) {
+	if req.ExpiresAt != nil && req.TTLSeconds != 0 {
+		return nil, errors.New("expires_at and ttl_seconds cannot both be set")
+	}
+	if req.TTLSeconds < 0 {
+		return nil, errors.New("ttl_seconds cannot be negative")
+	}
+
+	start := deliverAt
+	if start.IsZero() {
+		start = time.Now()
+	}
+
+	var at time.Time
+	switch {
+	case req.ExpiresAt != nil:
+		at = *req.ExpiresAt
+	case req.TTLSeconds > 0:
+		at = start.Add(time.Duration(req.TTLSeconds) * time.Second)
+	default:
+		return nil, nil
+	}
+	if !at.After(start) {
+		return nil, errors.New("message would expire before it is delivered")
+	}
+
+	at = at.UTC()
+	return &at, nil
+}
+
+// ListScheduledMessages 列出当前用户等待投递的定时消息
+func (h *SimpleAPIHandler) ListScheduledMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	messages, total, err := h.deliverySystem.ListScheduled(userID, limit, offset)
+	if err != nil {
+		respondScheduleError(c, err, "Failed to list scheduled messages")
+		return
+	}
+	if messages == nil {
+		messages = []*delivery.ScheduledMessage{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"scheduled": messages,
+			"total":     total,
+			"limit":     limit,
+			"offset":    offset,
+		},
+	})
+}
+
+// CancelScheduledMessage 取消当前用户还未投递的定时消息
+func (h *SimpleAPIHandler) CancelScheduledMessage(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	messageID := c.Param("id")
+
+	cancelled, err := h.deliverySystem.CancelScheduled(userID, messageID)
+	if err != nil {
+		respondScheduleError(c, err, "Failed to cancel scheduled message")
+		return
+	}
+
+	// 归还提交当天预占的接收者配额，提交已经是前一天时用量已重置，不需要归还
+	h.releaseRecipients(auth.MessageUsageDay(cancelled.ScheduledAt), cancelled.Recipients)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "Scheduled message cancelled",
+		"data": gin.H{
+			"message_id": messageID,
+		},
+	})
+}
+
+// respondScheduleError 将定时投递相关错误映射为HTTP响应
+func respondScheduleError(c *gin.Context, err error, message string) {
+	switch err {
+	case delivery.ErrScheduledNotFound:
+		c.JSON(http.StatusNotFound, gin.H{
+			"code":    404,
+			"message": "Scheduled message not found",
+		})
+	case delivery.ErrSchedulingDisabled:
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    503,
+			"message": "Scheduled delivery not enabled",
+			"error":   err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": message,
+			"error":   err.Error(),
+		})
+	}
+}
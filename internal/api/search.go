@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"miemie/internal/middleware"
+	"miemie/internal/models"
+	"miemie/internal/storage"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchMessages 全文搜索当前用户的消息
+func (h *SimpleAPIHandler) SearchMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	query, err := parseSearchQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid search parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// 获取用户工作空间
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	if query.ChannelID != "" {
+		channelIDs, ok := resolveChannelRefs(c, userStorage, []string{query.ChannelID})
+		if !ok {
+			return
+		}
+		query.ChannelID = channelIDs[0]
+	}
+	results, err := userStorage.SearchMessages(query)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidSearchQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid search query",
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to search messages",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"query":  query.Query,
+			"mode":   results.Mode,
+			"total":  results.Total,
+			"hits":   results.Hits,
+			"limit":  query.Limit,
+			"offset": query.Offset,
+		},
+	})
+}
+
+// parseSearchQuery 解析搜索参数
+func parseSearchQuery(c *gin.Context) (*models.SearchQuery, error) {
+	query := &models.SearchQuery{
+		Query:       c.Query("q"),
+		ChannelID:   c.Query("channel_id"),
+		Sender:      c.Query("sender"),
+		MessageType: c.Query("message_type"),
+		Sort:        c.DefaultQuery("sort", "relevance"),
+	}
+
+	if query.Query == "" {
+		return nil, fmt.Errorf("q is required")
+	}
+	if query.Sort != "relevance" && query.Sort != "newest" {
+		return nil, fmt.Errorf("sort must be relevance or newest")
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+	query.Limit = limit
+	query.Offset = offset
+
+	if query.MinPriority, err = parseOptionalInt(c, "priority_min"); err != nil {
+		return nil, err
+	}
+	if query.MaxPriority, err = parseOptionalInt(c, "priority_max"); err != nil {
+		return nil, err
+	}
+	if query.MinPriority > 0 && query.MaxPriority > 0 && query.MinPriority > query.MaxPriority {
+		return nil, fmt.Errorf("priority_min must not exceed priority_max")
+	}
+
+	if query.Since, err = parseOptionalTime(c, "since"); err != nil {
+		return nil, err
+	}
+	if query.Until, err = parseOptionalTime(c, "until"); err != nil {
+		return nil, err
+	}
+
+	return query, nil
+}
+
+// parseOptionalInt 解析可选的正整数参数，未提供时返回 0
+func parseOptionalInt(c *gin.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	return n, nil
+}
+
+// parseOptionalTime 解析可选的 RFC3339 时间参数
+func parseOptionalTime(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be RFC3339: %v", name, err)
+	}
+	return &t, nil
+}
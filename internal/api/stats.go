@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"miemie/internal/middleware"
+	"miemie/internal/storage"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxStatsRangeDays 统计历史最多查询的天数
+const maxStatsRangeDays = 731
+
+// parseStatsRange 解析 bucket、from、to 参数
+// 未指定 from 时按 bucket 默认查询最近 30 天、12 周或 12 个月，to 默认为今天（UTC）
+func parseStatsRange(c *gin.Context) (string, time.Time, time.Time, error) {
+	bucket := c.DefaultQuery("bucket", storage.StatsBucketDay)
+	switch bucket {
+	case storage.StatsBucketDay, storage.StatsBucketWeek, storage.StatsBucketMonth:
+	default:
+		return "", time.Time{}, time.Time{}, fmt.Errorf("bucket must be %s, %s or %s",
+			storage.StatsBucketDay, storage.StatsBucketWeek, storage.StatsBucketMonth)
+	}
+
+	parseDate := func(name string) (time.Time, error) {
+		t, err := time.Parse(storage.StatsDateLayout, c.Query(name))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s must be a date like 2006-01-02", name)
+		}
+		return t, nil
+	}
+
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if c.Query("to") != "" {
+		t, err := parseDate("to")
+		if err != nil {
+			return "", time.Time{}, time.Time{}, err
+		}
+		to = t
+	}
+
+	var from time.Time
+	if c.Query("from") != "" {
+		t, err := parseDate("from")
+		if err != nil {
+			return "", time.Time{}, time.Time{}, err
+		}
+		from = t
+	} else {
+		switch bucket {
+		case storage.StatsBucketWeek:
+			from = to.AddDate(0, 0, -7*11)
+		case storage.StatsBucketMonth:
+			from = to.AddDate(0, -11, 0)
+		default:
+			from = to.AddDate(0, 0, -29)
+		}
+	}
+
+	if from.After(to) {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) > maxStatsRangeDays*24*time.Hour {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("range cannot exceed %d days", maxStatsRangeDays)
+	}
+	return bucket, from, to, nil
+}
+
+// GetUserStatsHistory 按天、周或月查看各频道和各优先级收到与已读的消息数
+func (h *SimpleAPIHandler) GetUserStatsHistory(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	bucket, from, to, err := parseStatsRange(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid request parameters",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	history, err := userStorage.GetStatsHistory(bucket, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to get stats history",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data":    history,
+	})
+}
@@ -0,0 +1,296 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"miemie/internal/logger"
+	"miemie/internal/middleware"
+	"miemie/internal/models"
+	"miemie/internal/storage"
+	"miemie/internal/websocket"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	sseKeepAliveInterval = 15 * time.Second
+	sseRetryMillis       = 3000
+	streamReplayPageSize = 200
+
+	defaultPollTimeout = 30 * time.Second
+	maxPollTimeout     = 60 * time.Second
+)
+
+// StreamMessages SSE 推送：事件 id 为消息序号，重连时通过 Last-Event-ID 头（或 last_event_id 参数）
+// 先补发断线期间的消息再切换到实时推送。channel_id 可重复指定以只接收部分频道。
+func (h *SimpleAPIHandler) StreamMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	channels := c.QueryArray("channel_id")
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	var lastSeq int64
+	if lastEventID != "" {
+		seq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || seq < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Last-Event-ID must be a message seq",
+			})
+			return
+		}
+		lastSeq = seq
+	}
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+	userStorage := storage.NewUserMessageStorage(ws)
+	channels, ok := resolveChannelRefs(c, userStorage, channels)
+	if !ok {
+		return
+	}
+
+	// 先订阅再读取存储，重放与实时推送之间不会漏消息
+	sub, ok := h.subscribe(c, userID, channels)
+	if !ok {
+		return
+	}
+	defer h.wsManager.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetryMillis)
+	w.Flush()
+
+	if lastEventID != "" {
+		for {
+			messages, err := userStorage.GetMessagesAfterSeq(lastSeq, streamReplayPageSize, channels...)
+			if err != nil {
+				logger.Warnf("SSE replay for user %s failed: %v", userID, err)
+				writeSSEEvent(w, "error", 0, gin.H{"error": err.Error()})
+				return
+			}
+			for _, message := range messages {
+				message.UserID = userID
+				if err := writeSSEEvent(w, "message", message.Seq, message); err != nil {
+					return
+				}
+				lastSeq = message.Seq
+			}
+			if len(messages) < streamReplayPageSize {
+				break
+			}
+		}
+	}
+	w.Flush()
+
+	ticker := time.NewTicker(sseKeepAliveInterval)
+	defer ticker.Stop()
+
+	ctx := c.Request.Context()
+	for {
+		select {
+		case message, ok := <-sub.C:
+			if !ok {
+				// 服务关闭或推送积压，客户端会带着 Last-Event-ID 重连
+				return
+			}
+			if message.Seq > 0 && message.Seq <= lastSeq {
+				continue
+			}
+			if err := writeSSEEvent(w, message.EventType(), message.Seq, message); err != nil {
+				return
+			}
+			if message.Seq > 0 {
+				lastSeq = message.Seq
+			}
+			w.Flush()
+
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			w.Flush()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// PollMessages 长轮询：返回序号 since 之后的消息，没有新消息时阻塞到有消息或超时
+// 省略 since 时只等待之后到达的新消息；响应中的 last_seq 作为下次请求的 since。
+func (h *SimpleAPIHandler) PollMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	channels := c.QueryArray("channel_id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	timeout := defaultPollTimeout
+	if timeoutStr := c.Query("timeout"); timeoutStr != "" {
+		seconds, err := strconv.Atoi(timeoutStr)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "timeout must be a non-negative number of seconds",
+			})
+			return
+		}
+		timeout = time.Duration(seconds) * time.Second
+		if timeout > maxPollTimeout {
+			timeout = maxPollTimeout
+		}
+	}
+
+	var since int64
+	sinceStr := c.Query("since")
+	if sinceStr != "" {
+		since, err = strconv.ParseInt(sinceStr, 10, 64)
+		if err != nil || since < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "since must be a message seq",
+			})
+			return
+		}
+	}
+
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+	userStorage := storage.NewUserMessageStorage(ws)
+	channels, ok := resolveChannelRefs(c, userStorage, channels)
+	if !ok {
+		return
+	}
+
+	if sinceStr == "" {
+		if since, err = userStorage.GetLatestSeq(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to poll messages",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	// 先订阅再查询，查询之后到达的消息会唤醒等待
+	sub, ok := h.subscribe(c, userID, channels)
+	if !ok {
+		return
+	}
+	defer h.wsManager.Unsubscribe(sub)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	stop := false
+	var messages []*models.Message
+	for {
+		// 多取一条用于判断是否还有更多
+		messages, err = userStorage.GetMessagesAfterSeq(since, limit+1, channels...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "Failed to poll messages",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if len(messages) > 0 || stop {
+			break
+		}
+
+		select {
+		case _, ok := <-sub.C:
+			if !ok {
+				// 订阅已关闭，返回当前结果
+				stop = true
+			}
+		case <-timer.C:
+			stop = true
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	lastSeq := since
+	for _, message := range messages {
+		message.UserID = userID
+		lastSeq = message.Seq
+	}
+	if messages == nil {
+		messages = []*models.Message{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"messages":  messages,
+			"last_seq":  lastSeq,
+			"has_more":  hasMore,
+			"timed_out": len(messages) == 0,
+		},
+	})
+}
+
+// subscribe 创建推送订阅，失败时写入错误响应
+func (h *SimpleAPIHandler) subscribe(c *gin.Context, userID string, channels []string) (*websocket.Subscription, bool) {
+	sub, err := h.wsManager.Subscribe(userID, channels)
+	switch err {
+	case nil:
+		return sub, true
+	case websocket.ErrTooManySubscriptions:
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"code":    429,
+			"message": "Too many streaming connections",
+		})
+	default:
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    503,
+			"message": "Streaming service is shutting down",
+			"error":   err.Error(),
+		})
+	}
+	return nil, false
+}
+
+// writeSSEEvent 写入一个 SSE 事件，seq 为 0 时不设置事件 id
+func writeSSEEvent(w gin.ResponseWriter, event string, seq int64, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", seq); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"miemie/internal/logger"
+	"miemie/internal/middleware"
+	"miemie/internal/storage"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SyncMessages 增量同步：返回同步位置之后的新消息、已读状态变更和阅读位置变更
+// since 为上次响应中的 sync_token；提供 device_id 时，since 同时作为该设备已确认的检查点
+// 保存到工作空间 .sync 目录，下次省略 since 时从检查点继续。
+func (h *SimpleAPIHandler) SyncMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	since := c.Query("since")
+	deviceID := c.Query("device_id")
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	// 获取用户工作空间
+	ws, err := h.workspaceManager.GetUserWorkspace(userID)
+	if err != nil {
+		workspaceError(c, err)
+		return
+	}
+
+	if since == "" && deviceID != "" {
+		checkpoint, err := ws.LoadSyncCheckpoint(deviceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Failed to load sync checkpoint",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if checkpoint != nil {
+			since = checkpoint.Token
+		}
+	}
+
+	var token *storage.SyncToken
+	if since != "" {
+		token, err = storage.DecodeSyncToken(since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Invalid sync token",
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	userStorage := storage.NewUserMessageStorage(ws)
+	changes, err := userStorage.GetChangesSince(token, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to sync messages",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// 客户端带着 since 请求，说明之前的数据已处理完毕
+	if deviceID != "" && since != "" {
+		if err := ws.SaveSyncCheckpoint(deviceID, since); err != nil {
+			logger.Warnf("Failed to save sync checkpoint for user %s device %s: %v", userID, deviceID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "success",
+		"data": gin.H{
+			"messages":         changes.Messages,
+			"read_changes":     changes.ReadChanges,
+			"position_changes": changes.PositionChanges,
+			"has_more":         changes.HasMore,
+			"sync_token":       storage.EncodeSyncToken(changes.Token),
+		},
+	})
+}
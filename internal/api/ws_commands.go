@@ -0,0 +1,191 @@
+package api
+
+import (
+	"miemie/internal/models"
+	"miemie/internal/storage"
+	"miemie/internal/websocket"
+	"miemie/internal/workspace"
+
+	"github.com/gin-gonic/gin"
+)
+
+// wsCommandHandler 处理WebSocket客户端发送的需要访问用户数据的命令，并提供断线重放数据
+type wsCommandHandler struct {
+	h *SimpleAPIHandler
+}
+
+// MarkRead 标记消息已读，read_device 记录发起命令的设备
+func (wh *wsCommandHandler) MarkRead(userID, deviceID string, messageIDs []string) (interface{}, error) {
+	userStorage, err := wh.userStorage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, missing, err := splitExisting(userStorage, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := userStorage.MarkMultipleAsRead(existing, deviceID); err != nil {
+		return nil, websocket.NewCommandError(500, "failed to mark as read: %v", err)
+	}
+
+	return gin.H{
+		"marked":    existing,
+		"not_found": missing,
+	}, nil
+}
+
+// Ack 确认收到消息，更新投递回执
+func (wh *wsCommandHandler) Ack(userID, deviceID string, messageIDs []string) (interface{}, error) {
+	if wh.h.deliverySystem == nil {
+		return nil, websocket.NewCommandError(503, "delivery system not available")
+	}
+
+	if err := wh.h.deliverySystem.AckDelivery(userID, deviceID, messageIDs); err != nil {
+		return nil, websocket.NewCommandError(500, "failed to ack delivery: %v", err)
+	}
+
+	return gin.H{"acked": messageIDs}, nil
+}
+
+// History 按游标分页获取频道历史消息
+func (wh *wsCommandHandler) History(userID string, req *websocket.HistoryRequest) (interface{}, error) {
+	channelID := req.ChannelID
+	if channelID == "" {
+		channelID = "default"
+	}
+
+	direction := req.Direction
+	if direction == "" {
+		direction = storage.DirectionOlder
+	}
+	if direction != storage.DirectionOlder && direction != storage.DirectionNewer {
+		return nil, websocket.NewCommandError(400, "direction must be older or newer")
+	}
+
+	limit := req.Limit
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	var cursor *storage.MessageCursor
+	if req.Cursor != "" {
+		var err error
+		cursor, err = storage.DecodeCursor(req.Cursor)
+		if err != nil {
+			return nil, websocket.NewCommandError(400, "invalid cursor")
+		}
+	}
+
+	userStorage, err := wh.userStorage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if channelID, err = userStorage.ChannelIDOf(channelID); err != nil {
+		return nil, websocket.NewCommandError(500, "failed to get channel: %v", err)
+	}
+
+	messages, hasMore, err := userStorage.GetMessagesPage(channelID, cursor, direction, limit, nil)
+	if err != nil {
+		return nil, websocket.NewCommandError(500, "failed to get messages: %v", err)
+	}
+
+	data := cursorPageData(messages, hasMore, req.Cursor)
+	data["channel_id"] = channelID
+	data["limit"] = limit
+	data["direction"] = direction
+	return data, nil
+}
+
+// ResolveChannels 把订阅命令中的频道ID或标识解析为频道ID
+func (wh *wsCommandHandler) ResolveChannels(userID string, refs []string) ([]string, error) {
+	userStorage, err := wh.userStorage(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		if ref == websocket.AllChannels {
+			ids = append(ids, ref)
+			continue
+		}
+		id, err := userStorage.ChannelIDOf(ref)
+		if err != nil {
+			return nil, websocket.NewCommandError(500, "failed to get channel: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// MessagesAfterSeq 获取序号之后的消息，用于WebSocket断线重放
+func (wh *wsCommandHandler) MessagesAfterSeq(userID string, afterSeq int64, limit int) ([]*models.Message, error) {
+	userStorage, err := wh.userStorage(userID)
+	if err != nil {
+		return nil, err
+	}
+	return userStorage.GetMessagesAfterSeq(afterSeq, limit)
+}
+
+// MessageSeq 获取消息序号
+func (wh *wsCommandHandler) MessageSeq(userID, messageID string) (int64, error) {
+	userStorage, err := wh.userStorage(userID)
+	if err != nil {
+		return 0, err
+	}
+	return userStorage.GetMessageSeq(messageID)
+}
+
+// userStorage 获取用户的消息存储
+func (wh *wsCommandHandler) userStorage(userID string) (*storage.UserMessageStorage, error) {
+	ws, err := wh.h.workspaceManager.GetUserWorkspace(userID)
+	if err == workspace.ErrWorkspaceLimit {
+		return nil, websocket.NewCommandError(503, "workspace limit reached")
+	}
+	if err != nil {
+		return nil, websocket.NewCommandError(500, "failed to get user workspace: %v", err)
+	}
+	return storage.NewUserMessageStorage(ws), nil
+}
+
+// splitExisting 将消息ID分为存在和不存在两组
+func splitExisting(userStorage *storage.UserMessageStorage, messageIDs []string) ([]string, []string, error) {
+	existing := []string{}
+	missing := []string{}
+	for _, messageID := range messageIDs {
+		exists, err := userStorage.MessageExists(messageID)
+		if err != nil {
+			return nil, nil, websocket.NewCommandError(500, "%v", err)
+		}
+		if exists {
+			existing = append(existing, messageID)
+		} else {
+			missing = append(missing, messageID)
+		}
+	}
+	return existing, missing, nil
+}
+
+// cursorPageData 构造游标分页响应：next_cursor 继续向更早翻页，prev_cursor 向更新翻页
+func cursorPageData(messages []*models.Message, hasMore bool, requestCursor string) gin.H {
+	if messages == nil {
+		messages = []*models.Message{}
+	}
+
+	data := gin.H{
+		"messages": messages,
+		"has_more": hasMore,
+	}
+	if len(messages) > 0 {
+		data["next_cursor"] = storage.EncodeCursor(storage.CursorOf(messages[len(messages)-1]))
+		data["prev_cursor"] = storage.EncodeCursor(storage.CursorOf(messages[0]))
+	} else if requestCursor != "" {
+		// 空页时保留原游标，客户端可以稍后用它继续拉取
+		data["next_cursor"] = requestCursor
+		data["prev_cursor"] = requestCursor
+	}
+	return data
+}
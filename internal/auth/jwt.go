@@ -0,0 +1,377 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"miemie/internal/config"
+	"miemie/internal/logger"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minKeyReload 遇到未知 kid 时两次重新加载 JWKS 的最小间隔，防止伪造令牌触发频繁请求
+const minKeyReload = 30 * time.Second
+
+// ErrInvalidToken 令牌无效（签名、格式或声明校验失败）
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTVerifier 使用 JWKS 验证身份提供方签发的 JWT
+// JWKS 按 refresh_interval_minutes 定期重新加载，遇到未知 kid 时立即重新加载以支持密钥轮换。
+type JWTVerifier struct {
+	cfg    config.JWTConfig
+	source string
+	client *http.Client
+
+	mu       sync.RWMutex
+	keys     []*verificationKey
+	loadedAt time.Time
+	reloadMu sync.Mutex
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewJWTVerifier 创建验证器并加载 JWKS，加载失败时返回错误
+func NewJWTVerifier(cfg config.JWTConfig) (*JWTVerifier, error) {
+	source := cfg.JWKSFile
+	if cfg.JWKSURL != "" {
+		source = cfg.JWKSURL
+	}
+	if source == "" {
+		return nil, fmt.Errorf("jwks_file or jwks_url is required")
+	}
+
+	v := &JWTVerifier{
+		cfg:    cfg,
+		source: source,
+		client: newJWKSClient(),
+		stop:   make(chan struct{}),
+	}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+
+	go v.refreshLoop()
+	return v, nil
+}
+
+// Close 停止定期刷新
+func (v *JWTVerifier) Close() {
+	v.closeOnce.Do(func() {
+		close(v.stop)
+	})
+}
+
+// Reload 重新加载 JWKS，失败时保留原有密钥
+func (v *JWTVerifier) Reload() error {
+	v.reloadMu.Lock()
+	defer v.reloadMu.Unlock()
+
+	keys, err := loadJWKS(v.source, v.client)
+	if err != nil {
+		return fmt.Errorf("failed to load jwks from %s: %w", v.source, err)
+	}
+
+	v.mu.Lock()
+	v.keys = keys
+	v.loadedAt = time.Now()
+	v.mu.Unlock()
+	return nil
+}
+
+// refreshLoop 定期重新加载 JWKS
+func (v *JWTVerifier) refreshLoop() {
+	ticker := time.NewTicker(v.cfg.GetRefreshInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := v.Reload(); err != nil {
+				logger.Warnf("JWT: %v", err)
+			}
+		case <-v.stop:
+			return
+		}
+	}
+}
+
+// jwtHeader JWT 头部
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify 验证令牌签名和声明，返回令牌对应的主体
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: invalid header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature encoding", ErrInvalidToken)
+	}
+
+	if err := v.verifySignature(&header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]interface{})
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: invalid claims", ErrInvalidToken)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return nil, err
+	}
+
+	userID, ok := lookupClaim(claims, v.cfg.UserClaim).(string)
+	if !ok || userID == "" {
+		return nil, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, v.cfg.UserClaim)
+	}
+	// 发送者以 sender: 前缀出现在用户ID位置，令牌不能冒充发送者
+	if strings.HasPrefix(userID, SenderPrefix) {
+		return nil, fmt.Errorf("%w: %s claim cannot use the %s prefix", ErrInvalidToken, v.cfg.UserClaim, SenderPrefix)
+	}
+
+	return &Principal{
+		Type:   PrincipalToken,
+		ID:     userID,
+		Scopes: v.scopesFromClaims(claims),
+	}, nil
+}
+
+// verifySignature 使用匹配的公钥验证签名，找不到 kid 时重新加载一次 JWKS
+func (v *JWTVerifier) verifySignature(header *jwtHeader, signed, signature []byte) error {
+	hash, ok := signingHash(header.Alg)
+	if !ok {
+		return fmt.Errorf("%w: unsupported alg %q", ErrInvalidToken, header.Alg)
+	}
+
+	candidates := v.candidateKeys(header)
+	if len(candidates) == 0 && header.Kid != "" {
+		v.mu.RLock()
+		stale := time.Since(v.loadedAt) >= minKeyReload
+		v.mu.RUnlock()
+		if stale {
+			if err := v.Reload(); err != nil {
+				logger.Warnf("JWT: %v", err)
+			}
+			candidates = v.candidateKeys(header)
+		}
+	}
+	if len(candidates) == 0 {
+		return fmt.Errorf("%w: unknown key id %q", ErrInvalidToken, header.Kid)
+	}
+
+	for _, key := range candidates {
+		if verifyWithKey(header.Alg, hash, key.Public, signed, signature) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+}
+
+// candidateKeys 按 kid 和算法筛选公钥，令牌没有 kid 时尝试全部公钥
+func (v *JWTVerifier) candidateKeys(header *jwtHeader) []*verificationKey {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	var candidates []*verificationKey
+	for _, key := range v.keys {
+		if header.Kid != "" && key.ID != header.Kid {
+			continue
+		}
+		if key.Alg != "" && key.Alg != header.Alg {
+			continue
+		}
+		candidates = append(candidates, key)
+	}
+	return candidates
+}
+
+// validateClaims 检查 exp、nbf、iss、aud
+func (v *JWTVerifier) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	leeway := v.cfg.GetLeeway()
+
+	exp, ok := numericClaim(claims, "exp")
+	if !ok {
+		return fmt.Errorf("%w: missing exp claim", ErrInvalidToken)
+	}
+	if now.After(time.Unix(exp, 0).Add(leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidToken)
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(leeway).Before(time.Unix(nbf, 0)) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidToken)
+	}
+
+	if v.cfg.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+			return fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+		}
+	}
+
+	if v.cfg.Audience != "" && !audienceContains(claims["aud"], v.cfg.Audience) {
+		return fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+// scopesFromClaims 从权限声明中取出本系统的权限范围，没有时使用默认权限
+// 声明可以是空格分隔的字符串（OAuth2 scope）或字符串数组
+func (v *JWTVerifier) scopesFromClaims(claims map[string]interface{}) []string {
+	var values []string
+	switch raw := lookupClaim(claims, v.cfg.ScopeClaim).(type) {
+	case string:
+		values = strings.Fields(raw)
+	case []interface{}:
+		for _, item := range raw {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var scopes []string
+	for _, value := range values {
+		if contains(AllScopes, value) && !contains(scopes, value) {
+			scopes = append(scopes, value)
+		}
+	}
+	if len(scopes) == 0 {
+		return v.cfg.DefaultScopes
+	}
+	return scopes
+}
+
+// IsJWT 判断凭证是否具有 JWT 的三段结构
+func IsJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2
+}
+
+// signingHash 算法对应的哈希函数，不支持 none 和 HMAC
+func signingHash(alg string) (crypto.Hash, bool) {
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		return crypto.SHA256, true
+	case "RS384", "PS384", "ES384":
+		return crypto.SHA384, true
+	case "RS512", "PS512", "ES512":
+		return crypto.SHA512, true
+	case "EdDSA":
+		return 0, true
+	}
+	return 0, false
+}
+
+// verifyWithKey 使用单个公钥验证签名
+func verifyWithKey(alg string, hash crypto.Hash, public crypto.PublicKey, signed, signature []byte) bool {
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	switch key := public.(type) {
+	case *rsa.PublicKey:
+		switch alg[:2] {
+		case "RS":
+			return rsa.VerifyPKCS1v15(key, hash, digest, signature) == nil
+		case "PS":
+			return rsa.VerifyPSS(key, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+
+	case *ecdsa.PublicKey:
+		if alg[:2] != "ES" {
+			return false
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, digest, r, s)
+
+	case ed25519.PublicKey:
+		return alg == "EdDSA" && ed25519.Verify(key, signed, signature)
+	}
+
+	return false
+}
+
+// decodeSegment 解码 base64url 编码的 JSON 段，数字保留为 json.Number
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// lookupClaim 按点分路径获取声明，如 "ext.user_id"
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	if value, ok := claims[path]; ok {
+		return value
+	}
+
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
+
+// numericClaim 获取数值型时间声明
+func numericClaim(claims map[string]interface{}, name string) (int64, bool) {
+	number, ok := claims[name].(json.Number)
+	if !ok {
+		return 0, false
+	}
+	value, err := number.Float64()
+	if err != nil {
+		return 0, false
+	}
+	return int64(value), true
+}
+
+// audienceContains aud 可以是字符串或字符串数组
+func audienceContains(aud interface{}, expected string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == expected
+	case []interface{}:
+		for _, item := range value {
+			if s, ok := item.(string); ok && s == expected {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"miemie/internal/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://idp.example.com"
+	testAudience = "miemie"
+)
+
+// testKeys 测试用的本地密钥
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	return &testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"use": "sig",
+		"n":   b64(key.N.Bytes()),
+		"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{
+		"kty": "EC",
+		"kid": kid,
+		"crv": "P-256",
+		"alg": "ES256",
+		"x":   b64(key.X.FillBytes(make([]byte, 32))),
+		"y":   b64(key.Y.FillBytes(make([]byte, 32))),
+	}
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatalf("encode jwks: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write jwks: %v", err)
+	}
+}
+
+func newTestVerifier(t *testing.T, keys *testKeys) (*JWTVerifier, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("rsa-1", &keys.rsa.PublicKey), ecJWK("ec-1", &keys.ec.PublicKey))
+
+	v, err := NewJWTVerifier(config.JWTConfig{
+		Enabled:                true,
+		JWKSFile:               path,
+		RefreshIntervalMinutes: 60,
+		Issuer:                 testIssuer,
+		Audience:               testAudience,
+		UserClaim:              "sub",
+		ScopeClaim:             "scope",
+		DefaultScopes:          []string{ScopeRead},
+	})
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	t.Cleanup(v.Close)
+	return v, path
+}
+
+func validClaims() map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"sub":   "alice",
+		"iss":   testIssuer,
+		"aud":   []string{"other", testAudience},
+		"exp":   now.Add(time.Hour).Unix(),
+		"nbf":   now.Add(-time.Minute).Unix(),
+		"scope": "send read openid",
+	}
+}
+
+// signToken 生成令牌，key 为 *rsa.PrivateKey、*ecdsa.PrivateKey、[]byte（HMAC）或 nil（alg=none）
+func signToken(t *testing.T, alg, kid string, key interface{}, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err := rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("sign rsa: %v", err)
+		}
+		signature = sig
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatalf("sign ec: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	}
+	return signed + "." + b64(signature)
+}
+
+func expectInvalid(t *testing.T, v *JWTVerifier, token, reason string) {
+	t.Helper()
+	principal, err := v.Verify(token)
+	if err == nil {
+		t.Fatalf("Verify accepted token (%s) for %s", reason, principal.ID)
+	}
+	if !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Verify error = %v, want ErrInvalidToken", err)
+	}
+	if !strings.Contains(err.Error(), reason) {
+		t.Fatalf("Verify error = %v, want it to mention %q", err, reason)
+	}
+}
+
+func TestVerifyValidToken(t *testing.T) {
+	keys := newTestKeys(t)
+	v, _ := newTestVerifier(t, keys)
+
+	for _, tc := range []struct {
+		alg, kid string
+		key      interface{}
+	}{
+		{"RS256", "rsa-1", keys.rsa},
+		{"ES256", "ec-1", keys.ec},
+		{"RS256", "", keys.rsa}, // 没有 kid 时尝试全部公钥
+	} {
+		principal, err := v.Verify(signToken(t, tc.alg, tc.kid, tc.key, validClaims()))
+		if err != nil {
+			t.Fatalf("%s/%q: Verify: %v", tc.alg, tc.kid, err)
+		}
+		if principal.Type != PrincipalToken || principal.ID != "alice" {
+			t.Fatalf("%s: principal = %+v, want token principal alice", tc.alg, principal)
+		}
+		if len(principal.Scopes) != 2 || !principal.HasScope(ScopeSend) || !principal.HasScope(ScopeRead) {
+			t.Fatalf("%s: scopes = %v, want [send read]", tc.alg, principal.Scopes)
+		}
+	}
+
+	claims := validClaims()
+	delete(claims, "scope")
+	principal, err := v.Verify(signToken(t, "RS256", "rsa-1", keys.rsa, claims))
+	if err != nil {
+		t.Fatalf("Verify without scope: %v", err)
+	}
+	if len(principal.Scopes) != 1 || principal.Scopes[0] != ScopeRead {
+		t.Fatalf("scopes = %v, want default scopes", principal.Scopes)
+	}
+}
+
+func TestVerifyRejectsTimeClaims(t *testing.T) {
+	keys := newTestKeys(t)
+	v, _ := newTestVerifier(t, keys)
+
+	claims := validClaims()
+	claims["exp"] = time.Now().Add(-time.Minute).Unix()
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "expired")
+
+	claims = validClaims()
+	claims["nbf"] = time.Now().Add(time.Hour).Unix()
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "not yet valid")
+
+	claims = validClaims()
+	delete(claims, "exp")
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "missing exp")
+}
+
+func TestVerifyRejectsIssuerAndAudience(t *testing.T) {
+	keys := newTestKeys(t)
+	v, _ := newTestVerifier(t, keys)
+
+	claims := validClaims()
+	claims["iss"] = "https://evil.example.com"
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "issuer")
+
+	claims = validClaims()
+	claims["aud"] = "someone-else"
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "audience")
+
+	claims = validClaims()
+	delete(claims, "aud")
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "audience")
+}
+
+func TestVerifyRejectsAlgorithmMismatch(t *testing.T) {
+	keys := newTestKeys(t)
+	v, _ := newTestVerifier(t, keys)
+
+	// 用 RSA 公钥作为 HMAC 密钥伪造签名
+	publicBytes := keys.rsa.PublicKey.N.Bytes()
+	expectInvalid(t, v, signToken(t, "HS256", "rsa-1", publicBytes, validClaims()), "unsupported alg")
+
+	// alg=none 且没有签名
+	expectInvalid(t, v, signToken(t, "none", "rsa-1", nil, validClaims()), "unsupported alg")
+
+	// RSA 的 kid 配 ES256：用 EC 私钥签名也不能通过 RSA 公钥验证
+	expectInvalid(t, v, signToken(t, "ES256", "rsa-1", keys.ec, validClaims()), "signature verification failed")
+
+	// EC 公钥在 JWKS 中声明了 ES256，RS256 令牌找不到可用的公钥
+	expectInvalid(t, v, signToken(t, "RS256", "ec-1", keys.rsa, validClaims()), "unknown key id")
+
+	// 签名被篡改
+	token := signToken(t, "RS256", "rsa-1", keys.rsa, validClaims())
+	tampered := signToken(t, "RS256", "rsa-1", keys.rsa, map[string]interface{}{"sub": "mallory"})
+	parts := strings.Split(token, ".")
+	forged := strings.Split(tampered, ".")[0] + "." + strings.Split(tampered, ".")[1] + "." + parts[2]
+	expectInvalid(t, v, forged, "signature verification failed")
+}
+
+func TestVerifyReloadsUnknownKeyID(t *testing.T) {
+	keys := newTestKeys(t)
+	v, path := newTestVerifier(t, keys)
+
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	writeJWKS(t, path, rsaJWK("rsa-1", &keys.rsa.PublicKey), rsaJWK("rsa-2", &rotated.PublicKey))
+	token := signToken(t, "RS256", "rsa-2", rotated, validClaims())
+
+	// 刚加载过 JWKS，未知 kid 不会立即触发重新加载
+	expectInvalid(t, v, token, "unknown key id")
+
+	v.mu.Lock()
+	v.loadedAt = time.Now().Add(-minKeyReload)
+	v.mu.Unlock()
+
+	principal, err := v.Verify(token)
+	if err != nil {
+		t.Fatalf("Verify after key rotation: %v", err)
+	}
+	if principal.ID != "alice" {
+		t.Fatalf("principal = %s, want alice", principal.ID)
+	}
+}
+
+func TestVerifyRequiresUserClaim(t *testing.T) {
+	keys := newTestKeys(t)
+	v, _ := newTestVerifier(t, keys)
+
+	claims := validClaims()
+	delete(claims, "sub")
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "missing sub claim")
+
+	claims = validClaims()
+	claims["sub"] = ""
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "missing sub claim")
+
+	claims = validClaims()
+	claims["sub"] = SenderPrefix + "billing"
+	expectInvalid(t, v, signToken(t, "RS256", "rsa-1", keys.rsa, claims), "prefix")
+}
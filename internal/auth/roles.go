@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// 角色
+const (
+	RoleAdmin    = "admin"    // 管理员：全部管理权限
+	RoleOperator = "operator" // 运维：查看用户和工作空间、控制投递系统
+	RoleUser     = "user"     // 普通用户：没有管理权限（未分配角色的用户）
+	RoleSender   = "sender"   // 发送者服务账户，不能分配给用户
+)
+
+// 管理权限
+const (
+	PermUsersView         = "users:view"          // 查看用户列表和工作空间
+	PermWorkspaceEvict    = "workspaces:evict"    // 强制释放工作空间缓存
+	PermWorkspaceMaintain = "workspaces:maintain" // 立即执行保留策略和数据库压缩
+	PermDeliveryView      = "delivery:view"       // 查看投递统计和死信
+	PermDeliveryManage    = "delivery:manage"     // 暂停/恢复投递、重放和清理死信
+	PermSendersManage     = "senders:manage"      // 管理发送者账户及其密钥
+	PermSendersApprove    = "senders:approve"     // 审核发送者申请
+	PermKeysManage        = "keys:manage"         // 管理其他用户的密钥
+	PermRolesManage       = "roles:manage"        // 分配角色
+	PermMessagesFanout    = "messages:fanout"     // 向其他用户、用户组投递消息或广播
+)
+
+// AssignableRoles 可以分配给用户的角色
+var AssignableRoles = []string{RoleAdmin, RoleOperator, RoleUser}
+
+// RolePermissions 角色拥有的管理权限
+var RolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermUsersView, PermWorkspaceEvict, PermWorkspaceMaintain, PermDeliveryView, PermDeliveryManage,
+		PermSendersManage, PermSendersApprove, PermKeysManage, PermRolesManage, PermMessagesFanout,
+	},
+	RoleOperator: {
+		PermUsersView, PermWorkspaceEvict, PermWorkspaceMaintain, PermDeliveryView, PermDeliveryManage,
+		PermMessagesFanout,
+	},
+	RoleUser:   {},
+	RoleSender: {},
+}
+
+// RoleAssignment 用户的角色分配记录
+type RoleAssignment struct {
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	GrantedBy string    `json:"granted_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// RoleHasPermission 角色是否拥有权限
+func RoleHasPermission(role, permission string) bool {
+	return contains(RolePermissions[role], permission)
+}
+
+// GetRole 获取用户角色，未分配时为普通用户
+func (s *Store) GetRole(userID string) (string, error) {
+	var role string
+	err := s.db.QueryRow("SELECT role FROM user_roles WHERE user_id = ?", userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return RoleUser, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get role: %w", err)
+	}
+	return role, nil
+}
+
+// SetRole 分配用户角色，分配为普通用户时删除记录；不能撤销最后一个管理员
+func (s *Store) SetRole(userID, role, grantedBy string) error {
+	if !contains(AssignableRoles, role) {
+		return ErrInvalidRole
+	}
+
+	if role != RoleAdmin {
+		current, err := s.GetRole(userID)
+		if err != nil {
+			return err
+		}
+		if current == RoleAdmin {
+			count, err := s.countAdmins()
+			if err != nil {
+				return err
+			}
+			if count <= 1 {
+				return ErrLastAdmin
+			}
+		}
+	}
+
+	var err error
+	if role == RoleUser {
+		_, err = s.db.Exec("DELETE FROM user_roles WHERE user_id = ?", userID)
+	} else {
+		_, err = s.db.Exec(`
+			INSERT INTO user_roles (user_id, role, granted_by, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(user_id) DO UPDATE SET role = excluded.role,
+				granted_by = excluded.granted_by, updated_at = excluded.updated_at`,
+			userID, role, grantedBy, time.Now().UTC())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set role: %w", err)
+	}
+	return nil
+}
+
+// ListRoles 列出全部角色分配
+func (s *Store) ListRoles() ([]*RoleAssignment, error) {
+	rows, err := s.db.Query("SELECT user_id, role, granted_by, updated_at FROM user_roles ORDER BY user_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	assignments := []*RoleAssignment{}
+	for rows.Next() {
+		assignment := &RoleAssignment{}
+		var grantedBy sql.NullString
+		if err := rows.Scan(&assignment.UserID, &assignment.Role, &grantedBy, &assignment.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		assignment.GrantedBy = grantedBy.String
+		assignments = append(assignments, assignment)
+	}
+	return assignments, rows.Err()
+}
+
+// EnsureBootstrapAdmin 没有任何管理员时将用户设为管理员，返回是否新分配
+// 只在没有管理员时生效，之后管理员可以自由调整角色而不会在重启时被覆盖
+func (s *Store) EnsureBootstrapAdmin(userID string) (bool, error) {
+	count, err := s.countAdmins()
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	if err := s.SetRole(userID, RoleAdmin, "bootstrap"); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// countAdmins 统计管理员数量
+func (s *Store) countAdmins() (int, error) {
+	var count int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM user_roles WHERE role = ?", RoleAdmin).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return count, nil
+}
+
+// ResolveRole 设置主体的角色
+// 开发模式下信任的请求头主体视为管理员，发送者固定为 sender 角色
+func (s *Store) ResolveRole(principal *Principal) error {
+	switch principal.Type {
+	case PrincipalSender:
+		principal.Role = RoleSender
+	case PrincipalHeader:
+		principal.Role = RoleAdmin
+	default:
+		role, err := s.GetRole(principal.ID)
+		if err != nil {
+			return err
+		}
+		principal.Role = role
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// senderIDPattern 发送者ID只允许小写字母、数字和 . _ -
+var senderIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// senderStatuses 发送者的有效状态
+var senderStatuses = []string{SenderActive, SenderDisabled, SenderPending, SenderRejected}
+
+// ValidateSender 检查发送者字段，未指定ID时生成，未指定频道时允许全部频道
+func ValidateSender(sender *Sender) error {
+	if sender.ID == "" {
+		sender.ID = uuid.New().String()
+	}
+	if !senderIDPattern.MatchString(sender.ID) {
+		return fmt.Errorf("%w: id must match %s", ErrInvalidSender, senderIDPattern.String())
+	}
+	if strings.TrimSpace(sender.Name) == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidSender)
+	}
+	if sender.Status == "" {
+		sender.Status = SenderActive
+	}
+	if !contains(senderStatuses, sender.Status) {
+		return fmt.Errorf("%w: status must be one of %s", ErrInvalidSender, strings.Join(senderStatuses, ", "))
+	}
+	if len(sender.AllowedUsers) == 0 {
+		return fmt.Errorf("%w: allowed_users is required (use [\"*\"] for any user)", ErrInvalidSender)
+	}
+	if len(sender.AllowedChannels) == 0 {
+		sender.AllowedChannels = []string{Wildcard}
+	}
+	return nil
+}
+
+// CreateSender 创建发送者账户
+func (s *Store) CreateSender(sender *Sender) error {
+	if err := ValidateSender(sender); err != nil {
+		return err
+	}
+
+	allowedUsers, _ := json.Marshal(sender.AllowedUsers)
+	allowedChannels, _ := json.Marshal(sender.AllowedChannels)
+	now := time.Now().UTC()
+
+	_, err := s.db.Exec(`
+		INSERT INTO senders (id, name, description, owner, status, allowed_users, allowed_channels, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sender.ID, sender.Name, sender.Description, sender.Owner, sender.Status,
+		string(allowedUsers), string(allowedChannels), now, now)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
+			return ErrSenderExists
+		}
+		return fmt.Errorf("failed to create sender: %w", err)
+	}
+
+	sender.CreatedAt = now
+	sender.UpdatedAt = now
+	return nil
+}
+
+// GetSender 获取发送者账户
+func (s *Store) GetSender(id string) (*Sender, error) {
+	sender, err := scanSender(s.db.QueryRow(`
+		SELECT id, name, description, owner, status, allowed_users, allowed_channels, created_at, updated_at
+		FROM senders WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrSenderNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sender: %w", err)
+	}
+	return sender, nil
+}
+
+// ListSenders 列出发送者账户，status、owner 为空时不过滤
+func (s *Store) ListSenders(status, owner string) ([]*Sender, error) {
+	rows, err := s.db.Query(`
+		SELECT id, name, description, owner, status, allowed_users, allowed_channels, created_at, updated_at
+		FROM senders
+		WHERE (? = '' OR status = ?) AND (? = '' OR owner = ?)
+		ORDER BY created_at`, status, status, owner, owner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list senders: %w", err)
+	}
+	defer rows.Close()
+
+	senders := []*Sender{}
+	for rows.Next() {
+		sender, err := scanSender(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sender: %w", err)
+		}
+		senders = append(senders, sender)
+	}
+	return senders, rows.Err()
+}
+
+// UpdateSender 更新发送者账户
+func (s *Store) UpdateSender(sender *Sender) error {
+	if err := ValidateSender(sender); err != nil {
+		return err
+	}
+
+	allowedUsers, _ := json.Marshal(sender.AllowedUsers)
+	allowedChannels, _ := json.Marshal(sender.AllowedChannels)
+	sender.UpdatedAt = time.Now().UTC()
+
+	result, err := s.db.Exec(`
+		UPDATE senders SET name = ?, description = ?, owner = ?, status = ?,
+			allowed_users = ?, allowed_channels = ?, updated_at = ?
+		WHERE id = ?`,
+		sender.Name, sender.Description, sender.Owner, sender.Status,
+		string(allowedUsers), string(allowedChannels), sender.UpdatedAt, sender.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update sender: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrSenderNotFound
+	}
+	return nil
+}
+
+// ReviewSender 审核发送者申请，批准后状态为 active，拒绝后为 rejected
+func (s *Store) ReviewSender(id string, approve bool) (*Sender, error) {
+	status := SenderRejected
+	if approve {
+		status = SenderActive
+	}
+
+	result, err := s.db.Exec("UPDATE senders SET status = ?, updated_at = ? WHERE id = ? AND status = ?",
+		status, time.Now().UTC(), id, SenderPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to review sender: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		if _, err := s.GetSender(id); err != nil {
+			return nil, err
+		}
+		return nil, ErrSenderNotPending
+	}
+	return s.GetSender(id)
+}
+
+// DeleteSender 删除发送者账户并吊销其全部密钥
+func (s *Store) DeleteSender(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM senders WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete sender: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrSenderNotFound
+	}
+
+	_, err = tx.Exec(`UPDATE api_keys SET revoked_at = ?
+		WHERE owner_type = ? AND owner_id = ? AND revoked_at IS NULL`,
+		time.Now().UTC(), OwnerSender, id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sender keys: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// scanSender 扫描一行发送者记录
+func scanSender(row rowScanner) (*Sender, error) {
+	sender := &Sender{}
+	var description, owner sql.NullString
+	var allowedUsers, allowedChannels string
+
+	err := row.Scan(&sender.ID, &sender.Name, &description, &owner, &sender.Status,
+		&allowedUsers, &allowedChannels, &sender.CreatedAt, &sender.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	sender.Description = description.String
+	sender.Owner = owner.String
+	if err := json.Unmarshal([]byte(allowedUsers), &sender.AllowedUsers); err != nil {
+		return nil, fmt.Errorf("invalid allowed_users: %w", err)
+	}
+	if err := json.Unmarshal([]byte(allowedChannels), &sender.AllowedChannels); err != nil {
+		return nil, fmt.Errorf("invalid allowed_channels: %w", err)
+	}
+	return sender, nil
+}
@@ -0,0 +1,315 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	keyPrefix      = "mm_"
+	keyRandomBytes = 24
+	keyPrefixLen   = len(keyPrefix) + 8 // 列表中展示的明文前缀长度
+
+	lastUsedResolution = time.Minute // last_used_at 的更新粒度，避免每个请求都写库
+)
+
+// Store API密钥和发送者账户存储
+// 密钥只保存 SHA-256 摘要，明文在创建时返回一次后无法找回。
+type Store struct {
+	db *sql.DB
+}
+
+// OpenStore 打开（或创建）认证数据库
+func OpenStore(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create auth directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open auth database: %w", err)
+	}
+
+	s := &Store{db: db}
+	if err := s.init(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize auth database: %w", err)
+	}
+
+	return s, nil
+}
+
+// init 初始化表结构
+func (s *Store) init() error {
+	if _, err := s.db.Exec("PRAGMA journal_mode=WAL"); err != nil {
+		return fmt.Errorf("failed to enable WAL: %w", err)
+	}
+
+	createTables := `
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		key_hash TEXT NOT NULL UNIQUE,
+		prefix TEXT NOT NULL,
+		owner_type TEXT NOT NULL,
+		owner_id TEXT NOT NULL,
+		name TEXT,
+		scopes TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		last_used_at DATETIME,
+		expires_at DATETIME,
+		revoked_at DATETIME
+	);
+	CREATE INDEX IF NOT EXISTS idx_api_keys_owner ON api_keys(owner_type, owner_id);
+
+	CREATE TABLE IF NOT EXISTS senders (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		description TEXT,
+		owner TEXT,
+		status TEXT NOT NULL,
+		allowed_users TEXT NOT NULL,
+		allowed_channels TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS user_roles (
+		user_id TEXT PRIMARY KEY,
+		role TEXT NOT NULL,
+		granted_by TEXT,
+		updated_at DATETIME NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS daily_usage (
+		user_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		messages INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (user_id, day)
+	);
+	`
+	_, err := s.db.Exec(createTables)
+	return err
+}
+
+// DB 获取数据库连接（供提交去重等记录共用）
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// Close 关闭数据库
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// hashKey 计算密钥摘要；密钥为高熵随机串，不需要慢哈希
+func hashKey(rawKey string) string {
+	sum := sha256.Sum256([]byte(rawKey))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateKey 生成新的密钥明文
+func generateKey() (string, error) {
+	buf := make([]byte, keyRandomBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate api key: %w", err)
+	}
+	return keyPrefix + hex.EncodeToString(buf), nil
+}
+
+// IsAPIKey 判断凭证是否为本系统签发的API密钥格式
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, keyPrefix)
+}
+
+// CreateKey 为用户或发送者创建密钥，返回元数据和只出现一次的明文
+func (s *Store) CreateKey(ownerType, ownerID, name string, scopes []string, expiresAt *time.Time) (*APIKey, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	if err := ValidateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	rawKey, err := generateKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &APIKey{
+		ID:        uuid.New().String(),
+		Prefix:    rawKey[:keyPrefixLen],
+		OwnerType: ownerType,
+		OwnerID:   ownerID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: time.Now().UTC(),
+		ExpiresAt: expiresAt,
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO api_keys (id, key_hash, prefix, owner_type, owner_id, name, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, hashKey(rawKey), key.Prefix, key.OwnerType, key.OwnerID, key.Name,
+		strings.Join(key.Scopes, ","), key.CreatedAt, key.ExpiresAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return key, rawKey, nil
+}
+
+// Authenticate 校验密钥明文并返回对应的主体
+func (s *Store) Authenticate(rawKey string) (*Principal, error) {
+	if !IsAPIKey(rawKey) {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := s.scanKey(s.db.QueryRow(`
+		SELECT id, prefix, owner_type, owner_id, name, scopes, created_at, last_used_at, expires_at, revoked_at
+		FROM api_keys WHERE key_hash = ?`, hashKey(rawKey)))
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up api key: %w", err)
+	}
+
+	now := time.Now().UTC()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && now.After(*key.ExpiresAt)) {
+		return nil, ErrInvalidKey
+	}
+
+	principal := &Principal{
+		Type:   PrincipalUser,
+		ID:     key.OwnerID,
+		KeyID:  key.ID,
+		Scopes: key.Scopes,
+	}
+
+	if key.OwnerType == OwnerSender {
+		sender, err := s.GetSender(key.OwnerID)
+		if err == ErrSenderNotFound {
+			return nil, ErrInvalidKey
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sender.Status != SenderActive {
+			return nil, ErrSenderDisabled
+		}
+		principal.Type = PrincipalSender
+		principal.Sender = sender
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+		s.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", now, key.ID)
+	}
+
+	return principal, nil
+}
+
+// ListKeys 列出所有者的密钥（包括已吊销的）
+func (s *Store) ListKeys(ownerType, ownerID string) ([]*APIKey, error) {
+	rows, err := s.db.Query(`
+		SELECT id, prefix, owner_type, owner_id, name, scopes, created_at, last_used_at, expires_at, revoked_at
+		FROM api_keys WHERE owner_type = ? AND owner_id = ?
+		ORDER BY created_at DESC`, ownerType, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := s.scanKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RevokeKey 吊销所有者的密钥
+func (s *Store) RevokeKey(ownerType, ownerID, keyID string) error {
+	result, err := s.db.Exec(`
+		UPDATE api_keys SET revoked_at = ?
+		WHERE id = ? AND owner_type = ? AND owner_id = ? AND revoked_at IS NULL`,
+		time.Now().UTC(), keyID, ownerType, ownerID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// CountKeys 统计密钥数量
+func (s *Store) CountKeys() (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM api_keys").Scan(&count)
+	return count, err
+}
+
+// EnsureBootstrapKey 数据库中没有任何密钥时为 userID 创建管理员密钥并写入 keyFile
+// 返回是否创建了新密钥
+func (s *Store) EnsureBootstrapKey(userID, keyFile string) (bool, error) {
+	count, err := s.CountKeys()
+	if err != nil {
+		return false, fmt.Errorf("failed to count api keys: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	_, rawKey, err := s.CreateKey(OwnerUser, userID, "bootstrap", AllScopes, nil)
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(keyFile, []byte(rawKey+"\n"), 0600); err != nil {
+		return false, fmt.Errorf("failed to write bootstrap key: %w", err)
+	}
+	return true, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanKey 扫描一行密钥记录
+func (s *Store) scanKey(row rowScanner) (*APIKey, error) {
+	key := &APIKey{}
+	var name sql.NullString
+	var scopes string
+	var lastUsedAt, expiresAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.Prefix, &key.OwnerType, &key.OwnerID, &name, &scopes,
+		&key.CreatedAt, &lastUsedAt, &expiresAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Name = name.String
+	key.Scopes = strings.Split(scopes, ",")
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+// 权限范围
+const (
+	ScopeSend  = "send"  // 提交消息，创建、修改、删除和静音频道
+	ScopeRead  = "read"  // 访问自己的工作空间：读取消息、标记已读、查看频道、实时推送
+	ScopeAdmin = "admin" // 管理投递系统、发送者和其他用户的密钥
+)
+
+// AllScopes 全部权限范围
+var AllScopes = []string{ScopeSend, ScopeRead, ScopeAdmin}
+
+// 密钥所有者类型
+const (
+	OwnerUser   = "user"
+	OwnerSender = "sender"
+)
+
+// 主体类型
+const (
+	PrincipalUser   = "user"   // 用户API密钥
+	PrincipalSender = "sender" // 发送者服务账户
+	PrincipalHeader = "header" // 开发模式下信任的 User-ID 请求头
+	PrincipalToken  = "token"  // 身份提供方签发的 JWT
+)
+
+// 发送者状态
+const (
+	SenderActive   = "active"
+	SenderDisabled = "disabled"
+	SenderPending  = "pending"  // 用户提交的申请，等待管理员审核
+	SenderRejected = "rejected" // 申请被拒绝
+)
+
+// SenderPrefix 发送者在投递回执等位置使用的身份前缀
+const SenderPrefix = "sender:"
+
+// Wildcard 发送者允许列表中表示任意用户或频道
+const Wildcard = "*"
+
+var (
+	ErrInvalidKey       = errors.New("invalid api key")
+	ErrKeyNotFound      = errors.New("api key not found")
+	ErrSenderNotFound   = errors.New("sender not found")
+	ErrSenderExists     = errors.New("sender already exists")
+	ErrSenderDisabled   = errors.New("sender is disabled")
+	ErrInvalidSender    = errors.New("invalid sender")
+	ErrInvalidScope     = errors.New("invalid scope")
+	ErrInvalidRole      = errors.New("invalid role")
+	ErrLastAdmin        = errors.New("cannot remove the last admin")
+	ErrSenderNotPending = errors.New("sender is not pending approval")
+	ErrQuotaExceeded    = errors.New("daily message quota exceeded")
+)
+
+// APIKey API密钥元数据，明文只在创建时返回一次
+type APIKey struct {
+	ID         string     `json:"id"`
+	Prefix     string     `json:"prefix"` // 明文前缀，用于识别密钥
+	OwnerType  string     `json:"owner_type"`
+	OwnerID    string     `json:"owner_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Sender 发送者服务账户，只能向允许的用户和频道发送消息
+type Sender struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description,omitempty"`
+	Owner           string    `json:"owner,omitempty"`
+	Status          string    `json:"status"`
+	AllowedUsers    []string  `json:"allowed_users"`
+	AllowedChannels []string  `json:"allowed_channels"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// AllowsUser 是否允许向该用户发送
+func (s *Sender) AllowsUser(userID string) bool {
+	return containsOrWildcard(s.AllowedUsers, userID)
+}
+
+// AllowsAnyUser 是否允许向任意用户发送（广播需要）
+func (s *Sender) AllowsAnyUser() bool {
+	return contains(s.AllowedUsers, Wildcard)
+}
+
+// AllowsChannel 是否允许向该频道发送
+func (s *Sender) AllowsChannel(channelID string) bool {
+	return containsOrWildcard(s.AllowedChannels, channelID)
+}
+
+// Principal 请求的认证主体
+type Principal struct {
+	Type   string   `json:"type"`
+	ID     string   `json:"id"` // 用户ID或发送者ID
+	KeyID  string   `json:"key_id,omitempty"`
+	Scopes []string `json:"scopes"`
+	Role   string   `json:"role"`
+	Sender *Sender  `json:"-"` // 发送者主体的账户信息
+}
+
+// UserID 主体在工作空间和投递回执中使用的身份
+func (p *Principal) UserID() string {
+	if p.Type == PrincipalSender {
+		return SenderPrefix + p.ID
+	}
+	return p.ID
+}
+
+// HasScope 是否拥有权限范围，admin 包含全部权限
+func (p *Principal) HasScope(scope string) bool {
+	return contains(p.Scopes, scope) || contains(p.Scopes, ScopeAdmin)
+}
+
+// Can 是否拥有管理权限：角色必须包含该权限，且凭证带有 admin 权限范围
+func (p *Principal) Can(permission string) bool {
+	return contains(p.Scopes, ScopeAdmin) && RoleHasPermission(p.Role, permission)
+}
+
+// IsSender 是否为发送者服务账户
+func (p *Principal) IsSender() bool {
+	return p.Type == PrincipalSender
+}
+
+// ValidateScopes 检查权限范围是否有效
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !contains(AllScopes, scope) {
+			return ErrInvalidScope
+		}
+	}
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOrWildcard(list []string, value string) bool {
+	return contains(list, Wildcard) || (value != "" && contains(list, value))
+}
@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MessageUsage 用户当天收到的消息用量，按 UTC 自然日计算
+type MessageUsage struct {
+	Day     string    `json:"day"`
+	Used    int       `json:"used"`
+	Limit   int       `json:"limit"`
+	ResetAt time.Time `json:"reset_at"`
+}
+
+// Remaining 当天剩余的消息数
+func (u *MessageUsage) Remaining() int {
+	if u.Used >= u.Limit {
+		return 0
+	}
+	return u.Limit - u.Used
+}
+
+// MessageUsageDay 时间所在的 UTC 自然日，用量按该日期计数
+func MessageUsageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// newMessageUsage 创建 now 所在自然日的用量
+func newMessageUsage(now time.Time, used, limit int) *MessageUsage {
+	day := now.UTC().Truncate(24 * time.Hour)
+	return &MessageUsage{
+		Day:     MessageUsageDay(day),
+		Used:    used,
+		Limit:   limit,
+		ResetAt: day.Add(24 * time.Hour),
+	}
+}
+
+// GetMessageUsage 获取用户当天的消息用量
+func (s *Store) GetMessageUsage(userID string, limit int) (*MessageUsage, error) {
+	usage := newMessageUsage(time.Now(), 0, limit)
+	used, err := s.messagesOn(s.db, userID, usage.Day)
+	if err != nil {
+		return nil, err
+	}
+	usage.Used = used
+	return usage, nil
+}
+
+// ReserveMessages 在一个事务中为每个接收者预占当天的一条消息配额
+// 配额已满的接收者不计数，和当前用量一起出现在 exceeded 中；预占后未能提交的消息应通过 ReleaseMessages 归还
+func (s *Store) ReserveMessages(userIDs []string, limit int) (day string, exceeded map[string]*MessageUsage, err error) {
+	now := time.Now()
+	day = MessageUsageDay(now)
+	exceeded = make(map[string]*MessageUsage)
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+	defer tx.Rollback()
+
+	for _, userID := range userIDs {
+		result, err := tx.Exec(`
+			INSERT INTO daily_usage (user_id, day, messages) VALUES (?, ?, 0)
+			ON CONFLICT(user_id, day) DO NOTHING`, userID, day)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to reserve messages: %w", err)
+		}
+		if inserted, _ := result.RowsAffected(); inserted > 0 {
+			// 当天第一次计数，清理该用户之前的用量记录
+			if _, err := tx.Exec("DELETE FROM daily_usage WHERE user_id = ? AND day < ?", userID, day); err != nil {
+				return "", nil, fmt.Errorf("failed to prune usage: %w", err)
+			}
+		}
+
+		// 条件更新保证并发预占不会超出配额
+		result, err = tx.Exec(`
+			UPDATE daily_usage SET messages = messages + 1
+			WHERE user_id = ? AND day = ? AND messages < ?`, userID, day, limit)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to reserve messages: %w", err)
+		}
+		if reserved, _ := result.RowsAffected(); reserved == 0 {
+			usage := newMessageUsage(now, 0, limit)
+			if usage.Used, err = s.messagesOn(tx, userID, day); err != nil {
+				return "", nil, err
+			}
+			exceeded[userID] = usage
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", nil, fmt.Errorf("failed to reserve messages: %w", err)
+	}
+	return day, exceeded, nil
+}
+
+// ReleaseMessages 归还接收者 day 当天预占但未投递的消息配额，每人一条
+func (s *Store) ReleaseMessages(userIDs []string, day string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, userID := range userIDs {
+		if _, err := tx.Exec(`
+			UPDATE daily_usage SET messages = MAX(messages - 1, 0)
+			WHERE user_id = ? AND day = ?`, userID, day); err != nil {
+			return fmt.Errorf("failed to release messages: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to release messages: %w", err)
+	}
+	return nil
+}
+
+// queryRower 可以执行单行查询的数据库或事务
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// messagesOn 用户某天的消息数
+func (s *Store) messagesOn(db queryRower, userID, day string) (int, error) {
+	var used int
+	err := db.QueryRow("SELECT messages FROM daily_usage WHERE user_id = ? AND day = ?", userID, day).Scan(&used)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get message usage: %w", err)
+	}
+	return used, nil
+}
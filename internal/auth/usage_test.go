@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReserveMessagesPerRecipient(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatalf("OpenStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	// alice 的配额先用满
+	for i := 0; i < 2; i++ {
+		if _, exceeded, err := store.ReserveMessages([]string{"alice"}, 2); err != nil || len(exceeded) != 0 {
+			t.Fatalf("reserve for alice = %v, %v", exceeded, err)
+		}
+	}
+
+	day, exceeded, err := store.ReserveMessages([]string{"alice", "bob"}, 2)
+	if err != nil {
+		t.Fatalf("ReserveMessages: %v", err)
+	}
+	if day != MessageUsageDay(time.Now()) {
+		t.Fatalf("day = %s", day)
+	}
+	if usage := exceeded["alice"]; usage == nil || usage.Used != 2 || usage.Remaining() != 0 {
+		t.Fatalf("alice usage = %+v, want exceeded at 2", usage)
+	}
+	if _, ok := exceeded["bob"]; ok {
+		t.Fatal("bob should still have quota")
+	}
+
+	if err := store.ReleaseMessages([]string{"alice", "bob"}, day); err != nil {
+		t.Fatalf("ReleaseMessages: %v", err)
+	}
+	for userID, want := range map[string]int{"alice": 1, "bob": 0} {
+		usage, err := store.GetMessageUsage(userID, 2)
+		if err != nil {
+			t.Fatalf("GetMessageUsage(%s): %v", userID, err)
+		}
+		if usage.Used != want {
+			t.Errorf("%s used = %d, want %d", userID, usage.Used, want)
+		}
+	}
+}
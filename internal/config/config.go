@@ -17,6 +17,18 @@ const (
 	DefaultMaxSize          = 1000
 	DefaultTTLMinutes       = 30
 	DefaultCleanupMinutes    = 5
+	DefaultJournalPath      = "./data/delivery/journal.db"
+	DefaultScheduleMaxDelayDays = 30
+	DefaultReceiptTTLDays   = 30
+	DefaultExpirySweepSeconds = 60
+	DefaultRetentionIntervalMinutes = 60
+	DefaultAuthDBPath       = "./data/auth/auth.db"
+	DefaultBootstrapUser    = "admin"
+	DefaultJWKSRefreshMinutes = 15
+	DefaultJWTUserClaim     = "sub"
+	DefaultJWTScopeClaim    = "scope"
+	DefaultJWTLeewaySeconds = 60
+	DefaultDedupWindowMinutes = 1440
 )
 
 // Load 加载配置文件
@@ -125,6 +137,19 @@ delivery:
     max_retries: 3               # 最大重试次数
     retry_backoff_base_ms: 100   # 重试退避基数(毫秒)
     retry_backoff_max_ms: 5000   # 重试退避最大值(毫秒)
+  journal:
+    enabled: true                # 启用投递日志(重启后恢复未完成的投递)
+    path: "./data/delivery/journal.db"  # 投递日志路径
+    receipt_ttl_days: 30         # 投递回执保留天数(按最后更新时间，负数表示不清理)
+  webhook:
+    enabled: true                # 启用投递状态回调(callback_url)
+    timeout_seconds: 5           # 回调请求超时(秒)
+    max_attempts: 3              # 回调最大尝试次数
+    workers: 4                   # 回调发送协程数
+    queue_size: 1000             # 回调等待队列长度(满时丢弃并记录日志)
+    allowed_hosts: []            # 允许回调的内部主机名、IP或CIDR网段(默认拒绝内网、回环和链路本地地址)
+  schedule:
+    max_delay_days: 30           # 定时投递最长延迟(天，需要启用投递日志)
 
 # 数据库配置
 database:
@@ -133,13 +158,22 @@ database:
     synchronous_mode: "NORMAL"  # 同步模式: OFF/NORMAL/FULL
   cache_size_messages: 10000     # 消息数据库缓存大小(页)
   cache_size_read_status: 5000  # 已读状态数据库缓存大小(页)
+  expiry_sweep_seconds: 60      # 过期消息清理间隔(秒)
+  retention_interval_minutes: 60 # 频道保留策略执行及数据库压缩间隔(分钟)
 
 # 用户限制
 user:
   max_messages_per_day: 10000   # 每用户每天最大消息数
-  max_channels: 50             # 每用户最大频道数
+  max_channels: 50             # 每用户最大频道数，0 表示不限制
   message_size_limit: 1048576  # 单条消息大小限制(1MB)
-  max_workspaces: 2000         # 系统最大工作空间数
+  max_workspaces: 2000         # 系统最大工作空间数，0 表示不限制
+  channel_auto_create: allow   # 频道不存在时: allow=自动创建, deny=不投递, default=投递到默认频道
+
+# 群发接收者
+recipients:
+  max_per_message: 10000       # 单条消息最大接收者数(0=不限制)
+  groups:                      # 命名用户组，发送时通过 groups 字段引用
+    ops: []
 
 # 性能调优
 performance:
@@ -173,13 +207,38 @@ websocket:
 api:
   rate_limit:
     enabled: true               # 启用速率限制
-    requests_per_minute: 1000    # 每分钟请求限制
+    requests_per_minute: 1000    # 每分钟请求限制(读取类接口和WebSocket连接)
     burst_size: 100             # 突发请求大小
+    send:                       # 发送类接口单独计数
+      requests_per_minute: 600
+      burst_size: 60
+    sender_overrides: {}        # 按发送者覆盖发送限制，如 monitoring: {requests_per_minute: 6000, burst_size: 500}
+    auth_failure:               # 同一IP认证失败(401)的次数，超出后该IP的请求在认证前返回429
+      requests_per_minute: 30
+      burst_size: 10
   cors:
     enabled: true               # 启用CORS
     allowed_origins: ["*"]      # 允许的源
-    allowed_methods: ["GET", "POST", "PUT", "DELETE", "OPTIONS"]
-    allowed_headers: ["Content-Type", "Authorization", "User-ID"]
+    allowed_methods: ["GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"]
+    allowed_headers: ["Content-Type", "Authorization", "X-API-Key", "User-ID", "Idempotency-Key"]
+  auth:
+    db_path: "./data/auth/auth.db"  # API密钥和发送者数据库
+    allow_user_id_header: false # 开发模式：没有密钥时信任 User-ID 请求头
+    bootstrap_user: "admin"     # 首次启动时为该用户创建管理员密钥(写入 bootstrap.key)
+    jwt:
+      enabled: false            # 接受身份提供方签发的 Bearer JWT
+      jwks_file: ""             # 本地 JWKS 文件
+      jwks_url: ""              # 远程 JWKS 地址(优先于 jwks_file)
+      refresh_interval_minutes: 15  # JWKS 刷新间隔，遇到未知 kid 时也会立即刷新
+      issuer: ""                # 校验 iss，为空不校验
+      audience: ""              # 校验 aud，为空不校验
+      user_claim: "sub"         # 映射为用户ID的声明
+      scope_claim: "scope"      # 权限范围声明(空格分隔字符串或数组)
+      default_scopes: ["send", "read"]  # 令牌没有携带权限范围时授予
+      leeway_seconds: 60        # 允许的时钟偏差(秒)
+  dedup:
+    window_minutes: 1440        # 去重窗口(分钟)，窗口内相同 Idempotency-Key/dedup_key 的提交返回首次提交的消息ID
+    content_hash: false         # 没有去重键的提交按消息内容去重
 
 # 日志配置
 logging:
@@ -224,6 +283,59 @@ func setDefaults(config *Config) {
 		config.Cache.Workspace.CleanupIntervalMinutes = DefaultCleanupMinutes
 	}
 
+	// 投递日志默认值
+	if config.Delivery.Journal.Path == "" {
+		config.Delivery.Journal.Path = DefaultJournalPath
+	}
+	if config.Delivery.Journal.ReceiptTTLDays == 0 {
+		config.Delivery.Journal.ReceiptTTLDays = DefaultReceiptTTLDays
+	}
+	if config.Delivery.Schedule.MaxDelayDays == 0 {
+		config.Delivery.Schedule.MaxDelayDays = DefaultScheduleMaxDelayDays
+	}
+
+	// 过期消息清理默认值
+	if config.Database.ExpirySweepSeconds == 0 {
+		config.Database.ExpirySweepSeconds = DefaultExpirySweepSeconds
+	}
+	if config.Database.RetentionIntervalMinutes == 0 {
+		config.Database.RetentionIntervalMinutes = DefaultRetentionIntervalMinutes
+	}
+
+	// 认证默认值
+	if config.API.Auth.DBPath == "" {
+		config.API.Auth.DBPath = DefaultAuthDBPath
+	}
+	if config.API.Auth.BootstrapUser == "" {
+		config.API.Auth.BootstrapUser = DefaultBootstrapUser
+	}
+	jwt := &config.API.Auth.JWT
+	if jwt.RefreshIntervalMinutes == 0 {
+		jwt.RefreshIntervalMinutes = DefaultJWKSRefreshMinutes
+	}
+	if jwt.UserClaim == "" {
+		jwt.UserClaim = DefaultJWTUserClaim
+	}
+	if jwt.ScopeClaim == "" {
+		jwt.ScopeClaim = DefaultJWTScopeClaim
+	}
+	if len(jwt.DefaultScopes) == 0 {
+		jwt.DefaultScopes = []string{"send", "read"}
+	}
+	if jwt.LeewaySeconds == 0 {
+		jwt.LeewaySeconds = DefaultJWTLeewaySeconds
+	}
+
+	// 去重默认值
+	if config.API.Dedup.WindowMinutes == 0 {
+		config.API.Dedup.WindowMinutes = DefaultDedupWindowMinutes
+	}
+
+	// 频道自动创建默认值
+	if config.User.ChannelAutoCreate == "" {
+		config.User.ChannelAutoCreate = ChannelAutoCreateAllow
+	}
+
 	// 日志默认值
 	if config.Logging.Level == "" {
 		config.Logging.Level = "info"
@@ -271,6 +383,17 @@ func validateConfig(config *Config) error {
 	if config.Delivery.Task.TimeoutSeconds <= 0 {
 		return fmt.Errorf("delivery task timeout must be positive")
 	}
+	if config.Delivery.Schedule.MaxDelayDays < 0 {
+		return fmt.Errorf("delivery schedule max_delay_days cannot be negative")
+	}
+
+	// 验证数据库配置
+	if config.Database.ExpirySweepSeconds < 0 {
+		return fmt.Errorf("database expiry_sweep_seconds cannot be negative")
+	}
+	if config.Database.RetentionIntervalMinutes < 0 {
+		return fmt.Errorf("database retention_interval_minutes cannot be negative")
+	}
 
 	// 验证用户配置
 	if config.User.MaxMessagesPerDay <= 0 {
@@ -279,7 +402,60 @@ func validateConfig(config *Config) error {
 	if config.User.MessageSizeLimit <= 0 {
 		return fmt.Errorf("user message_size_limit must be positive")
 	}
+	if config.User.MaxChannels < 0 || config.User.MaxWorkspaces < 0 {
+		return fmt.Errorf("user max_channels and max_workspaces must not be negative")
+	}
+	switch config.User.ChannelAutoCreate {
+	case ChannelAutoCreateAllow, ChannelAutoCreateDeny, ChannelAutoCreateDefault:
+	default:
+		return fmt.Errorf("user channel_auto_create must be allow, deny or default")
+	}
+
+	// 验证速率限制配置
+	if rl := config.API.RateLimit; rl.Enabled {
+		if err := validateRateLimitRule("api rate_limit", rl.ReadRule()); err != nil {
+			return err
+		}
+		if rl.Send.RequestsPerMinute != 0 || rl.Send.BurstSize != 0 {
+			if err := validateRateLimitRule("api rate_limit send", rl.Send); err != nil {
+				return err
+			}
+		}
+		for senderID, rule := range rl.SenderOverrides {
+			if err := validateRateLimitRule("api rate_limit sender_overrides."+senderID, rule); err != nil {
+				return err
+			}
+		}
+		if rl.AuthFailure.RequestsPerMinute != 0 || rl.AuthFailure.BurstSize != 0 {
+			if err := validateRateLimitRule("api rate_limit auth_failure", rl.AuthFailure); err != nil {
+				return err
+			}
+		}
+	}
 
+	// 验证去重配置
+	if config.API.Dedup.WindowMinutes < 0 {
+		return fmt.Errorf("api dedup window_minutes must not be negative")
+	}
+
+	// 验证JWT配置
+	if jwt := config.API.Auth.JWT; jwt.Enabled {
+		if jwt.JWKSFile == "" && jwt.JWKSURL == "" {
+			return fmt.Errorf("api auth jwt requires jwks_file or jwks_url")
+		}
+		if jwt.RefreshIntervalMinutes < 0 || jwt.LeewaySeconds < 0 {
+			return fmt.Errorf("api auth jwt refresh_interval_minutes and leeway_seconds cannot be negative")
+		}
+	}
+
+	return nil
+}
+
+// validateRateLimitRule 检查令牌桶规则
+func validateRateLimitRule(name string, rule RateLimitRule) error {
+	if rule.RequestsPerMinute <= 0 || rule.BurstSize <= 0 {
+		return fmt.Errorf("%s requests_per_minute and burst_size must be positive", name)
+	}
 	return nil
 }
 
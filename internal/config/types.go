@@ -9,6 +9,7 @@ type Config struct {
 	Delivery     DeliveryConfig     `yaml:"delivery"`
 	Database     DatabaseConfig     `yaml:"database"`
 	User         UserConfig         `yaml:"user"`
+	Recipients   RecipientsConfig   `yaml:"recipients"`
 	Performance  PerformanceConfig  `yaml:"performance"`
 	Monitoring   MonitoringConfig   `yaml:"monitoring"`
 	WebSocket    WebSocketConfig    `yaml:"websocket"`
@@ -36,9 +37,12 @@ type WorkspaceCacheConfig struct {
 
 // DeliveryConfig 投递系统配置
 type DeliveryConfig struct {
-	Workers WorkersConfig `yaml:"workers"`
-	Queue   QueueConfig   `yaml:"queue"`
-	Task    TaskConfig    `yaml:"task"`
+	Workers  WorkersConfig  `yaml:"workers"`
+	Queue    QueueConfig    `yaml:"queue"`
+	Task     TaskConfig     `yaml:"task"`
+	Journal  JournalConfig  `yaml:"journal"`
+	Webhook  WebhookConfig  `yaml:"webhook"`
+	Schedule ScheduleConfig `yaml:"schedule"`
 }
 
 type WorkersConfig struct {
@@ -60,11 +64,65 @@ type TaskConfig struct {
 	RetryBackoffMaxMs  int `yaml:"retry_backoff_max_ms"`
 }
 
+// JournalConfig 投递日志配置
+type JournalConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Path           string `yaml:"path"`
+	ReceiptTTLDays int    `yaml:"receipt_ttl_days"` // 投递回执保留天数，负数表示不清理
+}
+
+// GetReceiptTTL 获取投递回执保留时间，不清理时返回0
+func (j *JournalConfig) GetReceiptTTL() time.Duration {
+	if j.ReceiptTTLDays <= 0 {
+		return 0
+	}
+	return time.Duration(j.ReceiptTTLDays) * 24 * time.Hour
+}
+
+// WebhookConfig 投递状态回调配置
+type WebhookConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	TimeoutSeconds int  `yaml:"timeout_seconds"`
+	MaxAttempts    int  `yaml:"max_attempts"`
+	Workers        int  `yaml:"workers"`    // 发送协程数
+	QueueSize      int  `yaml:"queue_size"` // 等待队列长度，满时丢弃回调
+
+	// AllowedHosts 允许回调的内部主机名、IP 或 CIDR 网段，其余内网、回环和链路本地地址一律拒绝
+	AllowedHosts []string `yaml:"allowed_hosts"`
+}
+
+// GetTimeout 获取回调请求超时时间
+func (w *WebhookConfig) GetTimeout() time.Duration {
+	return time.Duration(w.TimeoutSeconds) * time.Second
+}
+
+// ScheduleConfig 定时投递配置（需要启用投递日志）
+type ScheduleConfig struct {
+	MaxDelayDays int `yaml:"max_delay_days"`
+}
+
+// GetMaxDelay 获取允许的最长延迟
+func (s *ScheduleConfig) GetMaxDelay() time.Duration {
+	return time.Duration(s.MaxDelayDays) * 24 * time.Hour
+}
+
 // DatabaseConfig 数据库配置
 type DatabaseConfig struct {
 	WAL      WALConfig      `yaml:"wal"`
 	CacheSizeMessages   int `yaml:"cache_size_messages"`
 	CacheSizeReadStatus int `yaml:"cache_size_read_status"`
+	ExpirySweepSeconds  int `yaml:"expiry_sweep_seconds"`
+	RetentionIntervalMinutes int `yaml:"retention_interval_minutes"`
+}
+
+// GetExpirySweepInterval 获取过期消息清理间隔
+func (d *DatabaseConfig) GetExpirySweepInterval() time.Duration {
+	return time.Duration(d.ExpirySweepSeconds) * time.Second
+}
+
+// GetRetentionInterval 获取频道保留策略的执行间隔
+func (d *DatabaseConfig) GetRetentionInterval() time.Duration {
+	return time.Duration(d.RetentionIntervalMinutes) * time.Minute
 }
 
 type WALConfig struct {
@@ -78,6 +136,20 @@ type UserConfig struct {
 	MaxChannels       int    `yaml:"max_channels"`
 	MessageSizeLimit  int64  `yaml:"message_size_limit"`
 	MaxWorkspaces     int    `yaml:"max_workspaces"`
+	ChannelAutoCreate string `yaml:"channel_auto_create"` // 消息的频道在接收者工作空间中不存在时的处理方式
+}
+
+// 频道不存在时的处理方式
+const (
+	ChannelAutoCreateAllow   = "allow"   // 以 channel_id 为标识创建频道
+	ChannelAutoCreateDeny    = "deny"    // 不投递给该用户
+	ChannelAutoCreateDefault = "default" // 投递到默认频道
+)
+
+// RecipientsConfig 群发接收者配置
+type RecipientsConfig struct {
+	MaxPerMessage int                 `yaml:"max_per_message"` // 单条消息最大接收者数(0表示不限制)
+	Groups        map[string][]string `yaml:"groups"`          // 命名用户组
 }
 
 // PerformanceConfig 性能配置
@@ -130,12 +202,56 @@ type WebSocketConfig struct {
 type APIConfig struct {
 	RateLimit RateLimitConfig `yaml:"rate_limit"`
 	CORS      CORSConfig      `yaml:"cors"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Dedup     DedupConfig     `yaml:"dedup"`
+}
+
+// DedupConfig 消息提交去重配置
+type DedupConfig struct {
+	WindowMinutes int  `yaml:"window_minutes"` // 去重窗口(分钟)，窗口内重复提交返回首次提交的消息ID
+	ContentHash   bool `yaml:"content_hash"`   // 没有去重键的提交按消息内容去重
+}
+
+// GetWindow 获取去重窗口
+func (d *DedupConfig) GetWindow() time.Duration {
+	return time.Duration(d.WindowMinutes) * time.Minute
+}
+
+// AuthConfig 认证配置
+type AuthConfig struct {
+	DBPath            string `yaml:"db_path"`              // API密钥和发送者数据库
+	AllowUserIDHeader bool   `yaml:"allow_user_id_header"` // 开发模式：没有密钥时信任 User-ID 请求头
+	BootstrapUser     string `yaml:"bootstrap_user"`       // 首次启动时为该用户创建管理员密钥
+	JWT               JWTConfig `yaml:"jwt"`
+}
+
+// JWTConfig 身份提供方签发的 JWT 认证配置
+type JWTConfig struct {
+	Enabled                bool     `yaml:"enabled"`
+	JWKSFile               string   `yaml:"jwks_file"`                // 本地 JWKS 文件
+	JWKSURL                string   `yaml:"jwks_url"`                 // 远程 JWKS 地址，优先于 jwks_file
+	RefreshIntervalMinutes int      `yaml:"refresh_interval_minutes"` // 定期重新加载 JWKS 的间隔
+	Issuer                 string   `yaml:"issuer"`                   // 为空时不校验 iss
+	Audience               string   `yaml:"audience"`                 // 为空时不校验 aud
+	UserClaim              string   `yaml:"user_claim"`               // 映射为用户ID的声明，支持点分路径
+	ScopeClaim             string   `yaml:"scope_claim"`              // 权限范围声明
+	DefaultScopes          []string `yaml:"default_scopes"`           // 令牌中没有本系统权限时授予的权限
+	LeewaySeconds          int      `yaml:"leeway_seconds"`           // exp/nbf 允许的时钟偏差
 }
 
 type RateLimitConfig struct {
 	Enabled            bool `yaml:"enabled"`
-	RequestsPerMinute int  `yaml:"requests_per_minute"`
+	RequestsPerMinute int  `yaml:"requests_per_minute"` // 读取类接口和 WebSocket 连接
 	BurstSize         int  `yaml:"burst_size"`
+	Send              RateLimitRule            `yaml:"send"`             // 发送类接口，未配置时与读取相同
+	SenderOverrides   map[string]RateLimitRule `yaml:"sender_overrides"` // 按发送者ID覆盖发送限制
+	AuthFailure       RateLimitRule            `yaml:"auth_failure"`     // 同一IP认证失败（401）的次数，在认证之前检查
+}
+
+// RateLimitRule 令牌桶规则：每分钟补充 RequestsPerMinute 个令牌，最多积累 BurstSize 个
+type RateLimitRule struct {
+	RequestsPerMinute int `yaml:"requests_per_minute"`
+	BurstSize         int `yaml:"burst_size"`
 }
 
 type CORSConfig struct {
@@ -170,6 +286,57 @@ func (d *DeliveryConfig) GetRetryBackoffMax() time.Duration {
 	return time.Duration(d.Task.RetryBackoffMaxMs) * time.Millisecond
 }
 
+// GetPingInterval 获取WebSocket心跳间隔
+func (w *WebSocketConfig) GetPingInterval() time.Duration {
+	return time.Duration(w.PingIntervalSeconds) * time.Second
+}
+
+// GetReadTimeout 获取WebSocket读取超时
+func (w *WebSocketConfig) GetReadTimeout() time.Duration {
+	return time.Duration(w.ReadTimeoutSeconds) * time.Second
+}
+
+// GetWriteTimeout 获取WebSocket写入超时
+func (w *WebSocketConfig) GetWriteTimeout() time.Duration {
+	return time.Duration(w.WriteTimeoutSeconds) * time.Second
+}
+
+// ReadRule 获取读取类接口的限制
+func (r *RateLimitConfig) ReadRule() RateLimitRule {
+	return RateLimitRule{RequestsPerMinute: r.RequestsPerMinute, BurstSize: r.BurstSize}
+}
+
+// SendRule 获取发送类接口的限制，发送者有覆盖配置时使用覆盖值
+func (r *RateLimitConfig) SendRule(senderID string) RateLimitRule {
+	if senderID != "" {
+		if rule, ok := r.SenderOverrides[senderID]; ok {
+			return rule
+		}
+	}
+	if r.Send.RequestsPerMinute > 0 {
+		return r.Send
+	}
+	return r.ReadRule()
+}
+
+// AuthFailureRule 获取认证失败的限制，未配置时每分钟 30 次、最多积累 10 次
+func (r *RateLimitConfig) AuthFailureRule() RateLimitRule {
+	if r.AuthFailure.RequestsPerMinute > 0 {
+		return r.AuthFailure
+	}
+	return RateLimitRule{RequestsPerMinute: 30, BurstSize: 10}
+}
+
+// GetRefreshInterval 获取 JWKS 刷新间隔
+func (j *JWTConfig) GetRefreshInterval() time.Duration {
+	return time.Duration(j.RefreshIntervalMinutes) * time.Minute
+}
+
+// GetLeeway 获取允许的时钟偏差
+func (j *JWTConfig) GetLeeway() time.Duration {
+	return time.Duration(j.LeewaySeconds) * time.Second
+}
+
 // AppLoggingConfig 应用日志配置（重命名避免冲突）
 type AppLoggingConfig struct {
 	Level    string               `yaml:"level"`
@@ -0,0 +1,142 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaxKeyLength 去重键的最大长度
+const MaxKeyLength = 255
+
+// ErrKeyMismatch 同一去重键在窗口内用于内容不同的提交
+var ErrKeyMismatch = errors.New("dedup key reused with a different request")
+
+// Entry 去重键登记的提交
+type Entry struct {
+	MessageID   string
+	Fingerprint string
+	CreatedAt   time.Time
+}
+
+// Store 消息提交去重记录，按提交者和去重键登记首次提交的消息ID
+// 与认证数据库共用同一数据库
+type Store struct {
+	db     *sql.DB
+	window time.Duration
+
+	stopCleanup chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewStore 创建去重存储，window 内的重复提交返回首次提交的消息ID
+func NewStore(db *sql.DB, window time.Duration) (*Store, error) {
+	createTable := `
+	CREATE TABLE IF NOT EXISTS submission_keys (
+		submitter TEXT NOT NULL,
+		dedup_key TEXT NOT NULL,
+		message_id TEXT NOT NULL,
+		fingerprint TEXT NOT NULL,
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (submitter, dedup_key)
+	);
+	CREATE INDEX IF NOT EXISTS idx_submission_keys_created ON submission_keys(created_at);
+	`
+	if _, err := db.Exec(createTable); err != nil {
+		return nil, fmt.Errorf("failed to create submission key table: %w", err)
+	}
+
+	s := &Store{
+		db:          db,
+		window:      window,
+		stopCleanup: make(chan struct{}),
+	}
+	go s.cleanupLoop()
+	return s, nil
+}
+
+// Window 去重窗口
+func (s *Store) Window() time.Duration {
+	return s.window
+}
+
+// Claim 为提交者的去重键登记消息
+// 窗口内已登记过时不修改记录，返回原记录和 false；原记录的请求指纹不同时同时返回 ErrKeyMismatch
+func (s *Store) Claim(submitter, key, fingerprint, messageID string) (*Entry, bool, error) {
+	now := time.Now().UTC()
+
+	// 单条语句完成登记：不存在或已过期时写入，并发的重复提交只有一个能成功
+	result, err := s.db.Exec(`
+		INSERT INTO submission_keys (submitter, dedup_key, message_id, fingerprint, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(submitter, dedup_key) DO UPDATE SET
+			message_id = excluded.message_id,
+			fingerprint = excluded.fingerprint,
+			created_at = excluded.created_at
+		WHERE submission_keys.created_at < ?`,
+		submitter, key, messageID, fingerprint, now, now.Add(-s.window))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to claim dedup key: %w", err)
+	}
+	if claimed, _ := result.RowsAffected(); claimed > 0 {
+		return &Entry{MessageID: messageID, Fingerprint: fingerprint, CreatedAt: now}, true, nil
+	}
+
+	entry := &Entry{}
+	err = s.db.QueryRow(`
+		SELECT message_id, fingerprint, created_at FROM submission_keys
+		WHERE submitter = ? AND dedup_key = ?`, submitter, key).
+		Scan(&entry.MessageID, &entry.Fingerprint, &entry.CreatedAt)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get dedup key: %w", err)
+	}
+	if entry.Fingerprint != fingerprint {
+		return entry, false, ErrKeyMismatch
+	}
+	return entry, false, nil
+}
+
+// Release 提交失败时删除登记，允许客户端用同一去重键重试
+func (s *Store) Release(submitter, key, messageID string) error {
+	_, err := s.db.Exec(`
+		DELETE FROM submission_keys WHERE submitter = ? AND dedup_key = ? AND message_id = ?`,
+		submitter, key, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to release dedup key: %w", err)
+	}
+	return nil
+}
+
+// Close 停止清理协程
+func (s *Store) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stopCleanup)
+	})
+}
+
+// cleanupLoop 定期清理过期的登记
+func (s *Store) cleanupLoop() {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.db.Exec("DELETE FROM submission_keys WHERE created_at < ?", time.Now().UTC().Add(-s.window))
+		case <-s.stopCleanup:
+			return
+		}
+	}
+}
+
+// Fingerprint 计算请求内容的摘要，用于按内容去重和检查去重键是否被不同请求复用
+func Fingerprint(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
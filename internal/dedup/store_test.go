@@ -0,0 +1,122 @@
+package dedup
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func newTestStore(t *testing.T, window time.Duration) *Store {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "auth.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	store, err := NewStore(db, window)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(store.Close)
+	return store
+}
+
+func TestClaimReturnsOriginalWithinWindow(t *testing.T) {
+	store := newTestStore(t, time.Hour)
+
+	entry, claimed, err := store.Claim("alice", "order-1", "fp-a", "msg-1")
+	if err != nil || !claimed || entry.MessageID != "msg-1" {
+		t.Fatalf("first Claim = %+v, %v, %v", entry, claimed, err)
+	}
+
+	entry, claimed, err = store.Claim("alice", "order-1", "fp-a", "msg-2")
+	if err != nil {
+		t.Fatalf("duplicate Claim: %v", err)
+	}
+	if claimed || entry.MessageID != "msg-1" {
+		t.Fatalf("duplicate Claim = %+v, %v, want original msg-1", entry, claimed)
+	}
+
+	// 去重键按提交者隔离
+	entry, claimed, err = store.Claim("bob", "order-1", "fp-a", "msg-3")
+	if err != nil || !claimed || entry.MessageID != "msg-3" {
+		t.Fatalf("Claim by another submitter = %+v, %v, %v", entry, claimed, err)
+	}
+}
+
+func TestClaimRejectsDifferentFingerprint(t *testing.T) {
+	store := newTestStore(t, time.Hour)
+
+	if _, _, err := store.Claim("alice", "order-1", "fp-a", "msg-1"); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	entry, claimed, err := store.Claim("alice", "order-1", "fp-b", "msg-2")
+	if err != ErrKeyMismatch {
+		t.Fatalf("Claim with different fingerprint error = %v, want ErrKeyMismatch", err)
+	}
+	if claimed || entry == nil || entry.MessageID != "msg-1" {
+		t.Fatalf("Claim with different fingerprint = %+v, %v", entry, claimed)
+	}
+}
+
+func TestClaimAfterWindowExpires(t *testing.T) {
+	store := newTestStore(t, 50*time.Millisecond)
+
+	if _, _, err := store.Claim("alice", "order-1", "fp-a", "msg-1"); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	time.Sleep(80 * time.Millisecond)
+
+	// 窗口过后同一个键可以用于新的提交，内容不同也不报错
+	entry, claimed, err := store.Claim("alice", "order-1", "fp-b", "msg-2")
+	if err != nil || !claimed || entry.MessageID != "msg-2" {
+		t.Fatalf("Claim after window = %+v, %v, %v", entry, claimed, err)
+	}
+	if store.Window() != 50*time.Millisecond {
+		t.Fatalf("Window = %v", store.Window())
+	}
+}
+
+func TestReleaseAllowsRetry(t *testing.T) {
+	store := newTestStore(t, time.Hour)
+
+	if _, _, err := store.Claim("alice", "order-1", "fp-a", "msg-1"); err != nil {
+		t.Fatalf("Claim: %v", err)
+	}
+	// 只能释放自己登记的消息
+	if err := store.Release("alice", "order-1", "msg-other"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, claimed, _ := store.Claim("alice", "order-1", "fp-a", "msg-2"); claimed {
+		t.Fatalf("Claim succeeded after releasing another message")
+	}
+
+	if err := store.Release("alice", "order-1", "msg-1"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	entry, claimed, err := store.Claim("alice", "order-1", "fp-a", "msg-2")
+	if err != nil || !claimed || entry.MessageID != "msg-2" {
+		t.Fatalf("Claim after Release = %+v, %v, %v", entry, claimed, err)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	type request struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+	}
+	a := Fingerprint(request{Title: "deploy", Content: "done"})
+	if a != Fingerprint(request{Title: "deploy", Content: "done"}) {
+		t.Fatalf("Fingerprint is not stable")
+	}
+	if a == Fingerprint(request{Title: "deploy", Content: "failed"}) {
+		t.Fatalf("Fingerprint ignores content")
+	}
+	if len(a) != 64 {
+		t.Fatalf("Fingerprint length = %d, want 64", len(a))
+	}
+}
@@ -0,0 +1,256 @@
+package delivery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrDeadLetterNotFound 死信不存在
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrDeadLettersDisabled 未启用投递日志时死信队列不可用
+	ErrDeadLettersDisabled = errors.New("dead letter queue not enabled")
+	// ErrReceiptsDisabled 未启用投递日志时投递回执不可用
+	ErrReceiptsDisabled = errors.New("delivery receipts not enabled")
+)
+
+// DeliveryAttempt 单次投递尝试记录
+type DeliveryAttempt struct {
+	Attempt int       `json:"attempt"`           // 第几次尝试（从1开始）
+	UserID  string    `json:"user_id,omitempty"` // 失败的目标用户
+	Error   string    `json:"error"`             // 错误信息
+	At      time.Time `json:"at"`                // 尝试时间
+}
+
+// DeadLetter 死信条目
+type DeadLetter struct {
+	ID          string       `json:"id"`           // 死信ID（即原任务ID）
+	MessageID   string       `json:"message_id"`   // 消息ID
+	ChannelID   string       `json:"channel_id"`   // 频道ID
+	TargetUsers []string     `json:"target_users"` // 投递失败的用户
+	Reason      string       `json:"reason"`       // 进入死信的原因
+	Attempts    int          `json:"attempts"`     // 尝试次数
+	DeadAt      time.Time    `json:"dead_at"`      // 进入死信的时间
+	Task        DeliveryTask `json:"task"`         // 完整任务（含每次尝试的错误）
+}
+
+// DeadLetterFilter 死信查询条件
+type DeadLetterFilter struct {
+	UserID string
+	Reason string
+	Limit  int
+	Offset int
+}
+
+// DeadLetterStore 持久化死信存储
+type DeadLetterStore struct {
+	db *sql.DB
+}
+
+// NewDeadLetterStore 创建死信存储，与投递日志共用同一数据库
+func NewDeadLetterStore(db *sql.DB) (*DeadLetterStore, error) {
+	createTable := `
+	CREATE TABLE IF NOT EXISTS dead_letters (
+		id TEXT PRIMARY KEY,
+		message_id TEXT,
+		channel_id TEXT,
+		target_users TEXT,
+		reason TEXT,
+		attempts INTEGER DEFAULT 0,
+		task TEXT NOT NULL,
+		dead_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_dead_letters_dead_at ON dead_letters(dead_at);
+	`
+	if _, err := db.Exec(createTable); err != nil {
+		return nil, fmt.Errorf("failed to create dead letter table: %w", err)
+	}
+
+	return &DeadLetterStore{db: db}, nil
+}
+
+// Add 写入死信
+func (s *DeadLetterStore) Add(task DeliveryTask, reason string) error {
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+	users, _ := json.Marshal(task.TargetUsers)
+
+	messageID := ""
+	if task.Message != nil {
+		messageID = task.Message.ID
+	}
+
+	_, err = s.db.Exec(`
+		INSERT OR REPLACE INTO dead_letters (id, message_id, channel_id, target_users, reason, attempts, task, dead_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, task.ID, messageID, task.ChannelID, string(users), reason, len(task.Attempts), string(payload), time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to add dead letter: %w", err)
+	}
+
+	return nil
+}
+
+// Get 获取单条死信
+func (s *DeadLetterStore) Get(id string) (*DeadLetter, error) {
+	row := s.db.QueryRow(`
+		SELECT id, message_id, channel_id, target_users, reason, attempts, task, dead_at
+		FROM dead_letters WHERE id = ?
+	`, id)
+
+	dl, err := scanDeadLetter(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, fmt.Errorf("failed to get dead letter: %w", err)
+	}
+
+	return dl, nil
+}
+
+// List 分页列出死信
+func (s *DeadLetterStore) List(filter DeadLetterFilter) ([]*DeadLetter, int, error) {
+	where, args := filter.whereClause()
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM dead_letters"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count dead letters: %w", err)
+	}
+
+	query := `
+		SELECT id, message_id, channel_id, target_users, reason, attempts, task, dead_at
+		FROM dead_letters` + where + `
+		ORDER BY dead_at DESC
+		LIMIT ? OFFSET ?
+	`
+	rows, err := s.db.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []*DeadLetter
+	for rows.Next() {
+		dl, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan dead letter: %w", err)
+		}
+		letters = append(letters, dl)
+	}
+
+	return letters, total, nil
+}
+
+// IDs 返回符合条件的全部死信ID（用于批量重放）
+func (s *DeadLetterStore) IDs(filter DeadLetterFilter) ([]string, error) {
+	where, args := filter.whereClause()
+
+	rows, err := s.db.Query("SELECT id FROM dead_letters"+where+" ORDER BY dead_at ASC", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// Delete 删除单条死信
+func (s *DeadLetterStore) Delete(id string) error {
+	result, err := s.db.Exec("DELETE FROM dead_letters WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// Purge 清理死信，before为零值时清理全部
+func (s *DeadLetterStore) Purge(before time.Time) (int64, error) {
+	var result sql.Result
+	var err error
+	if before.IsZero() {
+		result, err = s.db.Exec("DELETE FROM dead_letters")
+	} else {
+		result, err = s.db.Exec("DELETE FROM dead_letters WHERE dead_at < ?", before)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge dead letters: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Count 返回死信总数
+func (s *DeadLetterStore) Count() (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM dead_letters").Scan(&count)
+	return count, err
+}
+
+// whereClause 构造查询条件
+func (f DeadLetterFilter) whereClause() (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if f.UserID != "" {
+		// target_users 是JSON数组，按带引号的用户ID匹配
+		conditions = append(conditions, "target_users LIKE ?")
+		args = append(args, "%\""+f.UserID+"\"%")
+	}
+	if f.Reason != "" {
+		// 原因形如 "max_retries_exceeded: all_users_failed"，按前缀匹配
+		conditions = append(conditions, "reason LIKE ?")
+		args = append(args, f.Reason+"%")
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// rowScanner 兼容 *sql.Row 和 *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDeadLetter 扫描一行死信
+func scanDeadLetter(row rowScanner) (*DeadLetter, error) {
+	dl := &DeadLetter{}
+	var messageID, channelID, users, reason sql.NullString
+	var payload string
+
+	if err := row.Scan(&dl.ID, &messageID, &channelID, &users, &reason, &dl.Attempts, &payload, &dl.DeadAt); err != nil {
+		return nil, err
+	}
+
+	dl.MessageID = messageID.String
+	dl.ChannelID = channelID.String
+	dl.Reason = reason.String
+	if users.Valid {
+		json.Unmarshal([]byte(users.String), &dl.TargetUsers)
+	}
+	if err := json.Unmarshal([]byte(payload), &dl.Task); err != nil {
+		return nil, fmt.Errorf("failed to decode dead letter task: %w", err)
+	}
+
+	return dl, nil
+}
@@ -0,0 +1,239 @@
+package delivery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Journal 投递预写日志
+// 任务在返回202之前写入日志，全部目标用户投递成功后删除，
+// 进程重启时由 DeliverySystem.Start 重放未完成的任务。
+type Journal struct {
+	db *sql.DB
+}
+
+// OpenJournal 打开（或创建）投递日志数据库
+func OpenJournal(path string) (*Journal, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal database: %w", err)
+	}
+
+	j := &Journal{db: db}
+	if err := j.init(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize journal: %w", err)
+	}
+
+	return j, nil
+}
+
+// init 初始化日志表结构
+func (j *Journal) init() error {
+	// 日志要求已提交的任务在崩溃后仍然存在，因此使用FULL同步模式
+	pragmas := []string{
+		"PRAGMA journal_mode=WAL",
+		"PRAGMA synchronous=FULL",
+	}
+	for _, pragma := range pragmas {
+		if _, err := j.db.Exec(pragma); err != nil {
+			return fmt.Errorf("failed to execute %s: %w", pragma, err)
+		}
+	}
+
+	createTables := `
+	CREATE TABLE IF NOT EXISTS journal_tasks (
+		id TEXT PRIMARY KEY,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		reason TEXT,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_journal_status ON journal_tasks(status, created_at);
+
+	CREATE TABLE IF NOT EXISTS journal_deliveries (
+		task_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		delivered_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (task_id, user_id)
+	);
+	`
+	_, err := j.db.Exec(createTables)
+	return err
+}
+
+// DB 返回日志底层数据库连接，供同一持久化文件中的其他组件使用
+func (j *Journal) DB() *sql.DB {
+	return j.db
+}
+
+// Append 写入一个待投递任务
+func (j *Journal) Append(task DeliveryTask) error {
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+
+	now := time.Now()
+	_, err = j.db.Exec(`
+		INSERT INTO journal_tasks (id, payload, status, created_at, updated_at)
+		VALUES (?, ?, 'pending', ?, ?)
+	`, task.ID, string(payload), now, now)
+	if err != nil {
+		return fmt.Errorf("failed to append task to journal: %w", err)
+	}
+
+	return nil
+}
+
+// MarkDelivered 记录任务已成功投递给某个用户
+func (j *Journal) MarkDelivered(taskID, userID string) error {
+	_, err := j.db.Exec(`
+		INSERT OR IGNORE INTO journal_deliveries (task_id, user_id, delivered_at)
+		VALUES (?, ?, ?)
+	`, taskID, userID, time.Now())
+	return err
+}
+
+// Complete 任务全部完成，从日志中删除
+func (j *Journal) Complete(taskID string) error {
+	return j.remove(taskID)
+}
+
+// Discard 撤销一个未被接受的任务（例如入队失败）
+func (j *Journal) Discard(taskID string) error {
+	return j.remove(taskID)
+}
+
+// Abandon 标记任务已放弃，重启时不再重放
+func (j *Journal) Abandon(taskID, reason string) error {
+	_, err := j.db.Exec(`
+		UPDATE journal_tasks SET status = 'abandoned', reason = ?, updated_at = ?
+		WHERE id = ?
+	`, reason, time.Now(), taskID)
+	return err
+}
+
+// remove 删除任务及其投递记录
+func (j *Journal) remove(taskID string) error {
+	tx, err := j.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM journal_deliveries WHERE task_id = ?", taskID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM journal_tasks WHERE id = ?", taskID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// LoadPending 加载所有未完成的任务，已投递成功的用户会从目标列表中剔除
+func (j *Journal) LoadPending() ([]DeliveryTask, error) {
+	rows, err := j.db.Query(`
+		SELECT id, payload FROM journal_tasks
+		WHERE status = 'pending'
+		ORDER BY created_at ASC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending tasks: %w", err)
+	}
+
+	var tasks []DeliveryTask
+	for rows.Next() {
+		var id, payload string
+		if err := rows.Scan(&id, &payload); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan journal task: %w", err)
+		}
+
+		var task DeliveryTask
+		if err := json.Unmarshal([]byte(payload), &task); err != nil {
+			// 无法解析的记录直接跳过，避免阻塞整个重放过程
+			continue
+		}
+		task.ID = id
+		tasks = append(tasks, task)
+	}
+	rows.Close()
+
+	for i := range tasks {
+		delivered, err := j.deliveredUsers(tasks[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		tasks[i].TargetUsers = remainingUsers(targetUsersOf(tasks[i]), delivered)
+	}
+
+	return tasks, nil
+}
+
+// PendingCount 返回未完成任务数量
+func (j *Journal) PendingCount() (int, error) {
+	var count int
+	err := j.db.QueryRow("SELECT COUNT(*) FROM journal_tasks WHERE status = 'pending'").Scan(&count)
+	return count, err
+}
+
+// deliveredUsers 查询任务已投递成功的用户
+func (j *Journal) deliveredUsers(taskID string) (map[string]bool, error) {
+	rows, err := j.db.Query("SELECT user_id FROM journal_deliveries WHERE task_id = ?", taskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query journal deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	delivered := make(map[string]bool)
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		delivered[userID] = true
+	}
+
+	return delivered, nil
+}
+
+// Close 关闭日志数据库
+func (j *Journal) Close() error {
+	return j.db.Close()
+}
+
+// targetUsersOf 获取任务的目标用户列表
+func targetUsersOf(task DeliveryTask) []string {
+	if len(task.TargetUsers) > 0 {
+		return task.TargetUsers
+	}
+	if task.Message != nil {
+		return []string{task.Message.UserID}
+	}
+	return nil
+}
+
+// remainingUsers 过滤掉已投递的用户
+func remainingUsers(users []string, delivered map[string]bool) []string {
+	remaining := make([]string, 0, len(users))
+	for _, userID := range users {
+		if !delivered[userID] {
+			remaining = append(remaining, userID)
+		}
+	}
+	return remaining
+}
@@ -0,0 +1,129 @@
+package delivery
+
+import (
+	"miemie/internal/models"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func journalTask(id string, users ...string) DeliveryTask {
+	return DeliveryTask{
+		ID:          id,
+		ChannelID:   "default",
+		Message:     &models.Message{ID: "msg-" + id, ChannelID: "default", Title: "title " + id, Content: "content"},
+		TargetUsers: users,
+		Priority:    5,
+		CreatedAt:   time.Now(),
+		Timeout:     30 * time.Second,
+	}
+}
+
+func TestJournalReplaysPendingTasksAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal", "delivery.db")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+
+	for _, task := range []DeliveryTask{
+		journalTask("t1", "alice", "bob", "carol"),
+		journalTask("t2", "alice"),
+		journalTask("t3", "dave"),
+		journalTask("t4", "erin"),
+	} {
+		if err := journal.Append(task); err != nil {
+			t.Fatalf("Append %s: %v", task.ID, err)
+		}
+		time.Sleep(time.Millisecond) // 保证 created_at 有先后
+	}
+
+	// t1 部分投递，t2 完成，t3 放弃，t4 未开始
+	if err := journal.MarkDelivered("t1", "bob"); err != nil {
+		t.Fatalf("MarkDelivered: %v", err)
+	}
+	if err := journal.MarkDelivered("t1", "bob"); err != nil {
+		t.Fatalf("MarkDelivered twice: %v", err)
+	}
+	if err := journal.MarkDelivered("t2", "alice"); err != nil {
+		t.Fatalf("MarkDelivered: %v", err)
+	}
+	if err := journal.Complete("t2"); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if err := journal.Abandon("t3", "expired"); err != nil {
+		t.Fatalf("Abandon: %v", err)
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// 模拟进程重启
+	journal, err = OpenJournal(path)
+	if err != nil {
+		t.Fatalf("reopen journal: %v", err)
+	}
+	defer journal.Close()
+
+	count, err := journal.PendingCount()
+	if err != nil {
+		t.Fatalf("PendingCount: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("PendingCount = %d, want 2", count)
+	}
+
+	pending, err := journal.LoadPending()
+	if err != nil {
+		t.Fatalf("LoadPending: %v", err)
+	}
+	if len(pending) != 2 {
+		t.Fatalf("LoadPending returned %d tasks, want 2", len(pending))
+	}
+	if pending[0].ID != "t1" || pending[1].ID != "t4" {
+		t.Fatalf("pending order = [%s %s], want [t1 t4]", pending[0].ID, pending[1].ID)
+	}
+	if !reflect.DeepEqual(pending[0].TargetUsers, []string{"alice", "carol"}) {
+		t.Fatalf("t1 remaining users = %v, want [alice carol]", pending[0].TargetUsers)
+	}
+	if pending[0].Message == nil || pending[0].Message.ID != "msg-t1" || pending[0].Message.Title != "title t1" {
+		t.Fatalf("t1 message not restored: %+v", pending[0].Message)
+	}
+	if pending[0].Timeout != 30*time.Second || pending[0].Priority != 5 {
+		t.Fatalf("t1 task fields not restored: %+v", pending[0])
+	}
+}
+
+func TestJournalReplaysMessageOwnerWithoutTargets(t *testing.T) {
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "delivery.db"))
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	defer journal.Close()
+
+	task := journalTask("t1")
+	task.Message.UserID = "alice"
+	if err := journal.Append(task); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	pending, err := journal.LoadPending()
+	if err != nil {
+		t.Fatalf("LoadPending: %v", err)
+	}
+	if len(pending) != 1 || !reflect.DeepEqual(pending[0].TargetUsers, []string{"alice"}) {
+		t.Fatalf("pending = %+v, want one task targeting alice", pending)
+	}
+
+	if err := journal.MarkDelivered("t1", "alice"); err != nil {
+		t.Fatalf("MarkDelivered: %v", err)
+	}
+	pending, err = journal.LoadPending()
+	if err != nil {
+		t.Fatalf("LoadPending: %v", err)
+	}
+	if len(pending) != 1 || len(pending[0].TargetUsers) != 0 {
+		t.Fatalf("pending = %+v, want task with no remaining users", pending)
+	}
+}
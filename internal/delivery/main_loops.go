@@ -10,11 +10,22 @@ import (
 func (ds *DeliverySystem) runMainLoop() {
 	logger.Info("Delivery system main loop started")
 	defer logger.Info("Delivery system main loop stopped")
+	defer ds.wg.Done()
 
 	for {
+		if ds.IsPaused() {
+			select {
+			case <-ds.ctx.Done():
+				return
+			case <-ds.resumed:
+			}
+			continue
+		}
+
 		select {
 		case <-ds.ctx.Done():
 			return
+		case <-ds.resumed:
 		case task := <-ds.inputChan:
 			// 将任务分发到优先级队列
 			if !ds.queueManager.DispatchTask(task) {
@@ -30,6 +41,7 @@ func (ds *DeliverySystem) runMainLoop() {
 func (ds *DeliverySystem) runQueueManager() {
 	logger.Info("Queue manager started")
 	defer logger.Info("Queue manager stopped")
+	defer ds.wg.Done()
 
 	ticker := time.NewTicker(1 * time.Second) // 1秒检查一次，减少日志频率
 	defer ticker.Stop()
@@ -47,6 +59,10 @@ func (ds *DeliverySystem) runQueueManager() {
 
 // processQueueBacklog 处理队列积压
 func (ds *DeliverySystem) processQueueBacklog() {
+	if ds.IsPaused() {
+		return
+	}
+
 	// 从优先级队列获取任务
 	for {
 		task, hasTask := ds.queueManager.GetNextTask()
@@ -88,6 +104,7 @@ func (ds *DeliverySystem) adjustWorkerCount() {
 func (ds *DeliverySystem) runRetryManager() {
 	logger.Info("Retry manager started")
 	defer logger.Info("Retry manager stopped")
+	defer ds.wg.Done()
 
 	retryWorker := NewRetryWorker(ds.retryManager, ds)
 
@@ -145,6 +162,7 @@ func (ds *DeliverySystem) dispatchToWorker(task DeliveryTask) {
 func (ds *DeliverySystem) runStatsCollector() {
 	logger.Info("Stats collector started")
 	defer logger.Info("Stats collector stopped")
+	defer ds.wg.Done()
 
 	ticker := time.NewTicker(10 * time.Second) // 每10秒收集一次统计
 	defer ticker.Stop()
@@ -179,4 +197,38 @@ func (ds *DeliverySystem) collectAndLogStats() {
 	logger.Infof("Backpressure: Reject=%d, Accept=%d, Rate=%.2f%%",
 		rejectionCount, acceptanceCount, rejectionRate*100)
 	logger.Infof("===============================")
-}
\ No newline at end of file
+}
+// receiptCleanupInterval 过期投递回执的清理间隔
+const receiptCleanupInterval = time.Hour
+
+// runReceiptCleaner 定期清理超过保留时间的投递回执，避免投递日志无限增长
+func (ds *DeliverySystem) runReceiptCleaner() {
+	logger.Info("Receipt cleaner started")
+	defer logger.Info("Receipt cleaner stopped")
+	defer ds.wg.Done()
+
+	ticker := time.NewTicker(receiptCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		ds.purgeExpiredReceipts()
+
+		select {
+		case <-ds.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeExpiredReceipts 清理一次过期的投递回执
+func (ds *DeliverySystem) purgeExpiredReceipts() {
+	purged, err := ds.receipts.Purge(time.Now().Add(-ds.config.ReceiptTTL))
+	if err != nil {
+		logger.Warnf("Failed to purge expired receipts: %v", err)
+		return
+	}
+	if purged > 0 {
+		logger.Infof("Purged %d expired delivery receipts", purged)
+	}
+}
@@ -0,0 +1,301 @@
+package delivery
+
+import (
+	"database/sql"
+	"fmt"
+	"miemie/internal/workspace"
+	"strings"
+	"time"
+)
+
+// 投递回执状态：queued → stored → pushed → read，或 dead
+const (
+	ReceiptQueued = "queued" // 已进入投递队列
+	ReceiptStored = "stored" // 已写入接收者工作空间
+	ReceiptPushed = "pushed" // 已推送给在线客户端
+	ReceiptRead   = "read"   // 接收者已读
+	ReceiptDead   = "dead"   // 投递失败（被拒绝或进入死信队列）
+)
+
+// receiptRank 状态顺序，回执只能向前推进
+var receiptRank = map[string]int{
+	ReceiptQueued: 1,
+	ReceiptStored: 2,
+	ReceiptPushed: 3,
+	ReceiptRead:   4,
+	ReceiptDead:   5,
+}
+
+// Receipt 单个接收者的投递回执
+type Receipt struct {
+	MessageID   string     `json:"message_id"`
+	UserID      string     `json:"user_id"`
+	State       string     `json:"state"`
+	SubmittedBy string     `json:"submitted_by,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	QueuedAt    *time.Time `json:"queued_at,omitempty"`
+	StoredAt    *time.Time `json:"stored_at,omitempty"`
+	PushedAt    *time.Time `json:"pushed_at,omitempty"`
+	ReadAt      *time.Time `json:"read_at,omitempty"`
+	DeadAt      *time.Time `json:"dead_at,omitempty"`
+	AckedAt     *time.Time `json:"acked_at,omitempty"`     // 客户端确认收到的时间
+	AckedDevice string     `json:"acked_device,omitempty"` // 确认收到的设备
+	Attempts    int        `json:"attempts"`               // 进入投递队列的次数，死信重放后增加
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CallbackURL string     `json:"-"`
+}
+
+// ReceiptStore 投递回执存储，与投递日志共用同一数据库
+type ReceiptStore struct {
+	db *sql.DB
+}
+
+// NewReceiptStore 创建投递回执存储
+func NewReceiptStore(db *sql.DB) (*ReceiptStore, error) {
+	createTable := `
+	CREATE TABLE IF NOT EXISTS delivery_receipts (
+		message_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		state TEXT NOT NULL,
+		state_rank INTEGER NOT NULL,
+		submitted_by TEXT,
+		callback_url TEXT,
+		error TEXT,
+		queued_at DATETIME,
+		stored_at DATETIME,
+		pushed_at DATETIME,
+		read_at DATETIME,
+		dead_at DATETIME,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (message_id, user_id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_receipts_updated ON delivery_receipts(updated_at);
+	`
+	if _, err := db.Exec(createTable); err != nil {
+		return nil, fmt.Errorf("failed to create receipt table: %w", err)
+	}
+
+	// 旧版本的回执表没有客户端确认和投递次数字段
+	for _, column := range []string{"acked_at DATETIME", "acked_device TEXT", "attempts INTEGER DEFAULT 1"} {
+		if err := workspace.AddColumnIfMissing(db, "delivery_receipts", column); err != nil {
+			return nil, err
+		}
+	}
+
+	return &ReceiptStore{db: db}, nil
+}
+
+// Queue 为一批接收者创建 queued 状态的回执
+func (s *ReceiptStore) Queue(messageID, submittedBy, callbackURL string, users []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT OR IGNORE INTO delivery_receipts
+			(message_id, user_id, state, state_rank, submitted_by, callback_url, queued_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now()
+	for _, userID := range users {
+		if _, err := stmt.Exec(messageID, userID, ReceiptQueued, receiptRank[ReceiptQueued],
+			submittedBy, callbackURL, now, now); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to queue receipt: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Advance 推进回执状态，返回状态是否发生变化
+// 已读和投递失败之间互斥：dead 只能从 queued 进入
+func (s *ReceiptStore) Advance(messageID, userID, state, errMsg string) (*Receipt, bool, error) {
+	rank, ok := receiptRank[state]
+	if !ok {
+		return nil, false, fmt.Errorf("unknown receipt state: %s", state)
+	}
+
+	maxRank := rank - 1
+	if state == ReceiptDead {
+		maxRank = receiptRank[ReceiptQueued]
+	}
+
+	now := time.Now()
+	query := fmt.Sprintf(`
+		UPDATE delivery_receipts
+		SET state = ?, state_rank = ?, error = ?, %s_at = ?, updated_at = ?
+		WHERE message_id = ? AND user_id = ? AND state_rank <= ?
+	`, state)
+
+	result, err := s.db.Exec(query, state, rank, errMsg, now, now, messageID, userID, maxRank)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to advance receipt: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, false, nil
+	}
+
+	receipt, err := s.get(messageID, userID)
+	if err != nil {
+		return nil, true, err
+	}
+	return receipt, true, nil
+}
+
+// Pending 筛选出接收者还可以推进到 state 的回执对应的消息ID，只读查询，没有回执的消息不会出现在结果中
+func (s *ReceiptStore) Pending(userID string, messageIDs []string, state string) ([]string, error) {
+	if len(messageIDs) == 0 {
+		return nil, nil
+	}
+
+	args := []interface{}{userID, receiptRank[state]}
+	for _, messageID := range messageIDs {
+		args = append(args, messageID)
+	}
+	rows, err := s.db.Query(`
+		SELECT message_id FROM delivery_receipts
+		WHERE user_id = ? AND state_rank < ? AND message_id IN (?`+strings.Repeat(", ?", len(messageIDs)-1)+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending receipts: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []string
+	for rows.Next() {
+		var messageID string
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, err
+		}
+		pending = append(pending, messageID)
+	}
+	return pending, rows.Err()
+}
+
+// Purge 清理 before 之前最后更新的回执，仍在投递队列中（queued）的回执保留
+func (s *ReceiptStore) Purge(before time.Time) (int64, error) {
+	result, err := s.db.Exec(
+		"DELETE FROM delivery_receipts WHERE updated_at < ? AND state_rank > ?",
+		before, receiptRank[ReceiptQueued])
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge receipts: %w", err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Requeue 死信重放前把接收者的 dead 回执重置为 queued，清除错误并增加投递次数，返回重置的回执数
+func (s *ReceiptStore) Requeue(messageID string, userIDs []string) (int, error) {
+	if len(userIDs) == 0 {
+		return 0, nil
+	}
+
+	now := time.Now()
+	args := []interface{}{ReceiptQueued, receiptRank[ReceiptQueued], now, now, messageID, ReceiptDead}
+	for _, userID := range userIDs {
+		args = append(args, userID)
+	}
+	result, err := s.db.Exec(`
+		UPDATE delivery_receipts
+		SET state = ?, state_rank = ?, error = NULL, dead_at = NULL, queued_at = ?, updated_at = ?,
+			attempts = COALESCE(attempts, 1) + 1
+		WHERE message_id = ? AND state = ? AND user_id IN (?`+strings.Repeat(", ?", len(userIDs)-1)+`)
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue receipts: %w", err)
+	}
+
+	affected, _ := result.RowsAffected()
+	return int(affected), nil
+}
+
+// Ack 记录客户端确认收到，只保留第一次确认的时间和设备
+func (s *ReceiptStore) Ack(messageID, userID, deviceID string) (bool, error) {
+	now := time.Now()
+	result, err := s.db.Exec(`
+		UPDATE delivery_receipts
+		SET acked_at = ?, acked_device = ?, updated_at = ?
+		WHERE message_id = ? AND user_id = ? AND acked_at IS NULL
+	`, now, deviceID, now, messageID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to ack receipt: %w", err)
+	}
+
+	affected, _ := result.RowsAffected()
+	return affected > 0, nil
+}
+
+// List 获取消息所有接收者的回执
+func (s *ReceiptStore) List(messageID string) ([]*Receipt, error) {
+	rows, err := s.db.Query(receiptSelect+" WHERE message_id = ? ORDER BY user_id", messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query receipts: %w", err)
+	}
+	defer rows.Close()
+
+	var receipts []*Receipt
+	for rows.Next() {
+		receipt, err := scanReceipt(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan receipt: %w", err)
+		}
+		receipts = append(receipts, receipt)
+	}
+
+	return receipts, nil
+}
+
+// get 获取单个接收者的回执
+func (s *ReceiptStore) get(messageID, userID string) (*Receipt, error) {
+	row := s.db.QueryRow(receiptSelect+" WHERE message_id = ? AND user_id = ?", messageID, userID)
+	return scanReceipt(row)
+}
+
+const receiptSelect = `
+	SELECT message_id, user_id, state, submitted_by, callback_url, error,
+		queued_at, stored_at, pushed_at, read_at, dead_at, acked_at, acked_device, attempts, updated_at
+	FROM delivery_receipts`
+
+// scanReceipt 扫描一行回执
+func scanReceipt(row rowScanner) (*Receipt, error) {
+	r := &Receipt{}
+	var submittedBy, callbackURL, errMsg, ackedDevice sql.NullString
+	var queuedAt, storedAt, pushedAt, readAt, deadAt, ackedAt sql.NullTime
+	var attempts sql.NullInt64
+
+	err := row.Scan(&r.MessageID, &r.UserID, &r.State, &submittedBy, &callbackURL, &errMsg,
+		&queuedAt, &storedAt, &pushedAt, &readAt, &deadAt, &ackedAt, &ackedDevice, &attempts, &r.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	r.SubmittedBy = submittedBy.String
+	r.CallbackURL = callbackURL.String
+	r.Error = errMsg.String
+	r.QueuedAt = nullTimePtr(queuedAt)
+	r.StoredAt = nullTimePtr(storedAt)
+	r.PushedAt = nullTimePtr(pushedAt)
+	r.ReadAt = nullTimePtr(readAt)
+	r.DeadAt = nullTimePtr(deadAt)
+	r.AckedAt = nullTimePtr(ackedAt)
+	r.AckedDevice = ackedDevice.String
+	r.Attempts = int(attempts.Int64)
+
+	return r, nil
+}
+
+// nullTimePtr 将可空时间转换为指针
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
@@ -0,0 +1,213 @@
+package delivery
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestReceiptStore(t *testing.T) *ReceiptStore {
+	t.Helper()
+	journal, err := OpenJournal(filepath.Join(t.TempDir(), "delivery.db"))
+	if err != nil {
+		t.Fatalf("OpenJournal: %v", err)
+	}
+	t.Cleanup(func() { journal.Close() })
+
+	store, err := NewReceiptStore(journal.DB())
+	if err != nil {
+		t.Fatalf("NewReceiptStore: %v", err)
+	}
+	// 再次创建时字段迁移不能失败
+	if _, err := NewReceiptStore(journal.DB()); err != nil {
+		t.Fatalf("NewReceiptStore on existing table: %v", err)
+	}
+	return store
+}
+
+func advance(t *testing.T, store *ReceiptStore, userID, state string, wantChanged bool) *Receipt {
+	t.Helper()
+	receipt, changed, err := store.Advance("m1", userID, state, "")
+	if err != nil {
+		t.Fatalf("Advance(%s, %s): %v", userID, state, err)
+	}
+	if changed != wantChanged {
+		t.Fatalf("Advance(%s, %s) changed = %v, want %v", userID, state, changed, wantChanged)
+	}
+	if changed && receipt.State != state {
+		t.Fatalf("Advance(%s, %s) state = %s", userID, state, receipt.State)
+	}
+	return receipt
+}
+
+func receiptOf(t *testing.T, store *ReceiptStore, userID string) *Receipt {
+	t.Helper()
+	receipt, err := store.get("m1", userID)
+	if err != nil {
+		t.Fatalf("get receipt %s: %v", userID, err)
+	}
+	return receipt
+}
+
+func TestReceiptStateOnlyMovesForward(t *testing.T) {
+	store := newTestReceiptStore(t)
+	if err := store.Queue("m1", "sender:ci", "https://example.com/hook", []string{"alice", "bob"}); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	// 重复入队不会重置已有回执
+	advance(t, store, "alice", ReceiptStored, true)
+	if err := store.Queue("m1", "sender:ci", "", []string{"alice"}); err != nil {
+		t.Fatalf("Queue again: %v", err)
+	}
+	if got := receiptOf(t, store, "alice"); got.State != ReceiptStored || got.CallbackURL != "https://example.com/hook" {
+		t.Fatalf("receipt after second Queue = %+v", got)
+	}
+
+	advance(t, store, "alice", ReceiptPushed, true)
+	advance(t, store, "alice", ReceiptStored, false)
+	advance(t, store, "alice", ReceiptPushed, false)
+	receipt := advance(t, store, "alice", ReceiptRead, true)
+	if receipt.QueuedAt == nil || receipt.StoredAt == nil || receipt.PushedAt == nil || receipt.ReadAt == nil {
+		t.Fatalf("timestamps not recorded: %+v", receipt)
+	}
+	if receipt.SubmittedBy != "sender:ci" || receipt.Attempts != 1 {
+		t.Fatalf("receipt = %+v, want submitted_by sender:ci and 1 attempt", receipt)
+	}
+
+	// 离线用户可以直接从 queued 跳到 read
+	advance(t, store, "bob", ReceiptRead, true)
+
+	if _, _, err := store.Advance("m1", "alice", "delivered", ""); err == nil {
+		t.Fatalf("Advance with unknown state succeeded")
+	}
+	if _, changed, err := store.Advance("m1", "nobody", ReceiptStored, ""); err != nil || changed {
+		t.Fatalf("Advance for unknown recipient = %v, %v", changed, err)
+	}
+}
+
+func TestReceiptDeadOnlyFromQueued(t *testing.T) {
+	store := newTestReceiptStore(t)
+	if err := store.Queue("m1", "", "", []string{"alice", "bob"}); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+
+	advance(t, store, "alice", ReceiptStored, true)
+	advance(t, store, "alice", ReceiptDead, false)
+
+	receipt, changed, err := store.Advance("m1", "bob", ReceiptDead, "workspace unavailable")
+	if err != nil || !changed {
+		t.Fatalf("Advance bob dead = %v, %v", changed, err)
+	}
+	if receipt.Error != "workspace unavailable" || receipt.DeadAt == nil {
+		t.Fatalf("dead receipt = %+v", receipt)
+	}
+
+	// dead 之后不会再被推进
+	advance(t, store, "bob", ReceiptStored, false)
+	advance(t, store, "bob", ReceiptRead, false)
+}
+
+func TestReceiptRequeueDeadLetter(t *testing.T) {
+	store := newTestReceiptStore(t)
+	if err := store.Queue("m1", "", "", []string{"alice", "bob", "carol"}); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	advance(t, store, "alice", ReceiptStored, true)
+	if _, _, err := store.Advance("m1", "bob", ReceiptDead, "timeout"); err != nil {
+		t.Fatalf("Advance dead: %v", err)
+	}
+	if _, _, err := store.Advance("m1", "carol", ReceiptDead, "timeout"); err != nil {
+		t.Fatalf("Advance dead: %v", err)
+	}
+
+	// 只重置 dead 的回执
+	n, err := store.Requeue("m1", []string{"alice", "bob"})
+	if err != nil {
+		t.Fatalf("Requeue: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("Requeue reset %d receipts, want 1", n)
+	}
+
+	bob := receiptOf(t, store, "bob")
+	if bob.State != ReceiptQueued || bob.Error != "" || bob.DeadAt != nil || bob.Attempts != 2 {
+		t.Fatalf("requeued receipt = %+v, want queued without error on attempt 2", bob)
+	}
+	if alice := receiptOf(t, store, "alice"); alice.State != ReceiptStored || alice.Attempts != 1 {
+		t.Fatalf("alice receipt = %+v, want stored on attempt 1", alice)
+	}
+	if carol := receiptOf(t, store, "carol"); carol.State != ReceiptDead {
+		t.Fatalf("carol receipt = %+v, want dead", carol)
+	}
+
+	// 重放后的投递可以继续推进
+	advance(t, store, "bob", ReceiptStored, true)
+
+	if n, err := store.Requeue("m1", nil); err != nil || n != 0 {
+		t.Fatalf("Requeue without users = %d, %v", n, err)
+	}
+}
+
+func TestReceiptAckKeepsFirstDevice(t *testing.T) {
+	store := newTestReceiptStore(t)
+	if err := store.Queue("m1", "", "", []string{"alice"}); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+
+	if acked, err := store.Ack("m1", "alice", "phone"); err != nil || !acked {
+		t.Fatalf("first Ack = %v, %v", acked, err)
+	}
+	if acked, err := store.Ack("m1", "alice", "laptop"); err != nil || acked {
+		t.Fatalf("second Ack = %v, %v", acked, err)
+	}
+	if receipt := receiptOf(t, store, "alice"); receipt.AckedDevice != "phone" || receipt.AckedAt == nil {
+		t.Fatalf("acked receipt = %+v", receipt)
+	}
+}
+
+func TestReceiptPendingSkipsMessagesWithoutReceipts(t *testing.T) {
+	store := newTestReceiptStore(t)
+	if err := store.Queue("m1", "sender:ci", "", []string{"alice", "bob"}); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	advance(t, store, "bob", ReceiptRead, true)
+
+	pending, err := store.Pending("alice", []string{"m1", "m2"}, ReceiptRead)
+	if err != nil {
+		t.Fatalf("Pending: %v", err)
+	}
+	if len(pending) != 1 || pending[0] != "m1" {
+		t.Fatalf("Pending(alice) = %v, want [m1]", pending)
+	}
+	// 已经读过的回执不需要再推进
+	if pending, err := store.Pending("bob", []string{"m1"}, ReceiptRead); err != nil || len(pending) != 0 {
+		t.Fatalf("Pending(bob) = %v, %v, want none", pending, err)
+	}
+}
+
+func TestReceiptPurgeKeepsQueued(t *testing.T) {
+	store := newTestReceiptStore(t)
+	if err := store.Queue("m1", "sender:ci", "", []string{"alice", "bob"}); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	advance(t, store, "alice", ReceiptStored, true)
+
+	purged, err := store.Purge(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Purge: %v", err)
+	}
+	if purged != 1 {
+		t.Fatalf("purged = %d, want 1", purged)
+	}
+	receipts, err := store.List("m1")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(receipts) != 1 || receipts[0].UserID != "bob" {
+		t.Fatalf("remaining receipts = %+v, want only bob's queued receipt", receipts)
+	}
+
+	if purged, err := store.Purge(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Fatalf("Purge(older) = %d, %v, want nothing purged", purged, err)
+	}
+}
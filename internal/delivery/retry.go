@@ -147,7 +147,9 @@ func (rw *RetryWorker) processRetries(ctx context.Context) {
 			// 工作队列满了，任务重新排队
 			go func(task RetryTask) {
 				time.Sleep(100 * time.Millisecond)
-				rw.retryManager.ScheduleRetry(task.OriginalTask, "worker_queue_full")
+				if !rw.retryManager.ScheduleRetry(task.OriginalTask, "worker_queue_full") {
+					rw.system.deadLetter(task.OriginalTask, "worker_queue_full")
+				}
 			}(retryTask)
 		}
 	}
@@ -0,0 +1,280 @@
+package delivery
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"miemie/internal/logger"
+	"time"
+)
+
+var (
+	// ErrScheduledNotFound 定时消息不存在或已经投递
+	ErrScheduledNotFound = errors.New("scheduled message not found")
+	// ErrSchedulingDisabled 未启用投递日志时不支持定时投递
+	ErrSchedulingDisabled = errors.New("scheduled delivery not enabled")
+)
+
+const (
+	scheduleInterval  = time.Second // 检查到期任务的间隔
+	scheduleBatchSize = 100         // 每次最多释放的到期任务数
+)
+
+// ScheduledMessage 等待投递的定时消息，群发消息由多个任务组成
+type ScheduledMessage struct {
+	MessageID   string    `json:"message_id"`
+	ChannelID   string    `json:"channel_id"`
+	Title       string    `json:"title"`
+	SubmittedBy string    `json:"submitted_by"`
+	Recipients  []string  `json:"recipients"`
+	DeliverAt   time.Time `json:"deliver_at"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+}
+
+// ScheduleStore 定时任务存储，与投递日志共用同一数据库
+// 任务到期前保存在这里，不写入投递日志，到期后按普通任务提交
+type ScheduleStore struct {
+	db *sql.DB
+}
+
+// NewScheduleStore 创建定时任务存储
+func NewScheduleStore(db *sql.DB) (*ScheduleStore, error) {
+	createTable := `
+	CREATE TABLE IF NOT EXISTS scheduled_tasks (
+		id TEXT PRIMARY KEY,
+		message_id TEXT NOT NULL,
+		submitted_by TEXT,
+		deliver_at DATETIME NOT NULL,
+		task TEXT NOT NULL,
+		scheduled_at DATETIME NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_tasks_deliver_at ON scheduled_tasks(deliver_at);
+	CREATE INDEX IF NOT EXISTS idx_scheduled_tasks_submitter ON scheduled_tasks(submitted_by, message_id);
+	`
+	if _, err := db.Exec(createTable); err != nil {
+		return nil, fmt.Errorf("failed to create scheduled task table: %w", err)
+	}
+
+	return &ScheduleStore{db: db}, nil
+}
+
+// Add 保存定时任务
+func (s *ScheduleStore) Add(task DeliveryTask) error {
+	payload, err := json.Marshal(task)
+	if err != nil {
+		return fmt.Errorf("failed to encode task: %w", err)
+	}
+
+	messageID := ""
+	if task.Message != nil {
+		messageID = task.Message.ID
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO scheduled_tasks (id, message_id, submitted_by, deliver_at, task, scheduled_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, task.ID, messageID, task.SubmittedBy, task.NotBefore.UTC(), string(payload), time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to schedule task: %w", err)
+	}
+	return nil
+}
+
+// Due 按投递时间顺序返回已到期的任务
+func (s *ScheduleStore) Due(now time.Time, limit int) ([]DeliveryTask, error) {
+	rows, err := s.db.Query(`
+		SELECT task FROM scheduled_tasks
+		WHERE deliver_at <= ?
+		ORDER BY deliver_at ASC
+		LIMIT ?
+	`, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query due tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []DeliveryTask
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload); err != nil {
+			return nil, err
+		}
+		var task DeliveryTask
+		if err := json.Unmarshal([]byte(payload), &task); err != nil {
+			return nil, fmt.Errorf("failed to decode scheduled task: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, rows.Err()
+}
+
+// Remove 删除已释放的任务
+func (s *ScheduleStore) Remove(id string) error {
+	if _, err := s.db.Exec("DELETE FROM scheduled_tasks WHERE id = ?", id); err != nil {
+		return fmt.Errorf("failed to remove scheduled task: %w", err)
+	}
+	return nil
+}
+
+// List 按投递时间分页列出提交者的定时消息
+func (s *ScheduleStore) List(submittedBy string, limit, offset int) ([]*ScheduledMessage, int, error) {
+	var total int
+	err := s.db.QueryRow(`
+		SELECT COUNT(DISTINCT message_id) FROM scheduled_tasks WHERE submitted_by = ?
+	`, submittedBy).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count scheduled messages: %w", err)
+	}
+
+	rows, err := s.db.Query(`
+		SELECT message_id, task, scheduled_at FROM scheduled_tasks
+		WHERE submitted_by = ? AND message_id IN (
+			SELECT message_id FROM scheduled_tasks WHERE submitted_by = ?
+			GROUP BY message_id
+			ORDER BY MIN(deliver_at) ASC, message_id ASC
+			LIMIT ? OFFSET ?
+		)
+		ORDER BY deliver_at ASC, message_id ASC
+	`, submittedBy, submittedBy, limit, offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query scheduled messages: %w", err)
+	}
+	defer rows.Close()
+
+	// 同一消息的多个任务合并为一条
+	var messages []*ScheduledMessage
+	byID := make(map[string]*ScheduledMessage)
+	for rows.Next() {
+		var messageID, payload string
+		var scheduledAt time.Time
+		if err := rows.Scan(&messageID, &payload, &scheduledAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan scheduled task: %w", err)
+		}
+		var task DeliveryTask
+		if err := json.Unmarshal([]byte(payload), &task); err != nil {
+			return nil, 0, fmt.Errorf("failed to decode scheduled task: %w", err)
+		}
+
+		sm, exists := byID[messageID]
+		if !exists {
+			sm = &ScheduledMessage{
+				MessageID:   messageID,
+				ChannelID:   task.ChannelID,
+				SubmittedBy: task.SubmittedBy,
+				Recipients:  []string{},
+				DeliverAt:   task.NotBefore,
+				ScheduledAt: scheduledAt,
+			}
+			if task.Message != nil {
+				sm.Title = task.Message.Title
+			}
+			byID[messageID] = sm
+			messages = append(messages, sm)
+		}
+		sm.Recipients = append(sm.Recipients, targetUsersOf(task)...)
+	}
+
+	return messages, total, rows.Err()
+}
+
+// Cancel 删除提交者的定时消息，返回被取消的任务和提交时间
+func (s *ScheduleStore) Cancel(submittedBy, messageID string) ([]DeliveryTask, time.Time, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT task, scheduled_at FROM scheduled_tasks WHERE submitted_by = ? AND message_id = ?
+	`, submittedBy, messageID)
+	if err != nil {
+		tx.Rollback()
+		return nil, time.Time{}, fmt.Errorf("failed to query scheduled message: %w", err)
+	}
+	var tasks []DeliveryTask
+	var scheduledAt time.Time
+	for rows.Next() {
+		var payload string
+		if err := rows.Scan(&payload, &scheduledAt); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, time.Time{}, err
+		}
+		var task DeliveryTask
+		if err := json.Unmarshal([]byte(payload), &task); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, time.Time{}, fmt.Errorf("failed to decode scheduled task: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	rows.Close()
+
+	if len(tasks) == 0 {
+		tx.Rollback()
+		return nil, time.Time{}, ErrScheduledNotFound
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM scheduled_tasks WHERE submitted_by = ? AND message_id = ?
+	`, submittedBy, messageID); err != nil {
+		tx.Rollback()
+		return nil, time.Time{}, fmt.Errorf("failed to cancel scheduled message: %w", err)
+	}
+
+	return tasks, scheduledAt, tx.Commit()
+}
+
+// runScheduler 定期把到期的定时任务提交到投递入口
+func (ds *DeliverySystem) runScheduler() {
+	logger.Info("Delivery scheduler started")
+	defer logger.Info("Delivery scheduler stopped")
+	defer ds.wg.Done()
+
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ds.ctx.Done():
+			return
+		case <-ticker.C:
+			ds.releaseDueTasks()
+		}
+	}
+}
+
+// releaseDueTasks 提交到期的定时任务
+// 先提交（写入投递日志）再删除定时记录，中途重启时任务可能被重复提交，工作空间按消息ID幂等写入
+func (ds *DeliverySystem) releaseDueTasks() {
+	tasks, err := ds.scheduler.Due(time.Now(), scheduleBatchSize)
+	if err != nil {
+		logger.Warnf("Failed to load due scheduled tasks: %v", err)
+		return
+	}
+
+	for _, task := range tasks {
+		// 与重放死信一样使用新的任务ID，重复释放的任务不会与日志中的记录冲突
+		scheduledID := task.ID
+		task.ID = generateTaskID()
+		// 超时从实际提交时开始计算
+		task.CreatedAt = time.Now()
+		task.Replayed = true
+		if task.Message != nil {
+			// 消息时间为计划投递时间，折叠替换等按这个时间比较新旧
+			task.Message.CreatedAt = task.NotBefore
+			task.Message.UpdatedAt = task.NotBefore
+		}
+
+		if err := ds.SubmitTask(task); err != nil {
+			// 背压或队列已满时留到下一轮
+			logger.Warnf("Failed to release scheduled task %s, will retry: %v", scheduledID, err)
+			return
+		}
+		if err := ds.scheduler.Remove(scheduledID); err != nil {
+			logger.Warnf("Scheduled task %s released as %s but could not be removed: %v", scheduledID, task.ID, err)
+		}
+		logger.Infof("Scheduled task %s released as task %s", scheduledID, task.ID)
+	}
+}
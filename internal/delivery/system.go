@@ -12,6 +12,8 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // DeliverySystem 消息投递系统
@@ -22,6 +24,12 @@ type DeliverySystem struct {
 	queueManager *QueueManager        // 队列管理器
 	retryManager *RetryManager        // 重试管理器
 	backpressure *BackpressureCtrl    // 背压控制
+	journal      *Journal             // 投递预写日志（未启用时为nil）
+	deadLetters  *DeadLetterStore     // 死信存储（未启用投递日志时为nil）
+	receipts     *ReceiptStore        // 投递回执（未启用投递日志时为nil）
+	scheduler    *ScheduleStore       // 定时任务（未启用投递日志时为nil）
+	webhook      *WebhookNotifier     // 投递状态回调（未启用时为nil）
+	callbacks    *CallbackGuard       // 回调地址检查
 
 	// 配置
 	config DeliveryConfig
@@ -32,6 +40,8 @@ type DeliverySystem struct {
 	wg         sync.WaitGroup
 	stats      DeliveryStats
 	statsMutex sync.RWMutex
+	paused     int32         // 暂停时任务留在入口队列，不再分发给邮递员
+	resumed    chan struct{} // 恢复投递时唤醒主循环
 
 	// 外部依赖
 	workspaceManager *workspace.Manager
@@ -42,11 +52,21 @@ type DeliverySystem struct {
 type DeliveryConfig struct {
 	WorkerCount      int           // 邮递员数量
 	QueueLimit       int           // 队列长度限制
-	RateLimit        int           // 每秒速率限制
 	TaskTimeout      time.Duration // 任务超时时间
 	MaxRetries       int           // 最大重试次数
 	RetryBackoffBase time.Duration // 重试退避基数
 	RetryBackoffMax  time.Duration // 重试退避最大值
+	JournalPath      string        // 投递日志路径（为空表示不启用）
+	ReceiptTTL       time.Duration // 投递回执保留时间（0 表示不清理）
+	WebhookEnabled   bool          // 是否启用投递状态回调
+	WebhookTimeout   time.Duration // 回调请求超时时间
+	WebhookAttempts  int           // 回调最大尝试次数
+	WebhookWorkers   int           // 回调发送协程数
+	WebhookQueueSize int           // 回调等待队列长度，满时丢弃
+	WebhookAllowed   []string      // 允许回调的内部主机名、IP 或网段
+
+	ChannelAutoCreate string // 频道不存在时的处理方式（为空时自动创建）
+	MaxChannels       int    // 每用户最大频道数，自动创建频道时检查
 }
 
 // NewDeliverySystem 创建新的投递系统
@@ -69,17 +89,27 @@ func NewDeliverySystemWithConfig(workspaceManager *workspace.Manager, wsManager
 		config = DeliveryConfig{
 			WorkerCount:      workerCount,
 			QueueLimit:       cfg.Delivery.Queue.EntrySize,
-			RateLimit:        1000, // 这个值可以后续从配置中添加
 			TaskTimeout:      cfg.Delivery.GetTaskTimeout(),
 			MaxRetries:       cfg.Delivery.Task.MaxRetries,
 			RetryBackoffBase: cfg.Delivery.GetRetryBackoffBase(),
 			RetryBackoffMax:  cfg.Delivery.GetRetryBackoffMax(),
 		}
+		if cfg.Delivery.Journal.Enabled {
+			config.JournalPath = cfg.Delivery.Journal.Path
+			config.ReceiptTTL = cfg.Delivery.Journal.GetReceiptTTL()
+		}
+		config.WebhookEnabled = cfg.Delivery.Webhook.Enabled
+		config.WebhookTimeout = cfg.Delivery.Webhook.GetTimeout()
+		config.WebhookAttempts = cfg.Delivery.Webhook.MaxAttempts
+		config.WebhookWorkers = cfg.Delivery.Webhook.Workers
+		config.WebhookQueueSize = cfg.Delivery.Webhook.QueueSize
+		config.WebhookAllowed = cfg.Delivery.Webhook.AllowedHosts
+		config.ChannelAutoCreate = cfg.User.ChannelAutoCreate
+		config.MaxChannels = cfg.User.MaxChannels
 	} else {
 		config = DeliveryConfig{
 			WorkerCount:      runtime.NumCPU(), // 默认使用CPU核心数
 			QueueLimit:       10000,
-			RateLimit:        1000,
 			TaskTimeout:      30 * time.Second,
 			MaxRetries:       3,
 			RetryBackoffBase: 100 * time.Millisecond,
@@ -91,9 +121,11 @@ func NewDeliverySystemWithConfig(workspaceManager *workspace.Manager, wsManager
 		ctx:              ctx,
 		cancel:           cancel,
 		inputChan:        make(chan DeliveryTask, config.QueueLimit),
+		resumed:          make(chan struct{}, 1),
 		workspaceManager: workspaceManager,
 		wsManager:        wsManager,
 		config:           config,
+		callbacks:        NewCallbackGuard(config.WebhookAllowed),
 	}
 
 	// 初始化各个组件
@@ -109,6 +141,43 @@ func NewDeliverySystemWithConfig(workspaceManager *workspace.Manager, wsManager
 func (ds *DeliverySystem) Start() error {
 	logger.Infof("Starting delivery system with %d workers", ds.config.WorkerCount)
 
+	// 打开投递日志并加载未完成的任务
+	var pending []DeliveryTask
+	if ds.config.JournalPath != "" {
+		journal, err := OpenJournal(ds.config.JournalPath)
+		if err != nil {
+			return fmt.Errorf("failed to open delivery journal: %w", err)
+		}
+		ds.journal = journal
+
+		deadLetters, err := NewDeadLetterStore(journal.DB())
+		if err != nil {
+			return fmt.Errorf("failed to open dead letter store: %w", err)
+		}
+		ds.deadLetters = deadLetters
+
+		receipts, err := NewReceiptStore(journal.DB())
+		if err != nil {
+			return fmt.Errorf("failed to open receipt store: %w", err)
+		}
+		ds.receipts = receipts
+
+		scheduler, err := NewScheduleStore(journal.DB())
+		if err != nil {
+			return fmt.Errorf("failed to open schedule store: %w", err)
+		}
+		ds.scheduler = scheduler
+		if ds.config.WebhookEnabled {
+			ds.webhook = NewWebhookNotifier(ds.config.WebhookTimeout, ds.config.WebhookAttempts,
+				ds.config.WebhookWorkers, ds.config.WebhookQueueSize, ds.callbacks)
+		}
+
+		pending, err = journal.LoadPending()
+		if err != nil {
+			return fmt.Errorf("failed to load pending tasks from journal: %w", err)
+		}
+	}
+
 	// 启动队列管理器
 	ds.wg.Add(1)
 	go ds.runQueueManager()
@@ -125,10 +194,62 @@ func (ds *DeliverySystem) Start() error {
 	ds.wg.Add(1)
 	go ds.runStatsCollector()
 
+	// 启动定时投递调度
+	if ds.scheduler != nil {
+		ds.wg.Add(1)
+		go ds.runScheduler()
+	}
+
+	// 定期清理过期的投递回执
+	if ds.receipts != nil && ds.config.ReceiptTTL > 0 {
+		ds.wg.Add(1)
+		go ds.runReceiptCleaner()
+	}
+
+	// 重放日志中未完成的任务
+	if len(pending) > 0 {
+		ds.wg.Add(1)
+		go ds.replayPending(pending)
+	}
+
 	logger.Info("Delivery system started successfully")
 	return nil
 }
 
+// replayPending 将日志中未完成的任务重新放入投递入口
+func (ds *DeliverySystem) replayPending(tasks []DeliveryTask) {
+	defer ds.wg.Done()
+
+	logger.Infof("Replaying %d pending tasks from delivery journal", len(tasks))
+
+	replayed := 0
+	for _, task := range tasks {
+		if len(task.TargetUsers) == 0 {
+			// 所有用户都已投递，只差完成标记
+			ds.completeTask(task.ID)
+			continue
+		}
+
+		// 重置创建时间，避免重放的任务被当作超时任务
+		task.CreatedAt = time.Now()
+		task.Replayed = true
+		if task.Timeout == 0 {
+			task.Timeout = ds.config.TaskTimeout
+		}
+
+		select {
+		case ds.inputChan <- task:
+			atomic.AddInt64(&ds.stats.TotalReceived, 1)
+			replayed++
+		case <-ds.ctx.Done():
+			logger.Infof("Journal replay interrupted after %d tasks", replayed)
+			return
+		}
+	}
+
+	logger.Infof("Journal replay finished, %d tasks requeued", replayed)
+}
+
 // Stop 停止投递系统
 func (ds *DeliverySystem) Stop() error {
 	logger.Info("Stopping delivery system...")
@@ -144,6 +265,14 @@ func (ds *DeliverySystem) Stop() error {
 
 	select {
 	case <-done:
+		if ds.webhook != nil {
+			ds.webhook.Close()
+		}
+		if ds.journal != nil {
+			if err := ds.journal.Close(); err != nil {
+				logger.Warnf("Failed to close delivery journal: %v", err)
+			}
+		}
 		logger.Info("Delivery system stopped gracefully")
 		return nil
 	case <-time.After(30 * time.Second):
@@ -153,7 +282,12 @@ func (ds *DeliverySystem) Stop() error {
 }
 
 // SubmitTask 提交投递任务
+// 投递时间还未到的任务交给调度器保存，到期后再进入投递入口
 func (ds *DeliverySystem) SubmitTask(task DeliveryTask) error {
+	if task.IsScheduled() {
+		return ds.scheduleTask(task)
+	}
+
 	// 检查背压
 	if !ds.backpressure.ShouldAccept(task) {
 		atomic.AddInt64(&ds.stats.TotalFailed, 1)
@@ -173,26 +307,411 @@ func (ds *DeliverySystem) SubmitTask(task DeliveryTask) error {
 		task.Timeout = ds.config.TaskTimeout
 	}
 
+	// 先写入日志，确保返回成功前任务已持久化
+	if ds.journal != nil {
+		if err := ds.journal.Append(task); err != nil {
+			atomic.AddInt64(&ds.stats.TotalFailed, 1)
+			return fmt.Errorf("failed to persist task: %w", err)
+		}
+	}
+
 	select {
 	case ds.inputChan <- task:
 		atomic.AddInt64(&ds.stats.TotalReceived, 1)
 		return nil
 	case <-time.After(100 * time.Millisecond):
 		atomic.AddInt64(&ds.stats.TotalFailed, 1)
+		ds.discardTask(task.ID)
 		return fmt.Errorf("queue full, task rejected")
 	}
 }
 
+// scheduleTask 保存定时任务，不占用投递队列也不受背压影响
+func (ds *DeliverySystem) scheduleTask(task DeliveryTask) error {
+	if ds.scheduler == nil {
+		return ErrSchedulingDisabled
+	}
+	if task.ID == "" {
+		task.ID = generateTaskID()
+	}
+	return ds.scheduler.Add(task)
+}
+
+// SchedulingEnabled 是否支持定时投递（需要启用投递日志）
+func (ds *DeliverySystem) SchedulingEnabled() bool {
+	return ds.scheduler != nil
+}
+
+// ListScheduled 列出提交者等待投递的定时消息
+func (ds *DeliverySystem) ListScheduled(submittedBy string, limit, offset int) ([]*ScheduledMessage, int, error) {
+	if ds.scheduler == nil {
+		return nil, 0, ErrSchedulingDisabled
+	}
+	return ds.scheduler.List(submittedBy, limit, offset)
+}
+
+// CancelScheduled 取消提交者的定时消息，接收者的回执标记为投递失败，返回被取消的消息及其接收者
+func (ds *DeliverySystem) CancelScheduled(submittedBy, messageID string) (*ScheduledMessage, error) {
+	if ds.scheduler == nil {
+		return nil, ErrSchedulingDisabled
+	}
+
+	tasks, scheduledAt, err := ds.scheduler.Cancel(submittedBy, messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelled := &ScheduledMessage{
+		MessageID:   messageID,
+		SubmittedBy: submittedBy,
+		Recipients:  []string{},
+		ScheduledAt: scheduledAt,
+	}
+	for _, task := range tasks {
+		cancelled.ChannelID = task.ChannelID
+		cancelled.DeliverAt = task.NotBefore
+		if task.Message != nil {
+			cancelled.Title = task.Message.Title
+		}
+		for _, userID := range targetUsersOf(task) {
+			ds.recordReceipt(messageID, userID, ReceiptDead, "cancelled")
+			cancelled.Recipients = append(cancelled.Recipients, userID)
+		}
+	}
+
+	logger.Infof("Scheduled message %s cancelled by %s", messageID, submittedBy)
+	return cancelled, nil
+}
+
+// Pause 暂停投递：新任务仍然入队（并写入投递日志），但不再分发给邮递员，已分发的任务会继续完成
+// 入口队列满后提交会被拒绝。返回状态是否发生变化
+func (ds *DeliverySystem) Pause() bool {
+	if !atomic.CompareAndSwapInt32(&ds.paused, 0, 1) {
+		return false
+	}
+	logger.Warn("Delivery system paused")
+	return true
+}
+
+// Resume 恢复投递，返回状态是否发生变化
+func (ds *DeliverySystem) Resume() bool {
+	if !atomic.CompareAndSwapInt32(&ds.paused, 1, 0) {
+		return false
+	}
+	select {
+	case ds.resumed <- struct{}{}:
+	default:
+	}
+	logger.Info("Delivery system resumed")
+	return true
+}
+
+// IsPaused 投递是否已暂停
+func (ds *DeliverySystem) IsPaused() bool {
+	return atomic.LoadInt32(&ds.paused) == 1
+}
+
+// markDelivered 在日志中记录任务已投递给某个用户
+func (ds *DeliverySystem) markDelivered(taskID, userID string) {
+	if ds.journal == nil {
+		return
+	}
+	if err := ds.journal.MarkDelivered(taskID, userID); err != nil {
+		logger.Warnf("Failed to mark task %s delivered to %s in journal: %v", taskID, userID, err)
+	}
+}
+
+// completeTask 在日志中标记任务完成
+func (ds *DeliverySystem) completeTask(taskID string) {
+	if ds.journal == nil {
+		return
+	}
+	if err := ds.journal.Complete(taskID); err != nil {
+		logger.Warnf("Failed to complete task %s in journal: %v", taskID, err)
+	}
+}
+
+// abandonTask 在日志中标记任务已放弃
+func (ds *DeliverySystem) abandonTask(taskID, reason string) {
+	if ds.journal == nil {
+		return
+	}
+	if err := ds.journal.Abandon(taskID, reason); err != nil {
+		logger.Warnf("Failed to abandon task %s in journal: %v", taskID, err)
+	}
+}
+
+// deadLetter 将无法投递的任务转入死信队列
+func (ds *DeliverySystem) deadLetter(task DeliveryTask, reason string) {
+	atomic.AddInt64(&ds.stats.TotalFailed, 1)
+
+	if ds.deadLetters == nil {
+		ds.abandonTask(task.ID, reason)
+		return
+	}
+
+	if err := ds.deadLetters.Add(task, reason); err != nil {
+		logger.Errorf("Failed to move task %s to dead letter queue: %v", task.ID, err)
+		ds.abandonTask(task.ID, reason)
+		return
+	}
+
+	atomic.AddInt64(&ds.stats.TotalDeadLettered, 1)
+	ds.completeTask(task.ID)
+	logger.Warnf("Task %s moved to dead letter queue: %s", task.ID, reason)
+
+	if task.Message != nil {
+		for _, userID := range targetUsersOf(task) {
+			ds.recordReceipt(task.Message.ID, userID, ReceiptDead, reason)
+		}
+	}
+}
+
+// CheckCallbackURL 检查提交的回调地址，不允许指向内网、回环和链路本地地址（白名单除外）
+func (ds *DeliverySystem) CheckCallbackURL(callbackURL string) error {
+	return ds.callbacks.CheckURL(callbackURL)
+}
+
+// recordReceipt 推进投递回执，状态变化时触发回调
+func (ds *DeliverySystem) recordReceipt(messageID, userID, state, errMsg string) {
+	if ds.receipts == nil {
+		return
+	}
+
+	receipt, changed, err := ds.receipts.Advance(messageID, userID, state, errMsg)
+	if err != nil {
+		logger.Warnf("Failed to record %s receipt for message %s (user %s): %v", state, messageID, userID, err)
+		return
+	}
+
+	if changed && receipt != nil && receipt.CallbackURL != "" && ds.webhook != nil {
+		ds.webhook.Notify(receipt.CallbackURL, receipt)
+	}
+}
+
+// MarkRead 记录接收者已读（由工作空间的已读回调调用）
+// 先只读筛选出还没有推进到已读的回执，没有回执的消息不写投递日志
+func (ds *DeliverySystem) MarkRead(userID string, messageIDs []string) {
+	if ds.receipts == nil {
+		return
+	}
+
+	pending, err := ds.receipts.Pending(userID, messageIDs, ReceiptRead)
+	if err != nil {
+		logger.Warnf("Failed to look up read receipts for user %s: %v", userID, err)
+		return
+	}
+	for _, messageID := range pending {
+		ds.recordReceipt(messageID, userID, ReceiptRead, "")
+	}
+}
+
+// AckDelivery 记录客户端确认收到消息
+// 通过历史记录等方式拿到、未经推送的消息，确认时同时推进到 pushed 状态
+func (ds *DeliverySystem) AckDelivery(userID, deviceID string, messageIDs []string) error {
+	if ds.receipts == nil {
+		return ErrReceiptsDisabled
+	}
+
+	for _, messageID := range messageIDs {
+		if _, err := ds.receipts.Ack(messageID, userID, deviceID); err != nil {
+			return err
+		}
+		ds.recordReceipt(messageID, userID, ReceiptPushed, "")
+	}
+	return nil
+}
+
+// GetReceipts 获取消息的全部投递回执
+func (ds *DeliverySystem) GetReceipts(messageID string) ([]*Receipt, error) {
+	if ds.receipts == nil {
+		return nil, ErrReceiptsDisabled
+	}
+	return ds.receipts.List(messageID)
+}
+
+// discardTask 撤销未被接受的任务
+func (ds *DeliverySystem) discardTask(taskID string) {
+	if ds.journal == nil {
+		return
+	}
+	if err := ds.journal.Discard(taskID); err != nil {
+		logger.Warnf("Failed to discard task %s from journal: %v", taskID, err)
+	}
+}
+
 // SubmitMessage 提交消息投递（便捷方法）
 func (ds *DeliverySystem) SubmitMessage(message *models.Message, targetUsers []string) error {
-	task := DeliveryTask{
+	return ds.SubmitTask(newMessageTask(message, targetUsers, SubmitOptions{}))
+}
+
+// newMessageTask 创建消息投递任务
+func newMessageTask(message *models.Message, targetUsers []string, opts SubmitOptions) DeliveryTask {
+	return DeliveryTask{
 		ChannelID:   message.ChannelID,
 		Message:     message,
 		TargetUsers: targetUsers,
 		Priority:    message.Priority,
+		NotBefore:   opts.DeliverAt,
+		SubmittedBy: opts.SubmittedBy,
+	}
+}
+
+// ListDeadLetters 列出死信
+func (ds *DeliverySystem) ListDeadLetters(filter DeadLetterFilter) ([]*DeadLetter, int, error) {
+	if ds.deadLetters == nil {
+		return nil, 0, ErrDeadLettersDisabled
+	}
+	return ds.deadLetters.List(filter)
+}
+
+// GetDeadLetter 获取单条死信
+func (ds *DeliverySystem) GetDeadLetter(id string) (*DeadLetter, error) {
+	if ds.deadLetters == nil {
+		return nil, ErrDeadLettersDisabled
+	}
+	return ds.deadLetters.Get(id)
+}
+
+// ReplayDeadLetter 重新投递一条死信，返回新的任务ID
+func (ds *DeliverySystem) ReplayDeadLetter(id string) (string, error) {
+	if ds.deadLetters == nil {
+		return "", ErrDeadLettersDisabled
+	}
+
+	dl, err := ds.deadLetters.Get(id)
+	if err != nil {
+		return "", err
+	}
+
+	task := dl.Task
+	task.ID = generateTaskID()
+	task.RetryCount = 0
+	task.CreatedAt = time.Time{}
+	task.Timeout = 0
+	// 与重放日志一样按幂等方式写入
+	task.Replayed = true
+
+	// dead 回执不能再向前推进，重放前先重置为 queued
+	if ds.receipts != nil && task.Message != nil {
+		if _, err := ds.receipts.Requeue(task.Message.ID, task.TargetUsers); err != nil {
+			return "", err
+		}
+	}
+
+	if err := ds.SubmitTask(task); err != nil {
+		return "", fmt.Errorf("failed to resubmit dead letter: %w", err)
+	}
+
+	if err := ds.deadLetters.Delete(id); err != nil && err != ErrDeadLetterNotFound {
+		logger.Warnf("Dead letter %s replayed as %s but could not be removed: %v", id, task.ID, err)
+	}
+
+	logger.Infof("Dead letter %s replayed as task %s", id, task.ID)
+	return task.ID, nil
+}
+
+// ReplayDeadLetters 批量重新投递，ids为空时按过滤条件选择
+func (ds *DeliverySystem) ReplayDeadLetters(ids []string, filter DeadLetterFilter) (map[string]string, map[string]string, error) {
+	if ds.deadLetters == nil {
+		return nil, nil, ErrDeadLettersDisabled
+	}
+
+	if len(ids) == 0 {
+		var err error
+		ids, err = ds.deadLetters.IDs(filter)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	replayed := make(map[string]string)
+	failed := make(map[string]string)
+	for _, id := range ids {
+		taskID, err := ds.ReplayDeadLetter(id)
+		if err != nil {
+			failed[id] = err.Error()
+			continue
+		}
+		replayed[id] = taskID
+	}
+
+	return replayed, failed, nil
+}
+
+// DeleteDeadLetter 删除单条死信
+func (ds *DeliverySystem) DeleteDeadLetter(id string) error {
+	if ds.deadLetters == nil {
+		return ErrDeadLettersDisabled
+	}
+	return ds.deadLetters.Delete(id)
+}
+
+// PurgeDeadLetters 清理死信，before为零值时清理全部
+func (ds *DeliverySystem) PurgeDeadLetters(before time.Time) (int64, error) {
+	if ds.deadLetters == nil {
+		return 0, ErrDeadLettersDisabled
+	}
+	return ds.deadLetters.Purge(before)
+}
+
+// PurgeReceipts 清理 before 之前最后更新的投递回执
+func (ds *DeliverySystem) PurgeReceipts(before time.Time) (int64, error) {
+	if ds.receipts == nil {
+		return 0, ErrReceiptsDisabled
+	}
+	return ds.receipts.Purge(before)
+}
+
+// fanoutChunkSize 群发时每个投递任务包含的最大接收者数
+const fanoutChunkSize = 100
+
+// SubmitOptions 消息提交选项
+type SubmitOptions struct {
+	SubmittedBy string    // 提交者用户ID
+	CallbackURL string    // 投递状态回调地址（可选）
+	DeliverAt   time.Time // 定时投递时间（可选，零值或已过去表示立即投递）
+}
+
+// FanoutResult 群发提交结果
+type FanoutResult struct {
+	Queued   []string          // 已进入投递队列的接收者
+	Rejected map[string]string // 被拒绝的接收者及原因
+}
+
+// SubmitFanout 将同一条消息投递给多个接收者，每个接收者得到独立副本
+// 接收者按批拆分为多个任务，使不同邮递员可以并行投递；指定了未来的投递时间时任务由调度器保存到期再投递
+func (ds *DeliverySystem) SubmitFanout(message *models.Message, recipients []string, opts SubmitOptions) FanoutResult {
+	result := FanoutResult{
+		Queued:   make([]string, 0, len(recipients)),
+		Rejected: make(map[string]string),
+	}
+
+	for start := 0; start < len(recipients); start += fanoutChunkSize {
+		end := start + fanoutChunkSize
+		if end > len(recipients) {
+			end = len(recipients)
+		}
+		chunk := recipients[start:end]
+
+		// 回执必须先于任务入队创建，否则邮递员可能先推进状态
+		if ds.receipts != nil {
+			if err := ds.receipts.Queue(message.ID, opts.SubmittedBy, opts.CallbackURL, chunk); err != nil {
+				logger.Warnf("Failed to create receipts for message %s: %v", message.ID, err)
+			}
+		}
+
+		if err := ds.SubmitTask(newMessageTask(message, chunk, opts)); err != nil {
+			for _, userID := range chunk {
+				result.Rejected[userID] = err.Error()
+				ds.recordReceipt(message.ID, userID, ReceiptDead, err.Error())
+			}
+			continue
+		}
+		result.Queued = append(result.Queued, chunk...)
 	}
 
-	return ds.SubmitTask(task)
+	return result
 }
 
 // GetStats 获取投递统计
@@ -203,6 +722,7 @@ func (ds *DeliverySystem) GetStats() DeliveryStats {
 	stats := ds.stats
 	stats.QueueDepth = len(ds.inputChan)
 	stats.ActiveWorkers = ds.getActiveWorkerCount()
+	stats.Paused = ds.IsPaused()
 	stats.LastUpdate = time.Now()
 
 	return stats
@@ -221,7 +741,8 @@ func (ds *DeliverySystem) getActiveWorkerCount() int {
 
 // generateTaskID 生成任务ID
 func generateTaskID() string {
-	return fmt.Sprintf("task_%d_%d", time.Now().UnixNano(), runtime.NumGoroutine())
+	// 任务ID会作为日志主键，需要保证全局唯一
+	return fmt.Sprintf("task_%d_%s", time.Now().UnixNano(), uuid.New().String()[:8])
 }
 
 // initQueueManager 初始化队列管理器
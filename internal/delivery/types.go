@@ -8,19 +8,34 @@ import (
 
 // DeliveryTask 投递任务
 type DeliveryTask struct {
-	ID          string              // 任务ID
-	ChannelID   string              // 频道ID
-	Message     *models.Message     // 消息内容
-	TargetUsers []string            // 目标用户列表
-	Priority    int                 // 优先级 (1-10)
-	RetryCount  int                 // 重试次数
-	CreatedAt   time.Time           // 创建时间
-	Timeout     time.Duration       // 超时时间
+	ID          string          `json:"id"`           // 任务ID
+	ChannelID   string          `json:"channel_id"`   // 频道ID
+	Message     *models.Message `json:"message"`      // 消息内容
+	TargetUsers []string        `json:"target_users"` // 目标用户列表
+	Priority    int             `json:"priority"`     // 优先级 (1-10)
+	RetryCount  int             `json:"retry_count"`  // 重试次数
+	CreatedAt   time.Time       `json:"created_at"`   // 创建时间
+	Timeout     time.Duration   `json:"timeout"`      // 超时时间
+	NotBefore   time.Time       `json:"not_before,omitempty"`   // 定时投递时间，到期前由调度器保存
+	SubmittedBy string          `json:"submitted_by,omitempty"` // 提交者用户ID
+	Replayed    bool            `json:"-"`            // 是否为重启后从日志恢复的任务
+
+	Attempts []DeliveryAttempt `json:"attempts,omitempty"` // 历次失败的尝试记录
 }
 
 // IsExpired 检查任务是否过期
+// 定时任务从投递时间开始计算超时，等待调度的时间不计入
 func (dt *DeliveryTask) IsExpired() bool {
-	return time.Since(dt.CreatedAt) > dt.Timeout
+	start := dt.CreatedAt
+	if dt.NotBefore.After(start) {
+		start = dt.NotBefore
+	}
+	return time.Since(start) > dt.Timeout
+}
+
+// IsScheduled 任务是否还未到投递时间
+func (dt *DeliveryTask) IsScheduled() bool {
+	return dt.NotBefore.After(time.Now())
 }
 
 // RetryTask 重试任务
@@ -84,9 +99,11 @@ type DeliveryStats struct {
 	TotalDelivered    int64     // 总投递数
 	TotalFailed       int64     // 总失败数
 	TotalRetried      int64     // 总重试数
+	TotalDeadLettered int64     // 进入死信队列数
 	AvgDeliveryTime   time.Duration // 平均投递时间
 	QueueDepth        int       // 当前队列深度
 	ActiveWorkers     int       // 活跃邮递员数
+	Paused            bool      // 投递是否已暂停
 	LastUpdate        time.Time
 }
 
@@ -98,4 +115,20 @@ const (
 	MemoryPressureMedium
 	MemoryPressureHigh
 	MemoryPressureCritical
-)
\ No newline at end of file
+)
+
+// String 返回内存压力级别名称
+func (mp MemoryPressure) String() string {
+	switch mp {
+	case MemoryPressureLow:
+		return "low"
+	case MemoryPressureMedium:
+		return "medium"
+	case MemoryPressureHigh:
+		return "high"
+	case MemoryPressureCritical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
\ No newline at end of file
@@ -0,0 +1,295 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"miemie/internal/logger"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// errBlockedAddress 回调地址指向内网、回环或链路本地地址
+var errBlockedAddress = errors.New("callback address is not allowed")
+
+// sharedAddressSpace 运营商级 NAT 地址段（100.64.0.0/10），同样不允许回调
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0).To4(), Mask: net.CIDRMask(10, 32)}
+
+// CallbackGuard 回调地址检查，拒绝指向内网、回环和链路本地地址的回调，防止借回调访问内部服务
+type CallbackGuard struct {
+	hosts    map[string]bool // 白名单主机名
+	networks []*net.IPNet    // 白名单网段
+}
+
+// NewCallbackGuard 创建回调地址检查，allowed 中的主机名、IP 或 CIDR 网段不受限制
+func NewCallbackGuard(allowed []string) *CallbackGuard {
+	guard := &CallbackGuard{hosts: make(map[string]bool)}
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			if ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			guard.networks = append(guard.networks, network)
+			continue
+		}
+		guard.hosts[strings.TrimSuffix(entry, ".")] = true
+	}
+	return guard
+}
+
+// CheckURL 检查回调地址：只允许 http/https，主机解析出的所有地址都必须允许回调
+func (g *CallbackGuard) CheckURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme: %s", u.Scheme)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	if g.allowedHost(host) {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve host %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !g.allowedIP(addr.IP) {
+			return fmt.Errorf("%w: %s resolves to %s", errBlockedAddress, host, addr.IP)
+		}
+	}
+	return nil
+}
+
+// allowedHost 主机名在白名单中
+func (g *CallbackGuard) allowedHost(host string) bool {
+	return g.hosts[strings.TrimSuffix(strings.ToLower(host), ".")]
+}
+
+// allowedIP 地址可以作为回调目标
+func (g *CallbackGuard) allowedIP(ip net.IP) bool {
+	for _, network := range g.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return !blockedIP(ip)
+}
+
+// blockedIP 内网、回环、链路本地、组播等地址
+func blockedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+// control 连接建立前检查实际连接的地址，DNS 在提交后改指内网地址也无法绕过
+func (g *CallbackGuard) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !g.allowedIP(ip) {
+		return fmt.Errorf("%w: %s", errBlockedAddress, host)
+	}
+	return nil
+}
+
+// dialContext 白名单主机直接连接，其余主机连接时检查地址
+func (g *CallbackGuard) dialContext(timeout time.Duration) func(ctx context.Context, network, address string) (net.Conn, error) {
+	open := &net.Dialer{Timeout: timeout}
+	guarded := &net.Dialer{Timeout: timeout, Control: g.control}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, _, err := net.SplitHostPort(address); err == nil && g.allowedHost(host) {
+			return open.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+}
+
+// WebhookNotifier 投递状态回调通知器，固定数量的发送协程从有界队列中取回调
+type WebhookNotifier struct {
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	queue       chan webhookJob
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// webhookJob 等待发送的回调
+type webhookJob struct {
+	url   string
+	event WebhookEvent
+}
+
+// WebhookEvent 回调请求体
+type WebhookEvent struct {
+	Event     string    `json:"event"`
+	MessageID string    `json:"message_id"`
+	UserID    string    `json:"user_id"`
+	State     string    `json:"state"`
+	Error     string    `json:"error,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// NewWebhookNotifier 创建回调通知器并启动发送协程
+func NewWebhookNotifier(timeout time.Duration, maxAttempts, workers, queueSize int, guard *CallbackGuard) *WebhookNotifier {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+	if workers <= 0 {
+		workers = 4
+	}
+	if queueSize <= 0 {
+		queueSize = 1000
+	}
+	if guard == nil {
+		guard = NewCallbackGuard(nil)
+	}
+
+	wn := &WebhookNotifier{
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:         guard.dialContext(timeout),
+				TLSHandshakeTimeout: timeout,
+				MaxIdleConns:        workers,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		maxAttempts: maxAttempts,
+		backoff:     500 * time.Millisecond,
+		queue:       make(chan webhookJob, queueSize),
+		stop:        make(chan struct{}),
+	}
+
+	for i := 0; i < workers; i++ {
+		wn.wg.Add(1)
+		go wn.run()
+	}
+	return wn
+}
+
+// Notify 把回执状态变更放入发送队列，队列已满时丢弃并记录日志
+func (wn *WebhookNotifier) Notify(url string, receipt *Receipt) {
+	job := webhookJob{
+		url: url,
+		event: WebhookEvent{
+			Event:     "delivery.status",
+			MessageID: receipt.MessageID,
+			UserID:    receipt.UserID,
+			State:     receipt.State,
+			Error:     receipt.Error,
+			At:        receipt.UpdatedAt,
+		},
+	}
+
+	select {
+	case wn.queue <- job:
+	default:
+		logger.Warnf("Webhook queue is full, dropping %s event for message %s (user %s)",
+			receipt.State, receipt.MessageID, receipt.UserID)
+	}
+}
+
+// Close 停止发送协程，队列中未发送的回调被丢弃
+func (wn *WebhookNotifier) Close() {
+	close(wn.stop)
+	wn.wg.Wait()
+	if dropped := len(wn.queue); dropped > 0 {
+		logger.Warnf("Dropped %d pending webhook events on shutdown", dropped)
+	}
+}
+
+// run 发送协程主循环
+func (wn *WebhookNotifier) run() {
+	defer wn.wg.Done()
+	for {
+		select {
+		case <-wn.stop:
+			return
+		case job := <-wn.queue:
+			wn.send(job)
+		}
+	}
+}
+
+// send 发送一个回调，失败时按指数退避重试
+func (wn *WebhookNotifier) send(job webhookJob) {
+	event := job.event
+	body, err := json.Marshal(event)
+	if err != nil {
+		logger.Warnf("Failed to encode webhook event for message %s: %v", event.MessageID, err)
+		return
+	}
+
+	delay := wn.backoff
+	attempt := 1
+	for ; attempt <= wn.maxAttempts; attempt++ {
+		err = wn.post(job.url, body)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, errBlockedAddress) || attempt == wn.maxAttempts {
+			break
+		}
+		select {
+		case <-wn.stop:
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+
+	logger.Warnf("Webhook %s for message %s (user %s, state %s) failed after %d attempts: %v",
+		job.url, event.MessageID, event.UserID, event.State, attempt, err)
+}
+
+// post 发送一次回调请求
+func (wn *WebhookNotifier) post(url string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "miemie-webhook/1.0")
+
+	resp, err := wn.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
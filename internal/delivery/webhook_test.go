@@ -0,0 +1,76 @@
+package delivery
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCallbackGuardCheckURL(t *testing.T) {
+	guard := NewCallbackGuard([]string{"hooks.internal", "10.1.0.0/16"})
+
+	cases := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://127.0.0.1:8080/hook", false},
+		{"http://[::1]/hook", false},
+		{"http://169.254.169.254/latest/meta-data", false},
+		{"http://192.168.1.10/hook", false},
+		{"http://10.2.0.1/hook", false},
+		{"http://100.64.0.1/hook", false},
+		{"http://0.0.0.0/hook", false},
+		{"ftp://8.8.8.8/hook", false},
+		{"http:///hook", false},
+		{"http://10.1.2.3/hook", true},
+		{"https://hooks.internal/hook", true},
+		{"https://8.8.8.8/hook", true},
+	}
+	for _, tc := range cases {
+		err := guard.CheckURL(tc.url)
+		if tc.allowed && err != nil {
+			t.Errorf("CheckURL(%q) = %v, want allowed", tc.url, err)
+		}
+		if !tc.allowed && err == nil {
+			t.Errorf("CheckURL(%q) allowed, want error", tc.url)
+		}
+	}
+}
+
+func TestWebhookNotifierBlocksAtDialTime(t *testing.T) {
+	var hits int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	defer server.Close()
+
+	// 提交时的检查被绕过（例如 DNS 重绑定），连接时仍然拒绝
+	blocked := NewWebhookNotifier(time.Second, 3, 1, 1, NewCallbackGuard(nil))
+	defer blocked.Close()
+	if err := blocked.post(server.URL, []byte("{}")); !errors.Is(err, errBlockedAddress) {
+		t.Fatalf("post to loopback = %v, want errBlockedAddress", err)
+	}
+
+	allowed := NewWebhookNotifier(time.Second, 3, 1, 1, NewCallbackGuard([]string{"127.0.0.1"}))
+	defer allowed.Close()
+	if err := allowed.post(server.URL, []byte("{}")); err != nil {
+		t.Fatalf("post to allowlisted address: %v", err)
+	}
+	if atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("server hits = %d, want 1", hits)
+	}
+}
+
+func TestWebhookNotifierDropsWhenQueueFull(t *testing.T) {
+	wn := &WebhookNotifier{queue: make(chan webhookJob, 2), stop: make(chan struct{})}
+	receipt := &Receipt{MessageID: "m1", UserID: "u1", State: ReceiptStored}
+	for i := 0; i < 5; i++ {
+		wn.Notify("https://example.com/hook", receipt)
+	}
+	if len(wn.queue) != 2 {
+		t.Fatalf("queued = %d, want 2", len(wn.queue))
+	}
+}
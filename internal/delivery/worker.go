@@ -55,44 +55,60 @@ func (dw *DeliveryWorker) processTask(ctx context.Context, task DeliveryTask) {
 	// 检查任务是否过期
 	if task.IsExpired() {
 		logger.Infof("Task %s expired, skipping", task.ID)
+		task.Attempts = append(task.Attempts, DeliveryAttempt{
+			Attempt: task.RetryCount + 1,
+			Error:   "task expired before delivery",
+			At:      time.Now(),
+		})
 		dw.scheduleRetry(task, "task_expired")
 		return
 	}
 
 	// 处理目标用户列表
-	var targetUsers []string
-	if len(task.TargetUsers) > 0 {
-		targetUsers = task.TargetUsers
-	} else if task.Message != nil {
-		// 如果没有指定目标用户，使用消息的接收者
-		targetUsers = []string{task.Message.UserID}
-	} else {
+	targetUsers := targetUsersOf(task)
+	if len(targetUsers) == 0 {
 		logger.Infof("Task %s has no target users", task.ID)
+		dw.system.completeTask(task.ID)
 		return
 	}
 
 	// 为每个用户投递消息
-	successCount := 0
+	var failedUsers []string
 	for _, userID := range targetUsers {
 		if err := dw.deliverToUser(ctx, userID, task); err != nil {
 			logger.Infof("Failed to deliver task %s to user %s: %v", task.ID, userID, err)
-			// 单个用户失败不整体重试，继续处理其他用户
+			// 单个用户失败不影响其他用户，稍后只重试失败的用户
+			failedUsers = append(failedUsers, userID)
+			task.Attempts = append(task.Attempts, DeliveryAttempt{
+				Attempt: task.RetryCount + 1,
+				UserID:  userID,
+				Error:   err.Error(),
+				At:      time.Now(),
+			})
 			continue
 		}
-		successCount++
+		dw.system.markDelivered(task.ID, userID)
 	}
 
 	// 更新统计
-	if successCount > 0 {
+	if len(failedUsers) < len(targetUsers) {
 		atomic.AddInt64(&dw.system.stats.TotalDelivered, 1)
 		deliveryTime := time.Since(startTime)
 		dw.updateAvgDeliveryTime(deliveryTime)
 	}
 
-	if successCount == 0 && len(targetUsers) > 0 {
-		// 所有用户都失败，安排重试
-		dw.scheduleRetry(task, "all_users_failed")
+	if len(failedUsers) == 0 {
+		dw.system.completeTask(task.ID)
+		return
+	}
+
+	// 只对失败的用户安排重试
+	reason := "all_users_failed"
+	if len(failedUsers) < len(targetUsers) {
+		reason = "some_users_failed"
 	}
+	task.TargetUsers = failedUsers
+	dw.scheduleRetry(task, reason)
 }
 
 // deliverToUser 投递消息到指定用户
@@ -101,6 +117,16 @@ func (dw *DeliveryWorker) deliverToUser(ctx context.Context, userID string, task
 		return fmt.Errorf("message is nil")
 	}
 
+	// 每个接收者得到独立的消息副本
+	message := task.Message.CopyFor(userID)
+
+	// 重试或排队期间已经过期的消息不再写入和推送
+	if message.IsExpired() {
+		logger.Infof("Message %s for user %s expired before delivery, dropping", message.ID, userID)
+		dw.system.recordReceipt(message.ID, userID, ReceiptDead, "expired")
+		return nil
+	}
+
 	// 获取用户工作空间
 	ws, err := dw.system.workspaceManager.GetUserWorkspace(userID)
 	if err != nil {
@@ -115,17 +141,74 @@ func (dw *DeliveryWorker) deliverToUser(ctx context.Context, userID string, task
 
 	// 存储消息到用户数据库
 	userStorage := storage.NewUserMessageStorage(ws)
-	if err := userStorage.CreateMessage(task.Message); err != nil {
-		return fmt.Errorf("failed to create message: %w", err)
+
+	// 重试或重放的任务可能已经写入过，需要保证幂等
+	stored := false
+	if task.RetryCount > 0 || task.Replayed {
+		exists, err := userStorage.MessageExists(message.ID)
+		if err != nil {
+			return fmt.Errorf("failed to check message existence: %w", err)
+		}
+		stored = exists
+		// 已写入的消息沿用解析后的频道，推送和静音判断都按这个频道
+		if stored {
+			if existing, err := userStorage.GetMessage(message.ID); err == nil {
+				message.ChannelID = existing.ChannelID
+			}
+			// 上次写入后阅读状态可能没有迁移成功，按记录的被替换消息再迁移一次
+			replaces, err := userStorage.ReplacedMessageID(message.ID)
+			if err != nil {
+				logger.Warnf("Failed to get replaced message of %s for user %s: %v", message.ID, userID, err)
+			}
+			message.Replaces = replaces
+			if err := userStorage.MoveReplacedReadStatus(message); err != nil {
+				logger.Warnf("Failed to move read status of replaced message %s for user %s: %v", replaces, userID, err)
+			}
+		}
+	}
+
+	if !stored {
+		// channel_id 可以是频道ID或标识，解析为接收者工作空间中的频道
+		channel, err := userStorage.ResolveChannel(message.ChannelID, dw.system.config.ChannelAutoCreate, dw.system.config.MaxChannels)
+		if err == storage.ErrChannelNotFound {
+			logger.Infof("Channel %s does not exist for user %s, dropping message %s", message.ChannelID, userID, message.ID)
+			dw.system.recordReceipt(message.ID, userID, ReceiptDead, "channel_not_found")
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resolve channel: %w", err)
+		}
+		message.ChannelID = channel.ID
+
+		if err := userStorage.CreateMessage(message); err != nil {
+			if err == storage.ErrMessageSuperseded {
+				// 折叠键相同的更新消息已经送达，过时的消息不再写入和推送
+				logger.Infof("Message %s for user %s superseded by a newer message with collapse key %s",
+					message.ID, userID, message.CollapseKey)
+				dw.system.recordReceipt(message.ID, userID, ReceiptStored, "")
+				return nil
+			}
+			return fmt.Errorf("failed to create message: %w", err)
+		}
+	}
+
+	dw.system.recordReceipt(message.ID, userID, ReceiptStored, "")
+
+	// 静音的频道只存储不推送，客户端同步时仍能取到
+	muted, err := userStorage.IsChannelMuted(message.ChannelID)
+	if err != nil {
+		logger.Warnf("Failed to check mute for channel %s of user %s: %v", message.ChannelID, userID, err)
 	}
 
 	// 通过WebSocket广播给用户
-	if dw.system.wsManager != nil {
-		dw.system.wsManager.BroadcastMessage(task.Message)
+	if dw.system.wsManager != nil && !muted {
+		if pushed := dw.system.wsManager.BroadcastMessage(message); pushed > 0 {
+			dw.system.recordReceipt(message.ID, userID, ReceiptPushed, "")
+		}
 	}
 
 	logger.Infof("Message %s delivered to user %s by worker %d",
-		task.Message.ID, userID, dw.ID)
+		message.ID, userID, dw.ID)
 
 	return nil
 }
@@ -171,9 +254,12 @@ func (dw *DeliveryWorker) scheduleRetry(task DeliveryTask, reason string) {
 		if dw.system.retryManager.ScheduleRetry(task, reason) {
 			atomic.AddInt64(&dw.system.stats.TotalRetried, 1)
 			logger.Infof("Task %s scheduled for retry: %s", task.ID, reason)
-		} else {
+		} else if task.RetryCount >= dw.system.retryManager.maxRetries {
 			logger.Infof("Task %s abandoned: max retries exceeded", task.ID)
-			atomic.AddInt64(&dw.system.stats.TotalFailed, 1)
+			dw.system.deadLetter(task, "max_retries_exceeded: "+reason)
+		} else {
+			logger.Infof("Task %s abandoned: retry queue full", task.ID)
+			dw.system.deadLetter(task, "retry_queue_full: "+reason)
 		}
 	}
 }
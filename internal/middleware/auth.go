@@ -0,0 +1,296 @@
+package middleware
+
+import (
+	"fmt"
+	"miemie/internal/auth"
+	"miemie/internal/workspace"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const principalKey = "principal"
+
+// WebSocketBearerProtocol 携带凭证的 WebSocket 子协议名，凭证作为下一个子协议传入
+const WebSocketBearerProtocol = "bearer"
+
+// queryCredentialParams 放在查询参数中的凭证，访问日志中会被隐去
+var queryCredentialParams = map[string]bool{"api_key": true, "access_token": true}
+
+// queryCredentialRoutes 接受查询参数凭证的路由，浏览器 WebSocket/EventSource 无法设置请求头
+var queryCredentialRoutes = map[string]bool{"/ws": true, "/api/v3/stream": true}
+
+// AuthMiddleware 通过API密钥或 JWT 认证请求并设置真实用户ID
+// 密钥可以放在 Authorization: Bearer、X-API-Key 头或 api_key 参数中。
+// verifier 不为空时，Authorization: Bearer、access_token 参数和 WebSocket 子协议中的 JWT 也会被接受。
+// api_key 和 access_token 参数只在 /ws 和 /api/v3/stream 上接受，其他路由返回400。
+// 只有 allowUserIDHeader 开启时，没有凭证的请求才按 User-ID 头识别用户（开发模式）。
+func AuthMiddleware(store *auth.Store, verifier *auth.JWTVerifier, allowUserIDHeader bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if name := queryCredentialParam(c); name != "" && !queryCredentialRoutes[c.FullPath()] {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "Credentials in query parameters are not accepted on this route",
+				"error":   fmt.Sprintf("%s is only accepted on /ws and /api/v3/stream, use the Authorization or X-API-Key header", name),
+			})
+			return
+		}
+
+		rawKey, token := extractCredential(c)
+
+		if token != "" {
+			authenticateToken(c, store, verifier, token)
+			return
+		}
+
+		if rawKey == "" {
+			if !allowUserIDHeader {
+				abortUnauthorized(c, "API key or bearer token required")
+				return
+			}
+			userID := resolveHeaderUserID(c)
+			setPrincipal(c, &auth.Principal{
+				Type:   auth.PrincipalHeader,
+				ID:     userID,
+				Scopes: auth.AllScopes,
+				Role:   auth.RoleAdmin,
+			})
+			c.Next()
+			return
+		}
+
+		principal, err := store.Authenticate(rawKey)
+		if err != nil {
+			switch err {
+			case auth.ErrInvalidKey:
+				abortUnauthorized(c, "Invalid API key")
+			case auth.ErrSenderDisabled:
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+					"code":    403,
+					"message": "Sender is disabled",
+				})
+			default:
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+					"code":    500,
+					"message": "Failed to authenticate",
+					"error":   err.Error(),
+				})
+			}
+			return
+		}
+
+		if resolveRole(c, store, principal) {
+			setPrincipal(c, principal)
+			c.Next()
+		}
+	}
+}
+
+// authenticateToken 验证 JWT 并设置令牌中的用户
+func authenticateToken(c *gin.Context, store *auth.Store, verifier *auth.JWTVerifier, token string) {
+	if verifier == nil {
+		abortUnauthorized(c, "Bearer token authentication is not enabled")
+		return
+	}
+
+	principal, err := verifier.Verify(token)
+	if err != nil {
+		c.Header("WWW-Authenticate", `Bearer realm="miemie", error="invalid_token"`)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+			"code":    401,
+			"message": "Invalid bearer token",
+			"error":   err.Error(),
+		})
+		return
+	}
+	if !workspace.IsValidUserID(principal.ID) {
+		abortUnauthorized(c, "Bearer token user id is not valid")
+		return
+	}
+
+	if resolveRole(c, store, principal) {
+		setPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+// resolveRole 查询主体的角色，失败时中止请求
+func resolveRole(c *gin.Context, store *auth.Store, principal *auth.Principal) bool {
+	if err := store.ResolveRole(principal); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": "Failed to resolve role",
+			"error":   err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+// RequireScope 要求认证主体拥有任意一个权限范围
+func RequireScope(scopes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := GetPrincipal(c)
+		if principal != nil {
+			for _, scope := range scopes {
+				if principal.HasScope(scope) {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+			"code":     403,
+			"message":  "Insufficient scope",
+			"required": scopes,
+		})
+	}
+}
+
+// RequirePermission 要求认证主体的角色拥有管理权限，且凭证带有 admin 权限范围
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := GetPrincipal(c)
+		if principal != nil && principal.Can(permission) {
+			c.Next()
+			return
+		}
+
+		response := gin.H{
+			"code":     403,
+			"message":  "Permission denied",
+			"required": permission,
+		}
+		if principal != nil {
+			response["role"] = principal.Role
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, response)
+	}
+}
+
+// GetPrincipal 从上下文中获取认证主体
+func GetPrincipal(c *gin.Context) *auth.Principal {
+	if value, exists := c.Get(principalKey); exists {
+		if principal, ok := value.(*auth.Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+// setPrincipal 设置认证主体和用户ID
+func setPrincipal(c *gin.Context, principal *auth.Principal) {
+	userID := principal.UserID()
+	c.Set(principalKey, principal)
+	c.Set("user_id", userID)
+	c.Header("X-User-ID", userID)
+}
+
+// extractCredential 提取请求中的API密钥或 JWT
+// Bearer 凭证以 mm_ 开头时是API密钥，否则按 JWT 处理
+func extractCredential(c *gin.Context) (rawKey, token string) {
+	if authorization := c.GetHeader("Authorization"); authorization != "" {
+		if bearer, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+			return splitBearer(strings.TrimSpace(bearer))
+		}
+	}
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return strings.TrimSpace(key), ""
+	}
+	if bearer := websocketBearer(c); bearer != "" {
+		return splitBearer(bearer)
+	}
+	if key := c.Query("api_key"); key != "" {
+		return key, ""
+	}
+	return "", c.Query("access_token")
+}
+
+// queryCredentialParam 请求查询参数中携带的凭证参数名，没有时返回空
+func queryCredentialParam(c *gin.Context) string {
+	query := c.Request.URL.Query()
+	for name := range queryCredentialParams {
+		if query.Has(name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// RedactQueryCredentials 把请求路径中 api_key 和 access_token 参数的值替换为 REDACTED，用于访问日志
+func RedactQueryCredentials(path string) string {
+	base, query, ok := strings.Cut(path, "?")
+	if !ok {
+		return path
+	}
+
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, _ := strings.Cut(param, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if queryCredentialParams[name] {
+			params[i] = name + "=REDACTED"
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// AccessLogger 与 gin 默认格式相同的访问日志，查询参数中的凭证被隐去
+func AccessLogger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
+		var statusColor, methodColor, resetColor string
+		if param.IsOutputColor() {
+			statusColor = param.StatusCodeColor()
+			methodColor = param.MethodColor()
+			resetColor = param.ResetColor()
+		}
+		if param.Latency > time.Minute {
+			param.Latency = param.Latency.Truncate(time.Second)
+		}
+		return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+			param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			statusColor, param.StatusCode, resetColor,
+			param.Latency,
+			param.ClientIP,
+			methodColor, param.Method, resetColor,
+			RedactQueryCredentials(param.Path),
+			param.ErrorMessage,
+		)
+	})
+}
+
+// splitBearer 区分 Bearer 凭证的类型
+func splitBearer(bearer string) (rawKey, token string) {
+	if auth.IsAPIKey(bearer) {
+		return bearer, ""
+	}
+	return "", bearer
+}
+
+// websocketBearer 从 WebSocket 子协议中提取凭证
+// 浏览器无法为 WebSocket 设置 Authorization 头，客户端使用 new WebSocket(url, ["bearer", token])，
+// 服务端只回应 bearer 子协议，凭证不会出现在响应中。
+func websocketBearer(c *gin.Context) string {
+	protocols := strings.Split(c.GetHeader("Sec-WebSocket-Protocol"), ",")
+	for i := 0; i+1 < len(protocols); i++ {
+		if strings.TrimSpace(protocols[i]) == WebSocketBearerProtocol {
+			return strings.TrimSpace(protocols[i+1])
+		}
+	}
+	return ""
+}
+
+// abortUnauthorized 返回401
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="miemie"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"code":    401,
+		"message": message,
+	})
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"miemie/internal/auth"
+	"miemie/internal/ratelimit"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit 按调用方限制请求速率，必须放在 AuthMiddleware 之后
+// 调用方依次按发送者账户、API密钥、JWT 用户区分；开发模式下 User-ID 头可以随意伪造，按客户端IP区分。
+// limiter 为 nil 表示未启用限流。
+func RateLimit(limiter *ratelimit.Limiter, class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		identity, senderID := rateLimitIdentity(c)
+		result := limiter.Allow(class, identity, senderID)
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ratelimit.CeilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			abortRateLimited(c, class, "Rate limit exceeded", result)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AuthFailureLimit 按客户端IP限制认证失败的次数，必须放在 AuthMiddleware 之前
+// 每个返回 401 的请求消耗该IP的一个令牌，令牌用完后该IP的请求在认证之前直接返回 429，
+// 无效凭证不会再查询认证数据库。limiter 为 nil 表示未启用限流。
+func AuthFailureLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		identity := "ip:" + c.ClientIP()
+		if result := limiter.Check(ratelimit.ClassAuth, identity); !result.Allowed {
+			abortRateLimited(c, ratelimit.ClassAuth, "Too many failed authentication attempts", result)
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() == http.StatusUnauthorized {
+			limiter.Allow(ratelimit.ClassAuth, identity, "")
+		}
+	}
+}
+
+// abortRateLimited 返回 429 和 Retry-After
+func abortRateLimited(c *gin.Context, class, message string, result ratelimit.Result) {
+	retryAfter := ratelimit.CeilSeconds(result.RetryAfter)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"code":        429,
+		"message":     message,
+		"class":       class,
+		"retry_after": retryAfter,
+	})
+}
+
+// rateLimitIdentity 限流使用的调用方标识
+func rateLimitIdentity(c *gin.Context) (identity, senderID string) {
+	principal := GetPrincipal(c)
+	switch {
+	case principal == nil || principal.Type == auth.PrincipalHeader:
+		return "ip:" + c.ClientIP(), ""
+	case principal.IsSender():
+		// 同一发送者的多个密钥共享额度
+		return "sender:" + principal.ID, principal.ID
+	case principal.KeyID != "":
+		return "key:" + principal.KeyID, ""
+	default:
+		return "user:" + principal.ID, ""
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"miemie/internal/config"
+	"miemie/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuthFailureLimitBlocksAfterRepeatedFailures(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := ratelimit.NewLimiter(config.RateLimitConfig{
+		Enabled:           true,
+		RequestsPerMinute: 1000,
+		BurstSize:         100,
+		AuthFailure:       config.RateLimitRule{RequestsPerMinute: 1, BurstSize: 2},
+	})
+	t.Cleanup(limiter.Close)
+
+	r := gin.New()
+	r.Use(AuthFailureLimit(limiter))
+	r.GET("/", func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "Bearer good" {
+			abortUnauthorized(c, "Invalid API key")
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	request := func(credential, ip string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+credential)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 成功的请求不消耗令牌
+	for i := 0; i < 5; i++ {
+		if code := request("good", "10.0.0.1"); code != http.StatusOK {
+			t.Fatalf("valid request %d = %d", i, code)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if code := request("bad", "10.0.0.1"); code != http.StatusUnauthorized {
+			t.Fatalf("failed attempt %d = %d, want 401", i, code)
+		}
+	}
+	if code := request("bad", "10.0.0.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("attempt after limit = %d, want 429", code)
+	}
+	if code := request("bad", "10.0.0.2"); code != http.StatusUnauthorized {
+		t.Fatalf("other IP = %d, want 401", code)
+	}
+}
@@ -8,21 +8,10 @@ import (
 )
 
 // UserIDMiddleware 从请求头中提取用户ID并设置到上下文
+// 不做任何认证，只用于开发模式，正式部署使用 AuthMiddleware
 func UserIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// 从Header中获取User-ID
-		userID := c.GetHeader("User-ID")
-
-		// 如果没有User-ID，使用默认值
-		if userID == "" {
-			userID = "default"
-		}
-
-		// 清理和验证用户ID
-		userID = strings.TrimSpace(userID)
-		if userID == "" {
-			userID = "default"
-		}
+		userID := resolveHeaderUserID(c)
 
 		// 设置到上下文
 		c.Set("user_id", userID)
@@ -34,6 +23,23 @@ func UserIDMiddleware() gin.HandlerFunc {
 	}
 }
 
+// resolveHeaderUserID 从 User-ID 头获取用户ID
+// 浏览器的 WebSocket/EventSource 无法设置请求头，没有 User-ID 头时使用 user_id 参数
+func resolveHeaderUserID(c *gin.Context) string {
+	// 从Header中获取User-ID
+	userID := c.GetHeader("User-ID")
+	if userID == "" {
+		userID = c.Query("user_id")
+	}
+
+	// 清理和验证用户ID，如果没有User-ID，使用默认值
+	userID = strings.TrimSpace(userID)
+	if userID == "" {
+		userID = "default"
+	}
+	return userID
+}
+
 // RequireUserID 确保请求包含有效的用户ID
 func RequireUserID() gin.HandlerFunc {
 	return func(c *gin.Context) {
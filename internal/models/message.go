@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"regexp"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,6 +12,7 @@ import (
 
 type Message struct {
 	ID          string                 `json:"id"`
+	Seq         int64                  `json:"seq,omitempty"` // 工作空间内单调递增的序号，写入时分配
 	UserID      string                 `json:"user_id"`
 	ChannelID   string                 `json:"channel_id"`
 	Title       string                 `json:"title"`
@@ -21,6 +23,9 @@ type Message struct {
 	CreatedAt   time.Time              `json:"created_at"`
 	UpdatedAt   time.Time              `json:"updated_at"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	CollapseKey string                 `json:"collapse_key,omitempty"` // 同一频道中相同折叠键的新消息替换旧消息
+	Replaces    string                 `json:"replaces,omitempty"`     // 写入时被替换的旧消息ID
+	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`   // 过期时间，过期后不再返回并被后台清理
 }
 
 type CreateMessageRequest struct {
@@ -32,6 +37,28 @@ type CreateMessageRequest struct {
 	Priority    int                    `json:"priority"`
 	Sender      string                 `json:"sender"`
 	Metadata    map[string]interface{} `json:"metadata,omitempty"`
+	CollapseKey string                 `json:"collapse_key,omitempty"` // 折叠键，替换同一频道中折叠键相同的上一条消息
+
+	// 接收者选择（三者可组合，均为空时投递给 user_id 或当前用户）
+	Recipients []string `json:"recipients,omitempty"` // 显式指定的用户列表
+	Groups     []string `json:"groups,omitempty"`     // 命名用户组
+	Broadcast  bool     `json:"broadcast,omitempty"`  // 发送给所有已知工作空间
+
+	CallbackURL string `json:"callback_url,omitempty"` // 投递状态变化时回调的地址
+	DedupKey    string `json:"dedup_key,omitempty"`    // 去重键，窗口内重复提交返回首次提交的消息ID
+
+	// 定时投递（二选一，均为空时立即投递）
+	DeliverAt    *time.Time `json:"deliver_at,omitempty"`    // 投递时间（RFC3339）
+	DelaySeconds int        `json:"delay_seconds,omitempty"` // 延迟投递的秒数
+
+	// 消息有效期（二选一，均为空时不过期）
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`  // 过期时间（RFC3339）
+	TTLSeconds int        `json:"ttl_seconds,omitempty"` // 自投递起的有效秒数
+}
+
+// HasRecipientSelectors 是否指定了群发接收者
+func (req *CreateMessageRequest) HasRecipientSelectors() bool {
+	return len(req.Recipients) > 0 || len(req.Groups) > 0 || req.Broadcast
 }
 
 // NewMessage 创建新消息，需要传入用户ID
@@ -57,9 +84,37 @@ func NewMessage(req CreateMessageRequest, userID string) *Message {
 		CreatedAt:   now,
 		UpdatedAt:   now,
 		Metadata:    req.Metadata,
+		CollapseKey: req.CollapseKey,
 	}
 }
 
+// CopyFor 为指定接收者复制一份消息
+func (m *Message) CopyFor(userID string) *Message {
+	copied := *m
+	copied.UserID = userID
+	return &copied
+}
+
+// 推送事件类型
+const (
+	EventMessage = "message" // 新消息
+	EventUpdate  = "update"  // 替换了同一折叠键的旧消息
+	EventExpired = "expired" // 消息已过期并被清理
+)
+
+// EventType 推送消息时使用的事件类型
+func (m *Message) EventType() string {
+	if m.Replaces != "" {
+		return EventUpdate
+	}
+	return EventMessage
+}
+
+// IsExpired 消息是否已过期
+func (m *Message) IsExpired() bool {
+	return m.ExpiresAt != nil && !m.ExpiresAt.After(time.Now())
+}
+
 // GenerateUUID 生成UUID
 func GenerateUUID() string {
 	bytes := make([]byte, 16)
@@ -69,18 +124,108 @@ func GenerateUUID() string {
 
 type Channel struct {
 	ID          string    `json:"id"`
+	Slug        string    `json:"slug,omitempty"` // 工作空间内唯一，发送方可以用它代替频道ID
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	CreatedBy   string    `json:"created_by"`
 	CreatedAt   time.Time `json:"created_at"`
 	LastMessageAt *time.Time `json:"last_message_at,omitempty"`
+	Retention   *RetentionPolicy `json:"retention,omitempty"`
+	UnreadCount int `json:"unread_count"` // 静音频道为 0
+	Muted       bool       `json:"muted"`
+	MutedUntil  *time.Time `json:"muted_until,omitempty"` // 为空表示一直静音
+}
+
+// channelSlugPattern 频道标识：小写字母、数字、- 和 _，以字母或数字开头，最长 64 个字符
+var channelSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ValidChannelSlug 是否是合法的频道标识，频道ID也符合这个格式
+func ValidChannelSlug(slug string) bool {
+	return channelSlugPattern.MatchString(slug)
+}
+
+// RetentionPolicy 频道消息保留策略，由后台任务定期执行
+type RetentionPolicy struct {
+	MaxAgeDays  int  `json:"max_age_days,omitempty"`  // 保留天数，0 表示不按时间清理
+	MaxMessages int  `json:"max_messages,omitempty"`  // 最多保留的消息数，0 表示不限制
+	KeepStarred bool `json:"keep_starred,omitempty"`  // 星标消息不会被清理，也不计入 max_messages
+}
+
+// IsEmpty 策略是否不会清理任何消息
+func (p *RetentionPolicy) IsEmpty() bool {
+	return p == nil || (p.MaxAgeDays <= 0 && p.MaxMessages <= 0)
+}
+
+// ReadingPosition 频道的阅读位置，序号不超过 Position 的消息都视为已读
+type ReadingPosition struct {
+	ChannelID         string     `json:"channel_id"`
+	LastReadMessageID string     `json:"last_read_message_id,omitempty"`
+	LastReadAt        *time.Time `json:"last_read_at,omitempty"`
+	Position          int64      `json:"position"`
+	UpdatedAt         *time.Time `json:"updated_at,omitempty"` // 阅读位置最近一次前进或退回的时间
 }
 
 type ReadStatus struct {
 	MessageID  string    `json:"message_id"`
-	ReadAt     time.Time `json:"read_at"`
+	ReadAt     *time.Time `json:"read_at,omitempty"` // 为空表示未读
 	ReadDevice string    `json:"read_device"`
 	ArchivedAt *time.Time `json:"archived_at,omitempty"`
 	StarredAt  *time.Time `json:"starred_at,omitempty"`
 	Metadata   map[string]interface{} `json:"metadata,omitempty"`
-}
\ No newline at end of file
+	ChangedAt  *time.Time `json:"changed_at,omitempty"` // 最近一次已读、未读、星标或归档变更的时间
+}
+
+// SearchQuery 消息全文搜索条件
+type SearchQuery struct {
+	Query       string     `json:"q"`
+	ChannelID   string     `json:"channel_id,omitempty"`
+	Sender      string     `json:"sender,omitempty"`
+	MessageType string     `json:"message_type,omitempty"`
+	MinPriority int        `json:"priority_min,omitempty"` // 0 表示不限
+	MaxPriority int        `json:"priority_max,omitempty"` // 0 表示不限
+	Since       *time.Time `json:"since,omitempty"`
+	Until       *time.Time `json:"until,omitempty"`
+	Sort        string     `json:"sort,omitempty"` // relevance 或 newest
+	Limit       int        `json:"limit"`
+	Offset      int        `json:"offset"`
+}
+
+// SearchHit 单条搜索结果，标题和摘要中的匹配部分用 <mark> 包裹
+type SearchHit struct {
+	Message          *Message `json:"message"`
+	HighlightedTitle string   `json:"highlighted_title"`
+	Snippet          string   `json:"snippet"`
+	Score            float64  `json:"score"`
+}
+
+// SearchResults 搜索结果页
+type SearchResults struct {
+	Hits  []*SearchHit `json:"hits"`
+	Total int          `json:"total"`
+	Mode  string       `json:"mode"` // fts 或 like（FTS5 不可用或搜索词过短时）
+}
+
+// StatsCounter 收到和已读的消息数
+type StatsCounter struct {
+	Received int     `json:"received"`
+	Read     int     `json:"read"`
+	ReadRate float64 `json:"read_rate"` // 已读数 / 收到数，按各自发生的日期统计，跨时间段时可能大于 1
+}
+
+// StatsBucket 一个时间段（天、周或月）的阅读统计
+type StatsBucket struct {
+	Start      string                   `json:"start"` // 时间段第一天，UTC 日期
+	End        string                   `json:"end"`   // 时间段最后一天
+	Total      *StatsCounter            `json:"total"`
+	Channels   map[string]*StatsCounter `json:"channels"`
+	Priorities map[string]*StatsCounter `json:"priorities"`
+}
+
+// StatsHistory 一段时间内按天、周或月汇总的阅读统计
+type StatsHistory struct {
+	Bucket  string         `json:"bucket"`
+	From    string         `json:"from"`
+	To      string         `json:"to"`
+	Total   *StatsBucket   `json:"total"`
+	Buckets []*StatsBucket `json:"buckets"`
+}
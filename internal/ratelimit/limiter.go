@@ -0,0 +1,162 @@
+package ratelimit
+
+import (
+	"math"
+	"miemie/internal/config"
+	"sync"
+	"time"
+)
+
+// 限流类别，同一调用方的发送和读取请求使用不同的令牌桶
+const (
+	ClassRead = "read"
+	ClassSend = "send"
+	ClassAuth = "auth" // 认证失败，按客户端IP计数
+)
+
+// Result 一次限流检查的结果
+type Result struct {
+	Allowed    bool
+	Limit      int           // 令牌桶容量
+	Remaining  int           // 剩余令牌
+	RetryAfter time.Duration // 被拒绝时距离下一个令牌的时间
+	Reset      time.Duration // 距离令牌桶补满的时间
+}
+
+// bucket 令牌桶
+type bucket struct {
+	tokens    float64
+	lastFill  time.Time
+	capacity  float64
+	perSecond float64
+}
+
+// full 到 now 时令牌桶是否已补满，补满的桶与新建的桶等价，可以清理
+func (b *bucket) full(now time.Time) bool {
+	return b.tokens+now.Sub(b.lastFill).Seconds()*b.perSecond >= b.capacity
+}
+
+// Limiter 按调用方和类别划分的令牌桶限流器
+type Limiter struct {
+	cfg     config.RateLimitConfig
+	buckets map[string]*bucket
+	mu      sync.Mutex
+
+	stopCleanup chan struct{}
+	closeOnce   sync.Once
+}
+
+// NewLimiter 创建限流器
+func NewLimiter(cfg config.RateLimitConfig) *Limiter {
+	l := &Limiter{
+		cfg:         cfg,
+		buckets:     make(map[string]*bucket),
+		stopCleanup: make(chan struct{}),
+	}
+
+	go l.cleanupLoop()
+	return l
+}
+
+// Allow 为调用方消耗一个令牌，senderID 用于查找发送者的覆盖配置
+func (l *Limiter) Allow(class, identity, senderID string) Result {
+	return l.take(class+":"+identity, l.rule(class, senderID), time.Now(), true)
+}
+
+// Check 检查调用方是否还有令牌，不消耗令牌
+func (l *Limiter) Check(class, identity string) Result {
+	return l.take(class+":"+identity, l.rule(class, ""), time.Now(), false)
+}
+
+// rule 类别对应的令牌桶规则
+func (l *Limiter) rule(class, senderID string) config.RateLimitRule {
+	switch class {
+	case ClassSend:
+		return l.cfg.SendRule(senderID)
+	case ClassAuth:
+		return l.cfg.AuthFailureRule()
+	default:
+		return l.cfg.ReadRule()
+	}
+}
+
+// take 按规则补充令牌，consume 为 true 时消耗一个令牌
+func (l *Limiter) take(key string, rule config.RateLimitRule, now time.Time, consume bool) Result {
+	capacity := float64(rule.BurstSize)
+	perSecond := float64(rule.RequestsPerMinute) / 60
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, exists := l.buckets[key]
+	if !exists && !consume {
+		// 只检查时不创建令牌桶，没有桶等价于桶是满的
+		return Result{Allowed: true, Limit: rule.BurstSize, Remaining: rule.BurstSize}
+	}
+	if !exists {
+		b = &bucket{tokens: capacity, lastFill: now}
+		l.buckets[key] = b
+	} else {
+		elapsed := now.Sub(b.lastFill).Seconds()
+		b.tokens = math.Min(capacity, b.tokens+elapsed*perSecond)
+		b.lastFill = now
+	}
+	b.capacity = capacity
+	b.perSecond = perSecond
+
+	result := Result{Limit: rule.BurstSize}
+	if b.tokens >= 1 {
+		if consume {
+			b.tokens--
+		}
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - b.tokens) / perSecond)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsToDuration((capacity - b.tokens) / perSecond)
+	return result
+}
+
+// Close 停止清理协程
+func (l *Limiter) Close() {
+	l.closeOnce.Do(func() {
+		close(l.stopCleanup)
+	})
+}
+
+// cleanupLoop 定期清理已补满的令牌桶
+func (l *Limiter) cleanupLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.cleanupOnce(time.Now())
+		case <-l.stopCleanup:
+			return
+		}
+	}
+}
+
+// cleanupOnce 执行一次清理
+func (l *Limiter) cleanupOnce(now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// CeilSeconds 向上取整为秒
+func CeilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,311 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"miemie/internal/config"
+	"miemie/internal/logger"
+	"miemie/internal/models"
+	"time"
+)
+
+// DefaultChannelID 默认频道，不能删除，删除其他频道时消息可以移到这里
+const DefaultChannelID = "default"
+
+// ErrDefaultChannel 默认频道不能删除
+var ErrDefaultChannel = errors.New("the default channel cannot be deleted")
+
+// ErrChannelNotFound 频道不存在
+var ErrChannelNotFound = errors.New("channel not found")
+
+// mutedCondition 静音中的频道，截止时间按 UTC 写入，参数为 nowUTC()
+const mutedCondition = "is_muted AND (muted_until IS NULL OR muted_until > ?)"
+
+// GetChannelByRef 按频道ID或标识查找频道，ID 优先
+func (ums *UserMessageStorage) GetChannelByRef(ref string) (*models.Channel, error) {
+	query := "SELECT " + channelColumns + " FROM channels WHERE id = ? OR slug = ? ORDER BY id = ? DESC LIMIT 1"
+	channel, err := scanChannel(ums.workspace.MessagesDB.QueryRow(query, ref, ref, ref))
+	if err == sql.ErrNoRows {
+		return nil, ErrChannelNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get channel: %w", err)
+	}
+	return channel, nil
+}
+
+// ChannelIDOf 把频道ID或标识解析为频道ID，频道不存在时原样返回（按不存在的频道过滤得到空结果）
+func (ums *UserMessageStorage) ChannelIDOf(ref string) (string, error) {
+	channel, err := ums.GetChannelByRef(ref)
+	if err == ErrChannelNotFound {
+		return ref, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return channel.ID, nil
+}
+
+// ResolveChannel 查找消息要写入的频道，频道不存在时按 policy 处理：
+// allow 以 ref 为标识创建频道（频道数达到 maxChannels 时写入默认频道），default 写入默认频道，deny 返回 ErrChannelNotFound
+func (ums *UserMessageStorage) ResolveChannel(ref, policy string, maxChannels int) (*models.Channel, error) {
+	channel, err := ums.GetChannelByRef(ref)
+	if err != ErrChannelNotFound {
+		return channel, err
+	}
+
+	switch policy {
+	case config.ChannelAutoCreateDeny:
+		return nil, ErrChannelNotFound
+	case config.ChannelAutoCreateDefault:
+		return ums.GetChannel(DefaultChannelID)
+	}
+
+	if !models.ValidChannelSlug(ref) {
+		return ums.GetChannel(DefaultChannelID)
+	}
+	if maxChannels > 0 {
+		count, err := ums.CountChannels()
+		if err != nil {
+			return nil, err
+		}
+		if count >= maxChannels {
+			logger.Infof("User %s reached the channel limit, message for channel %s goes to the default channel",
+				ums.workspace.UserID, ref)
+			return ums.GetChannel(DefaultChannelID)
+		}
+	}
+
+	channel = &models.Channel{
+		ID:        models.GenerateUUID(),
+		Slug:      ref,
+		Name:      ref,
+		CreatedBy: "system",
+		CreatedAt: time.Now(),
+	}
+	if err := ums.CreateChannel(channel); err != nil {
+		// 同时投递的另一条消息可能已经创建了这个频道
+		if existing, lookupErr := ums.GetChannelByRef(ref); lookupErr == nil {
+			return existing, nil
+		}
+		return nil, fmt.Errorf("failed to create channel: %w", err)
+	}
+	logger.Infof("Created channel %s (%s) for user %s", ref, channel.ID, ums.workspace.UserID)
+	return channel, nil
+}
+
+// UpdateChannel 修改频道名称、描述和标识，nil 表示不修改，标识为空字符串时清除
+func (ums *UserMessageStorage) UpdateChannel(channelID string, name, description, slug *string) error {
+	query := "UPDATE channels SET name = COALESCE(?, name), description = COALESCE(?, description)"
+	args := []interface{}{name, description}
+	if slug != nil {
+		query += ", slug = NULLIF(?, '')"
+		args = append(args, *slug)
+	}
+	_, err := ums.workspace.MessagesDB.Exec(query+" WHERE id = ?", append(args, channelID)...)
+	if err != nil {
+		return fmt.Errorf("failed to update channel: %w", err)
+	}
+	return nil
+}
+
+// SetChannelMute 静音或取消静音频道，until 为空表示一直静音
+func (ums *UserMessageStorage) SetChannelMute(channelID string, muted bool, until *time.Time) error {
+	var mutedUntil interface{}
+	if muted && until != nil {
+		mutedUntil = until.UTC()
+	}
+	_, err := ums.workspace.MessagesDB.Exec(`
+		INSERT INTO user_channels (channel_id, user_id, is_muted, muted_until) VALUES (?, ?, ?, ?)
+		ON CONFLICT(channel_id, user_id) DO UPDATE SET is_muted = excluded.is_muted, muted_until = excluded.muted_until
+	`, channelID, ums.workspace.UserID, muted, mutedUntil)
+	if err != nil {
+		return fmt.Errorf("failed to update channel mute: %w", err)
+	}
+	return nil
+}
+
+// IsChannelMuted 频道当前是否静音
+func (ums *UserMessageStorage) IsChannelMuted(channelID string) (bool, error) {
+	var muted bool
+	err := ums.workspace.MessagesDB.QueryRow(
+		"SELECT COUNT(*) > 0 FROM user_channels WHERE channel_id = ? AND "+mutedCondition, channelID, nowUTC(),
+	).Scan(&muted)
+	if err != nil {
+		return false, fmt.Errorf("failed to check channel mute: %w", err)
+	}
+	return muted, nil
+}
+
+// mutedChannels 当前静音中的频道
+func (ums *UserMessageStorage) mutedChannels() (map[string]bool, error) {
+	rows, err := ums.workspace.MessagesDB.Query("SELECT channel_id FROM user_channels WHERE "+mutedCondition, nowUTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query muted channels: %w", err)
+	}
+	defer rows.Close()
+
+	muted := make(map[string]bool)
+	for rows.Next() {
+		var channelID string
+		if err := rows.Scan(&channelID); err != nil {
+			return nil, fmt.Errorf("failed to scan muted channel: %w", err)
+		}
+		muted[channelID] = true
+	}
+	return muted, rows.Err()
+}
+
+// DeleteChannel 删除频道，cascade 时删除频道中的消息，否则把消息移到默认频道，返回删除或移动的消息数
+// 消息库中的修改在一个事务中完成，提交后再清理已读库；清理可以重复执行，
+// 频道已经删除时只补做清理并返回 ErrChannelNotFound，重试的删除请求能完成上次中断的清理
+func (ums *UserMessageStorage) DeleteChannel(channelID string, cascade bool) (int, error) {
+	if channelID == DefaultChannelID {
+		return 0, ErrDefaultChannel
+	}
+	if _, err := ums.GetChannel(channelID); err != nil {
+		if err == ErrChannelNotFound {
+			if cleanupErr := ums.cleanupDeletedChannel(channelID); cleanupErr != nil {
+				return 0, cleanupErr
+			}
+		}
+		return 0, err
+	}
+
+	if !cascade {
+		if err := ums.prepareChannelMove(channelID, DefaultChannelID); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := ums.workspace.MessagesDB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	count, err := deleteChannelTx(tx, channelID, DefaultChannelID, cascade)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return count, ums.cleanupDeletedChannel(channelID)
+}
+
+// deleteChannelTx 在消息库事务中删除频道设置、删除或移动消息，最后删除频道
+// 移动时折叠键与目标频道中的消息冲突的去掉折叠键，两条消息都保留
+func deleteChannelTx(tx *sql.Tx, channelID, targetID string, cascade bool) (int, error) {
+	if _, err := tx.Exec("DELETE FROM user_channels WHERE channel_id = ?", channelID); err != nil {
+		return 0, fmt.Errorf("failed to delete channel settings: %w", err)
+	}
+
+	var result sql.Result
+	var err error
+	if cascade {
+		result, err = tx.Exec("DELETE FROM messages WHERE channel_id = ?", channelID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to delete messages: %w", err)
+		}
+	} else {
+		_, err = tx.Exec(`
+			UPDATE messages SET collapse_key = NULL
+			WHERE channel_id = ? AND collapse_key IN (
+				SELECT collapse_key FROM messages WHERE channel_id = ? AND collapse_key IS NOT NULL
+			)
+		`, channelID, targetID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to clear conflicting collapse keys: %w", err)
+		}
+		result, err = tx.Exec("UPDATE messages SET channel_id = ? WHERE channel_id = ?", targetID, channelID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to move messages: %w", err)
+		}
+		_, err = tx.Exec(`
+			UPDATE channels SET last_message_at = (SELECT MAX(created_at) FROM messages WHERE channel_id = ?)
+			WHERE id = ?
+		`, targetID, targetID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update channel: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM channels WHERE id = ?", channelID); err != nil {
+		return 0, fmt.Errorf("failed to delete channel: %w", err)
+	}
+	count, _ := result.RowsAffected()
+	return int(count), nil
+}
+
+// prepareChannelMove 移动消息前调整已读库，使消息移到目标频道后已读状态不变；
+// 这些修改本身不改变任何消息的已读状态，移动失败时不需要撤销：
+// 原频道阅读位置之前的消息按阅读位置的 last_read_at 逐条写入已读记录，目标频道阅读位置退回到最早一条未读消息之前
+func (ums *UserMessageStorage) prepareChannelMove(channelID, targetID string) error {
+	position, err := ums.GetReadingPosition(channelID)
+	if err != nil {
+		return err
+	}
+	if position.Position > 0 {
+		err := ums.withReadStatus(func(conn *sql.Conn) error {
+			now := time.Now()
+			readAt := now
+			if position.LastReadAt != nil {
+				readAt = *position.LastReadAt
+			}
+			_, err := conn.ExecContext(context.Background(), `
+				INSERT INTO rs.read_status (message_id, read_at, changed_at)
+				SELECT id, ?, ? FROM messages WHERE channel_id = ? AND seq <= ?
+				ON CONFLICT(message_id) DO UPDATE SET read_at = excluded.read_at, changed_at = excluded.changed_at
+				WHERE read_status.read_at IS NULL
+			`, readAt, now, channelID, position.Position)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to keep read status: %w", err)
+		}
+	}
+
+	var lowestUnread sql.NullInt64
+	err = ums.withReadStatus(func(conn *sql.Conn) error {
+		return conn.QueryRowContext(context.Background(), `
+			SELECT MIN(seq) FROM messages WHERE channel_id = ?
+			AND NOT EXISTS (SELECT 1 FROM rs.read_status r WHERE r.message_id = messages.id AND r.read_at IS NOT NULL)
+		`, channelID).Scan(&lowestUnread)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query unread messages: %w", err)
+	}
+	if !lowestUnread.Valid {
+		return nil
+	}
+
+	target, err := ums.GetReadingPosition(targetID)
+	if err != nil {
+		return err
+	}
+	if lowestUnread.Int64 > target.Position {
+		return nil
+	}
+	return ums.lowerReadingPosition(targetID, target.Position, lowestUnread.Int64)
+}
+
+// cleanupDeletedChannel 清理已删除频道在已读库中的数据：阅读位置和已不存在的消息的已读记录
+func (ums *UserMessageStorage) cleanupDeletedChannel(channelID string) error {
+	if _, err := ums.workspace.ReadDB.Exec("DELETE FROM reading_position WHERE channel_id = ?", channelID); err != nil {
+		return fmt.Errorf("failed to delete reading position: %w", err)
+	}
+	err := ums.withReadStatus(func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(context.Background(), `
+			DELETE FROM rs.read_status
+			WHERE NOT EXISTS (SELECT 1 FROM messages m WHERE m.id = rs.read_status.message_id)
+		`)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete read status: %w", err)
+	}
+	return nil
+}
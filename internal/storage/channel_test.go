@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"miemie/internal/models"
+	"testing"
+	"time"
+)
+
+func TestChannelIDOfResolvesSlug(t *testing.T) {
+	ums := newTestStorage(t)
+	if err := ums.CreateChannel(&models.Channel{ID: "c1", Slug: "ops", Name: "Ops", CreatedBy: "test", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+
+	for ref, want := range map[string]string{"ops": "c1", "c1": "c1", "missing": "missing"} {
+		id, err := ums.ChannelIDOf(ref)
+		if err != nil {
+			t.Fatalf("ChannelIDOf(%s): %v", ref, err)
+		}
+		if id != want {
+			t.Errorf("ChannelIDOf(%s) = %s, want %s", ref, id, want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"miemie/internal/models"
+	"miemie/internal/workspace"
+	"testing"
+	"time"
+)
+
+func newTestStorage(t *testing.T) *UserMessageStorage {
+	t.Helper()
+	manager := workspace.NewManager(t.TempDir())
+	t.Cleanup(func() { manager.Close() })
+
+	ws, err := manager.GetUserWorkspace("alice")
+	if err != nil {
+		t.Fatalf("GetUserWorkspace: %v", err)
+	}
+	return NewUserMessageStorage(ws)
+}
+
+func collapsedMessage(id, channelID, key string, createdAt time.Time) *models.Message {
+	return &models.Message{
+		ID:          id,
+		ChannelID:   channelID,
+		Title:       "build " + id,
+		Content:     "status of " + id,
+		MessageType: "text",
+		Priority:    5,
+		CollapseKey: key,
+		CreatedAt:   createdAt,
+		UpdatedAt:   createdAt,
+	}
+}
+
+func TestCollapseKeyReplacesOlderMessage(t *testing.T) {
+	ums := newTestStorage(t)
+	start := time.Now().Add(-time.Minute)
+
+	first := collapsedMessage("m1", DefaultChannelID, "build-42", start)
+	if err := ums.CreateMessage(first); err != nil {
+		t.Fatalf("CreateMessage m1: %v", err)
+	}
+	if first.Replaces != "" {
+		t.Fatalf("m1 Replaces = %q, want empty", first.Replaces)
+	}
+	if err := ums.MarkAsRead("m1", "phone"); err != nil {
+		t.Fatalf("MarkAsRead: %v", err)
+	}
+
+	second := collapsedMessage("m2", DefaultChannelID, "build-42", start.Add(time.Second))
+	if err := ums.CreateMessage(second); err != nil {
+		t.Fatalf("CreateMessage m2: %v", err)
+	}
+	if second.Replaces != "m1" {
+		t.Fatalf("m2 Replaces = %q, want m1", second.Replaces)
+	}
+	if second.Seq <= first.Seq {
+		t.Fatalf("m2 seq %d not after m1 seq %d", second.Seq, first.Seq)
+	}
+
+	if _, err := ums.GetMessage("m1"); err == nil {
+		t.Fatalf("replaced message m1 still exists")
+	}
+	got, err := ums.GetMessage("m2")
+	if err != nil {
+		t.Fatalf("GetMessage m2: %v", err)
+	}
+	if got.Title != "build m2" || got.CollapseKey != "build-42" {
+		t.Fatalf("m2 = %+v", got)
+	}
+
+	// 替换后的消息重新变为未读
+	unread, err := ums.GetUnreadCount(DefaultChannelID)
+	if err != nil {
+		t.Fatalf("GetUnreadCount: %v", err)
+	}
+	if unread != 1 {
+		t.Fatalf("unread = %d, want 1", unread)
+	}
+
+	// 断线重放从 m1 的序号之后能看到替换后的消息
+	messages, err := ums.GetMessagesAfterSeq(first.Seq, 10)
+	if err != nil {
+		t.Fatalf("GetMessagesAfterSeq: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != "m2" {
+		t.Fatalf("messages after m1 seq = %d, want only m2", len(messages))
+	}
+}
+
+func TestCollapseKeyKeepsStarredAndArchived(t *testing.T) {
+	ums := newTestStorage(t)
+	start := time.Now().Add(-time.Minute)
+
+	if err := ums.CreateMessage(collapsedMessage("m1", DefaultChannelID, "build-42", start)); err != nil {
+		t.Fatalf("CreateMessage m1: %v", err)
+	}
+	if err := ums.MarkAsRead("m1", "phone"); err != nil {
+		t.Fatalf("MarkAsRead: %v", err)
+	}
+	if _, err := ums.SetStarred("m1", true); err != nil {
+		t.Fatalf("SetStarred: %v", err)
+	}
+	if _, err := ums.SetArchived("m1", true); err != nil {
+		t.Fatalf("SetArchived: %v", err)
+	}
+
+	second := collapsedMessage("m2", DefaultChannelID, "build-42", start.Add(time.Second))
+	if err := ums.CreateMessage(second); err != nil {
+		t.Fatalf("CreateMessage m2: %v", err)
+	}
+
+	status, err := ums.GetReadStatus("m2")
+	if err != nil {
+		t.Fatalf("GetReadStatus m2: %v", err)
+	}
+	if status.ReadAt != nil || status.StarredAt == nil || status.ArchivedAt == nil {
+		t.Fatalf("m2 status = %+v, want unread, starred and archived", status)
+	}
+
+	// 重试时按记录的被替换消息再次迁移，不会改动新消息的状态
+	if err := ums.MarkAsRead("m2", "phone"); err != nil {
+		t.Fatalf("MarkAsRead m2: %v", err)
+	}
+	replaces, err := ums.ReplacedMessageID("m2")
+	if err != nil || replaces != "m1" {
+		t.Fatalf("ReplacedMessageID = %q, %v, want m1", replaces, err)
+	}
+	retry := collapsedMessage("m2", DefaultChannelID, "build-42", start.Add(time.Second))
+	retry.Replaces = replaces
+	if err := ums.MoveReplacedReadStatus(retry); err != nil {
+		t.Fatalf("MoveReplacedReadStatus: %v", err)
+	}
+	status, err = ums.GetReadStatus("m2")
+	if err != nil {
+		t.Fatalf("GetReadStatus m2: %v", err)
+	}
+	if status.ReadAt == nil || status.StarredAt == nil {
+		t.Fatalf("m2 status after retry = %+v, want read and starred", status)
+	}
+}
+
+func TestCollapseKeyIgnoresOlderLateMessage(t *testing.T) {
+	ums := newTestStorage(t)
+	start := time.Now().Add(-time.Minute)
+
+	newer := collapsedMessage("m2", DefaultChannelID, "build-42", start.Add(time.Second))
+	if err := ums.CreateMessage(newer); err != nil {
+		t.Fatalf("CreateMessage m2: %v", err)
+	}
+
+	// 重试晚到的旧消息不能覆盖更新的消息
+	late := collapsedMessage("m1", DefaultChannelID, "build-42", start)
+	if err := ums.CreateMessage(late); err != ErrMessageSuperseded {
+		t.Fatalf("CreateMessage late m1 error = %v, want ErrMessageSuperseded", err)
+	}
+	if _, err := ums.GetMessage("m1"); err == nil {
+		t.Fatalf("superseded message m1 was stored")
+	}
+	got, err := ums.GetMessage("m2")
+	if err != nil || got.Seq != newer.Seq {
+		t.Fatalf("m2 after late message = %+v, %v", got, err)
+	}
+
+	// 同一条消息重试时原地写入，不算被替换
+	retry := collapsedMessage("m2", DefaultChannelID, "build-42", start.Add(time.Second))
+	if err := ums.CreateMessage(retry); err != nil {
+		t.Fatalf("retry m2: %v", err)
+	}
+	if retry.Replaces != "" {
+		t.Fatalf("retry Replaces = %q, want empty", retry.Replaces)
+	}
+}
+
+func TestCollapseKeyIsScopedToChannel(t *testing.T) {
+	ums := newTestStorage(t)
+	start := time.Now().Add(-time.Minute)
+
+	if err := ums.CreateChannel(&models.Channel{ID: "ops", Name: "Ops", CreatedBy: "test", CreatedAt: start}); err != nil {
+		t.Fatalf("CreateChannel: %v", err)
+	}
+	if err := ums.CreateMessage(collapsedMessage("m1", DefaultChannelID, "build-42", start)); err != nil {
+		t.Fatalf("CreateMessage m1: %v", err)
+	}
+	other := collapsedMessage("m2", "ops", "build-42", start.Add(time.Second))
+	if err := ums.CreateMessage(other); err != nil {
+		t.Fatalf("CreateMessage m2: %v", err)
+	}
+	if other.Replaces != "" {
+		t.Fatalf("message in another channel replaced %q", other.Replaces)
+	}
+	for _, id := range []string{"m1", "m2"} {
+		if _, err := ums.GetMessage(id); err != nil {
+			t.Fatalf("GetMessage %s: %v", id, err)
+		}
+	}
+
+	// 没有折叠键的消息互不影响
+	for _, id := range []string{"m3", "m4"} {
+		if err := ums.CreateMessage(collapsedMessage(id, DefaultChannelID, "", start.Add(2*time.Second))); err != nil {
+			t.Fatalf("CreateMessage %s: %v", id, err)
+		}
+	}
+	messages, err := ums.GetMessages(DefaultChannelID, 10, 0, nil)
+	if err != nil {
+		t.Fatalf("GetMessages: %v", err)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("default channel has %d messages, want 3", len(messages))
+	}
+}
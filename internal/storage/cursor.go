@@ -0,0 +1,354 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"miemie/internal/models"
+	"time"
+)
+
+// ErrInvalidCursor 游标无法解析
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// 分页方向
+const (
+	DirectionOlder = "older" // 比游标更早的消息（向下翻页）
+	DirectionNewer = "newer" // 比游标更新的消息（向上翻页）
+)
+
+// MessageCursor 消息分页游标，按 (created_at, id) 唯一定位一条消息
+type MessageCursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+// SyncToken 增量同步位置：已同步的最新消息序号、最新已读状态变更和最新阅读位置变更
+type SyncToken struct {
+	Seq      int64          `json:"s,omitempty"`
+	Message  *MessageCursor `json:"m,omitempty"` // 旧版本按创建时间同步的位置，仅用于兼容
+	Read     *MessageCursor `json:"r,omitempty"` // 时间字段为 changed_at（旧版本为 read_at，迁移时按 read_at 回填）
+	Position *MessageCursor `json:"p,omitempty"` // 时间字段为阅读位置的 updated_at，ID 字段为频道ID
+}
+
+// CursorOf 返回指向消息的游标
+func CursorOf(message *models.Message) *MessageCursor {
+	return &MessageCursor{CreatedAt: message.CreatedAt, ID: message.ID}
+}
+
+// EncodeCursor 将游标编码为不透明字符串
+func EncodeCursor(cursor *MessageCursor) string {
+	return encodeOpaque(cursor)
+}
+
+// DecodeCursor 解析不透明游标
+func DecodeCursor(s string) (*MessageCursor, error) {
+	cursor := &MessageCursor{}
+	if err := decodeOpaque(s, cursor); err != nil {
+		return nil, err
+	}
+	if cursor.ID == "" || cursor.CreatedAt.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// EncodeSyncToken 将同步位置编码为不透明字符串
+func EncodeSyncToken(token *SyncToken) string {
+	return encodeOpaque(token)
+}
+
+// DecodeSyncToken 解析同步位置
+func DecodeSyncToken(s string) (*SyncToken, error) {
+	token := &SyncToken{}
+	if err := decodeOpaque(s, token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func encodeOpaque(v interface{}) string {
+	data, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeOpaque(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// GetMessagesPage 基于游标分页获取频道消息，结果始终按时间倒序返回
+// cursor 为空时从最新消息开始；direction 为 newer 时返回比游标更新的消息；filter 可以为 nil
+func (ums *UserMessageStorage) GetMessagesPage(channelID string, cursor *MessageCursor, direction string, limit int, filter *ReadFilter) ([]*models.Message, bool, error) {
+	where := "channel_id = ? AND " + notExpired
+	args := []interface{}{channelID, nowUTC()}
+	for _, condition := range filter.conditions() {
+		where += " AND " + condition
+	}
+	order := "created_at DESC, id DESC"
+
+	if cursor != nil {
+		if direction == DirectionNewer {
+			where += " AND (created_at, id) > (?, ?)"
+			order = "created_at ASC, id ASC"
+		} else {
+			where += " AND (created_at, id) < (?, ?)"
+		}
+		args = append(args, cursor.CreatedAt, cursor.ID)
+	}
+
+	// 多取一条用于判断是否还有更多
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE ` + where + `
+	ORDER BY ` + order + `
+	LIMIT ?
+	`
+	messages, err := ums.queryMessages(filter, query, append(args, limit+1)...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	if cursor != nil && direction == DirectionNewer {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	return messages, hasMore, nil
+}
+
+// SyncChanges 自同步位置以来的变更
+// ReadChanges 包含已读、未读、星标和归档变更，每条为消息当前的完整状态，read_at 为空表示未读；
+// PositionChanges 为前进或退回过的频道阅读位置，序号不超过 position 的消息都视为已读
+type SyncChanges struct {
+	Messages        []*models.Message         `json:"messages"`
+	ReadChanges     []*models.ReadStatus      `json:"read_changes"`
+	PositionChanges []*models.ReadingPosition `json:"position_changes"`
+	HasMore         bool                      `json:"has_more"`
+	Token           *SyncToken                `json:"-"`
+}
+
+// GetChangesSince 获取同步位置之后的新消息和已读状态变更（按时间正序）
+// token 为空时从头开始；每类变更最多返回 limit 条，HasMore 表示需要继续拉取
+func (ums *UserMessageStorage) GetChangesSince(token *SyncToken, limit int) (*SyncChanges, error) {
+	if token == nil {
+		token = &SyncToken{}
+	}
+	next := &SyncToken{Seq: token.Seq, Message: token.Message, Read: token.Read, Position: token.Position}
+	changes := &SyncChanges{
+		Messages:        []*models.Message{},
+		ReadChanges:     []*models.ReadStatus{},
+		PositionChanges: []*models.ReadingPosition{},
+		Token:           next,
+	}
+
+	// 新消息按写入序号同步，重试等原因晚到的消息也不会被跳过
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE ` + notExpired
+	args := []interface{}{nowUTC()}
+	if token.Seq == 0 && token.Message != nil {
+		query += " AND (created_at, id) > (?, ?) ORDER BY created_at ASC, id ASC LIMIT ?"
+		args = append(args, token.Message.CreatedAt, token.Message.ID)
+	} else {
+		query += " AND seq > ? ORDER BY seq ASC LIMIT ?"
+		args = append(args, token.Seq)
+	}
+
+	rows, err := ums.workspace.MessagesDB.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query new messages: %w", err)
+	}
+	messages, err := scanMessages(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		changes.HasMore = true
+	}
+	if len(messages) > 0 {
+		changes.Messages = messages
+		next.Seq = messages[len(messages)-1].Seq
+		next.Message = nil
+	}
+
+	// 已读状态变更，按变更时间拉取
+	readQuery := `
+	SELECT message_id, read_at, read_device, starred_at, archived_at, changed_at
+	FROM read_status
+	WHERE changed_at IS NOT NULL`
+	var readArgs []interface{}
+	if token.Read != nil {
+		readQuery += " AND (changed_at, message_id) > (?, ?)"
+		readArgs = append(readArgs, token.Read.CreatedAt, token.Read.ID)
+	}
+	readQuery += " ORDER BY changed_at ASC, message_id ASC LIMIT ?"
+
+	readRows, err := ums.workspace.ReadDB.Query(readQuery, append(readArgs, limit+1)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query read status changes: %w", err)
+	}
+	defer readRows.Close()
+
+	for readRows.Next() {
+		status := &models.ReadStatus{}
+		var readAt, starredAt, archivedAt sql.NullTime
+		var changedAt time.Time
+		var device sql.NullString
+		if err := readRows.Scan(&status.MessageID, &readAt, &device, &starredAt, &archivedAt, &changedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan read status: %w", err)
+		}
+		if readAt.Valid {
+			status.ReadAt = &readAt.Time
+		}
+		status.ReadDevice = device.String
+		if starredAt.Valid {
+			status.StarredAt = &starredAt.Time
+		}
+		if archivedAt.Valid {
+			status.ArchivedAt = &archivedAt.Time
+		}
+		status.ChangedAt = &changedAt
+		changes.ReadChanges = append(changes.ReadChanges, status)
+	}
+	if err := readRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query read status changes: %w", err)
+	}
+	if len(changes.ReadChanges) > limit {
+		changes.ReadChanges = changes.ReadChanges[:limit]
+		changes.HasMore = true
+	}
+	if n := len(changes.ReadChanges); n > 0 {
+		last := changes.ReadChanges[n-1]
+		next.Read = &MessageCursor{CreatedAt: *last.ChangedAt, ID: last.MessageID}
+	}
+
+	if err := ums.positionChangesSince(token.Position, limit, changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// positionChangesSince 获取同步位置之后的阅读位置变更，写入 changes 并推进同步位置
+func (ums *UserMessageStorage) positionChangesSince(since *MessageCursor, limit int, changes *SyncChanges) error {
+	query := "SELECT " + readingPositionColumns + " FROM reading_position WHERE updated_at IS NOT NULL"
+	var args []interface{}
+	if since != nil {
+		query += " AND (updated_at, channel_id) > (?, ?)"
+		args = append(args, since.CreatedAt, since.ID)
+	}
+	query += " ORDER BY updated_at ASC, channel_id ASC LIMIT ?"
+
+	rows, err := ums.workspace.ReadDB.Query(query, append(args, limit+1)...)
+	if err != nil {
+		return fmt.Errorf("failed to query reading position changes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		position, err := scanReadingPosition(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan reading position: %w", err)
+		}
+		changes.PositionChanges = append(changes.PositionChanges, position)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query reading position changes: %w", err)
+	}
+
+	if len(changes.PositionChanges) > limit {
+		changes.PositionChanges = changes.PositionChanges[:limit]
+		changes.HasMore = true
+	}
+	if n := len(changes.PositionChanges); n > 0 {
+		last := changes.PositionChanges[n-1]
+		changes.Token.Position = &MessageCursor{CreatedAt: *last.UpdatedAt, ID: last.ChannelID}
+	}
+	return nil
+}
+
+// messageColumns 查询消息时选择的列，顺序与 scanMessage 一致
+const messageColumns = "id, channel_id, title, content, message_type, priority, sender, created_at, updated_at, metadata, seq, collapse_key, expires_at"
+
+// notExpired 排除已过期消息的查询条件，参数为 nowUTC()
+// 过期时间按 UTC 写入，与同样是 UTC 的当前时间按文本比较
+const notExpired = "(expires_at IS NULL OR expires_at > ?)"
+
+// nowUTC 当前时间（UTC），用于与 expires_at 比较
+func nowUTC() time.Time {
+	return time.Now().UTC()
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanMessage 扫描一行消息，extra 接收 messageColumns 之后的附加列
+func scanMessage(scanner rowScanner, extra ...interface{}) (*models.Message, error) {
+	message := &models.Message{}
+	var metadataJSON, collapseKey sql.NullString
+	var expiresAt sql.NullTime
+
+	dest := []interface{}{
+		&message.ID,
+		&message.ChannelID,
+		&message.Title,
+		&message.Content,
+		&message.MessageType,
+		&message.Priority,
+		&message.Sender,
+		&message.CreatedAt,
+		&message.UpdatedAt,
+		&metadataJSON,
+		&message.Seq,
+		&collapseKey,
+		&expiresAt,
+	}
+	if err := scanner.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	if metadataJSON.Valid {
+		json.Unmarshal([]byte(metadataJSON.String), &message.Metadata)
+	}
+	message.CollapseKey = collapseKey.String
+	if expiresAt.Valid {
+		message.ExpiresAt = &expiresAt.Time
+	}
+	return message, nil
+}
+
+// scanMessages 扫描消息查询结果
+func scanMessages(rows *sql.Rows) ([]*models.Message, error) {
+	var messages []*models.Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	return messages, nil
+}
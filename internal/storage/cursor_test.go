@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"miemie/internal/models"
+	"testing"
+	"time"
+)
+
+// syncReadChanges 从 token 拉取一次变更，返回按消息ID索引的已读状态变更和新的同步位置
+func syncReadChanges(t *testing.T, ums *UserMessageStorage, token *SyncToken) (map[string]*models.ReadStatus, *SyncToken) {
+	t.Helper()
+	changes, err := ums.GetChangesSince(token, 100)
+	if err != nil {
+		t.Fatalf("GetChangesSince: %v", err)
+	}
+	byID := make(map[string]*models.ReadStatus)
+	for _, status := range changes.ReadChanges {
+		if status.ChangedAt == nil {
+			t.Fatalf("read change for %s has no changed_at", status.MessageID)
+		}
+		byID[status.MessageID] = status
+	}
+	return byID, changes.Token
+}
+
+func TestSyncReportsUnreadAndStarChanges(t *testing.T) {
+	ums := newTestStorage(t)
+	start := time.Now().Add(-time.Minute)
+	for i, id := range []string{"m1", "m2"} {
+		if err := ums.CreateMessage(collapsedMessage(id, DefaultChannelID, "", start.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatalf("CreateMessage %s: %v", id, err)
+		}
+	}
+
+	if err := ums.MarkAsRead("m1", "phone"); err != nil {
+		t.Fatalf("MarkAsRead: %v", err)
+	}
+	changes, token := syncReadChanges(t, ums, nil)
+	if len(changes) != 1 || changes["m1"] == nil || changes["m1"].ReadAt == nil {
+		t.Fatalf("read change not synced: %+v", changes)
+	}
+
+	// 标记未读后，其他设备应该收到 read_at 为空的变更
+	if n, err := ums.MarkMultipleAsUnread([]string{"m1"}); err != nil || n != 1 {
+		t.Fatalf("MarkMultipleAsUnread = %d, %v", n, err)
+	}
+	changes, token = syncReadChanges(t, ums, token)
+	if len(changes) != 1 || changes["m1"] == nil || changes["m1"].ReadAt != nil {
+		t.Fatalf("unread change not synced: %+v", changes)
+	}
+
+	if _, err := ums.SetStarred("m2", true); err != nil {
+		t.Fatalf("SetStarred: %v", err)
+	}
+	changes, token = syncReadChanges(t, ums, token)
+	if len(changes) != 1 || changes["m2"] == nil || changes["m2"].StarredAt == nil {
+		t.Fatalf("star change not synced: %+v", changes)
+	}
+
+	// 重复加星标不产生新的变更
+	if _, err := ums.SetStarred("m2", true); err != nil {
+		t.Fatalf("SetStarred: %v", err)
+	}
+	if changes, _ := syncReadChanges(t, ums, token); len(changes) != 0 {
+		t.Fatalf("repeated star produced changes: %+v", changes)
+	}
+
+	if _, err := ums.SetStarred("m2", false); err != nil {
+		t.Fatalf("SetStarred: %v", err)
+	}
+	changes, _ = syncReadChanges(t, ums, token)
+	if len(changes) != 1 || changes["m2"] == nil || changes["m2"].StarredAt != nil {
+		t.Fatalf("unstar change not synced: %+v", changes)
+	}
+}
+
+func TestSyncReportsReadingPositionChanges(t *testing.T) {
+	ums := newTestStorage(t)
+	start := time.Now().Add(-time.Minute)
+	var messages []*models.Message
+	for i, id := range []string{"m1", "m2", "m3"} {
+		message := collapsedMessage(id, DefaultChannelID, "", start.Add(time.Duration(i)*time.Second))
+		if err := ums.CreateMessage(message); err != nil {
+			t.Fatalf("CreateMessage %s: %v", id, err)
+		}
+		messages = append(messages, message)
+	}
+
+	_, token := syncReadChanges(t, ums, nil)
+	position, _, err := ums.AdvanceReadingPosition(messages[2])
+	if err != nil {
+		t.Fatalf("AdvanceReadingPosition: %v", err)
+	}
+	readAt := *position.LastReadAt
+
+	changes, err := ums.GetChangesSince(token, 100)
+	if err != nil {
+		t.Fatalf("GetChangesSince: %v", err)
+	}
+	if len(changes.PositionChanges) != 1 || changes.PositionChanges[0].Position != messages[2].Seq {
+		t.Fatalf("position advance not synced: %+v", changes.PositionChanges)
+	}
+	token = changes.Token
+
+	// 标记阅读位置之前的消息未读：位置退回并同步，其间其他消息的已读时间取原来的 last_read_at
+	if _, err := ums.MarkMultipleAsUnread([]string{"m2"}); err != nil {
+		t.Fatalf("MarkMultipleAsUnread: %v", err)
+	}
+	changes, err = ums.GetChangesSince(token, 100)
+	if err != nil {
+		t.Fatalf("GetChangesSince: %v", err)
+	}
+	if len(changes.PositionChanges) != 1 || changes.PositionChanges[0].Position != messages[0].Seq {
+		t.Fatalf("position lowering not synced: %+v", changes.PositionChanges)
+	}
+	if lowered := changes.PositionChanges[0]; lowered.LastReadAt == nil || !lowered.LastReadAt.Equal(readAt) {
+		t.Fatalf("last_read_at changed to %v, want %v", lowered.LastReadAt, readAt)
+	}
+
+	status, err := ums.GetReadStatus("m3")
+	if err != nil || status == nil || status.ReadAt == nil {
+		t.Fatalf("m3 read status = %+v, %v", status, err)
+	}
+	if !status.ReadAt.Equal(readAt) {
+		t.Fatalf("m3 read_at = %v, want the position's last_read_at %v", status.ReadAt, readAt)
+	}
+	if read, err := ums.IsMessageRead("m2"); err != nil || read {
+		t.Fatalf("m2 read = %v, %v, want unread", read, err)
+	}
+}
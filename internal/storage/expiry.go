@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"fmt"
+	"miemie/internal/logger"
+	"miemie/internal/workspace"
+	"sync"
+	"time"
+)
+
+// deleteChunk 每条删除语句最多包含的消息ID数，避免超过 SQLite 的参数数量限制
+const deleteChunk = 500
+
+// ExpiredHook 过期消息被清理后的回调
+type ExpiredHook func(userID string, messageIDs []string)
+
+// DeleteExpiredMessages 删除 now 之前过期的消息及其已读状态，返回被删除的消息ID
+// 全文索引由 messages 表上的触发器同步删除
+func (ums *UserMessageStorage) DeleteExpiredMessages(now time.Time) ([]string, error) {
+	rows, err := ums.workspace.MessagesDB.Query(
+		"SELECT id FROM messages WHERE expires_at IS NOT NULL AND expires_at <= ?", now.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query expired messages: %w", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan expired message: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query expired messages: %w", err)
+	}
+
+	return ums.deleteMessages(ids)
+}
+
+// deleteMessages 分批删除消息及其已读状态，出错时返回已经删除的消息ID
+func (ums *UserMessageStorage) deleteMessages(ids []string) ([]string, error) {
+	for start := 0; start < len(ids); start += deleteChunk {
+		end := start + deleteChunk
+		if end > len(ids) {
+			end = len(ids)
+		}
+		placeholders, args := inClause(ids[start:end])
+
+		if _, err := ums.workspace.MessagesDB.Exec("DELETE FROM messages WHERE id IN ("+placeholders+")", args...); err != nil {
+			return ids[:start], fmt.Errorf("failed to delete messages: %w", err)
+		}
+		if _, err := ums.workspace.ReadDB.Exec("DELETE FROM read_status WHERE message_id IN ("+placeholders+")", args...); err != nil {
+			return ids[:end], fmt.Errorf("failed to delete read status: %w", err)
+		}
+	}
+
+	return ids, nil
+}
+
+// ExpirySweeper 定期遍历磁盘上的工作空间，清理已过期的消息
+type ExpirySweeper struct {
+	workspaceManager *workspace.Manager
+	interval         time.Duration
+	onExpired        ExpiredHook
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewExpirySweeper 创建并启动过期消息清理，onExpired 可以为 nil
+func NewExpirySweeper(workspaceManager *workspace.Manager, interval time.Duration, onExpired ExpiredHook) *ExpirySweeper {
+	s := &ExpirySweeper{
+		workspaceManager: workspaceManager,
+		interval:         interval,
+		onExpired:        onExpired,
+		stop:             make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// Close 停止清理协程
+func (s *ExpirySweeper) Close() {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+}
+
+// loop 按间隔执行清理
+func (s *ExpirySweeper) loop() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Sweep()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Sweep 清理所有工作空间中已过期的消息，返回删除的消息数
+func (s *ExpirySweeper) Sweep() int {
+	users, err := s.workspaceManager.ListAllUsers()
+	if err != nil {
+		logger.Warnf("Expiry sweep: failed to list workspaces: %v", err)
+		return 0
+	}
+
+	now := time.Now()
+	total := 0
+	for _, userID := range users {
+		select {
+		case <-s.stop:
+			return total
+		default:
+		}
+
+		var ids []string
+		err := s.workspaceManager.WithWorkspace(userID, func(ws *workspace.Workspace) error {
+			var err error
+			ids, err = NewUserMessageStorage(ws).DeleteExpiredMessages(now)
+			return err
+		})
+		if err != nil {
+			logger.Warnf("Expiry sweep: failed to purge expired messages for %s: %v", userID, err)
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		total += len(ids)
+		logger.Infof("Expiry sweep: removed %d expired messages for %s", len(ids), userID)
+		if s.onExpired != nil {
+			s.onExpired(userID, ids)
+		}
+	}
+
+	return total
+}
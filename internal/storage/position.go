@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"miemie/internal/models"
+	"time"
+)
+
+// unreadCondition 未读消息的条件：序号在频道阅读位置之后，且没有单独标记已读
+// 需要在附加了 read_status.db（rs）的连接上使用，消息表不能使用别名
+const unreadCondition = `(seq > COALESCE((SELECT position FROM rs.reading_position p WHERE p.channel_id = messages.channel_id), 0)
+	AND NOT EXISTS (SELECT 1 FROM rs.read_status r WHERE r.message_id = messages.id AND r.read_at IS NOT NULL))`
+
+// countUnreadQuery 统计频道中阅读位置之后的未读消息，参数为频道ID、阅读位置和 nowUTC()
+const countUnreadQuery = `
+	SELECT COUNT(*) FROM messages
+	WHERE channel_id = ? AND seq > ? AND ` + notExpired + `
+	AND NOT EXISTS (SELECT 1 FROM rs.read_status r WHERE r.message_id = messages.id AND r.read_at IS NOT NULL)
+`
+
+// readingPositionColumns 查询阅读位置时选择的列，顺序与 scanReadingPosition 一致
+const readingPositionColumns = "channel_id, last_read_message_id, last_read_at, position, updated_at"
+
+// scanReadingPosition 扫描一行阅读位置
+func scanReadingPosition(scanner rowScanner) (*models.ReadingPosition, error) {
+	position := &models.ReadingPosition{}
+	var lastReadID sql.NullString
+	var lastReadAt, updatedAt sql.NullTime
+	var pos sql.NullInt64
+
+	if err := scanner.Scan(&position.ChannelID, &lastReadID, &lastReadAt, &pos, &updatedAt); err != nil {
+		return nil, err
+	}
+	position.LastReadMessageID = lastReadID.String
+	if lastReadAt.Valid {
+		position.LastReadAt = &lastReadAt.Time
+	}
+	position.Position = pos.Int64
+	if updatedAt.Valid {
+		position.UpdatedAt = &updatedAt.Time
+	}
+	return position, nil
+}
+
+// GetReadingPosition 获取频道的阅读位置，没有记录时 Position 为 0
+func (ums *UserMessageStorage) GetReadingPosition(channelID string) (*models.ReadingPosition, error) {
+	position, err := scanReadingPosition(ums.workspace.ReadDB.QueryRow(
+		"SELECT "+readingPositionColumns+" FROM reading_position WHERE channel_id = ?", channelID))
+	if err == sql.ErrNoRows {
+		return &models.ReadingPosition{ChannelID: channelID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get reading position: %w", err)
+	}
+	return position, nil
+}
+
+// readingPositions 获取所有频道的阅读位置
+func readingPositions(ctx context.Context, conn *sql.Conn) (map[string]int64, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT channel_id, position FROM rs.reading_position")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query reading positions: %w", err)
+	}
+	defer rows.Close()
+
+	positions := make(map[string]int64)
+	for rows.Next() {
+		var channelID string
+		var position sql.NullInt64
+		if err := rows.Scan(&channelID, &position); err != nil {
+			return nil, fmt.Errorf("failed to scan reading position: %w", err)
+		}
+		positions[channelID] = position.Int64
+	}
+	return positions, rows.Err()
+}
+
+// AdvanceReadingPosition 将消息所在频道的阅读位置推进到这条消息，位置只前进不后退
+// 返回新的阅读位置和因此变为已读的消息ID
+func (ums *UserMessageStorage) AdvanceReadingPosition(message *models.Message) (*models.ReadingPosition, []string, error) {
+	current, err := ums.GetReadingPosition(message.ChannelID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if message.Seq <= current.Position {
+		return current, nil, nil
+	}
+
+	// 新覆盖的未读消息，用于同步投递回执
+	var ids []string
+	var entries []statsEntry
+	err = ums.withReadStatus(func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(context.Background(), `
+			SELECT id, priority FROM messages
+			WHERE channel_id = ? AND seq > ? AND seq <= ?
+			AND NOT EXISTS (SELECT 1 FROM rs.read_status r WHERE r.message_id = messages.id AND r.read_at IS NOT NULL)
+		`, message.ChannelID, current.Position, message.Seq)
+		if err != nil {
+			return fmt.Errorf("failed to query unread messages: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var id string
+			var priority int
+			if err := rows.Scan(&id, &priority); err != nil {
+				return fmt.Errorf("failed to scan unread message: %w", err)
+			}
+			ids = append(ids, id)
+			entries = append(entries, statsEntry{channelID: message.ChannelID, priority: priority})
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	_, err = ums.workspace.ReadDB.Exec(`
+		INSERT INTO reading_position (channel_id, last_read_message_id, last_read_at, position, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(channel_id) DO UPDATE SET
+			last_read_message_id = excluded.last_read_message_id,
+			last_read_at = excluded.last_read_at,
+			position = excluded.position,
+			updated_at = excluded.updated_at
+		WHERE excluded.position > COALESCE(reading_position.position, 0)
+	`, message.ChannelID, message.ID, now, message.Seq, now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to update reading position: %w", err)
+	}
+	ums.recordStats(now, entries, true)
+
+	ums.workspace.NotifyRead(ids)
+
+	position, err := ums.GetReadingPosition(message.ChannelID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return position, ids, nil
+}
+
+// lowerReadingPositions 阅读位置之前的消息要标记未读时，把阅读位置退回到其中最早一条之前
+// 退回区间内的消息逐条写入已读记录，保持它们原来的已读状态
+func (ums *UserMessageStorage) lowerReadingPositions(messageIDs []string) error {
+	type span struct {
+		position int64 // 当前阅读位置
+		lowest   int64 // 要标记未读的最早消息序号
+	}
+	spans := make(map[string]*span)
+
+	err := ums.withReadStatus(func(conn *sql.Conn) error {
+		ctx := context.Background()
+		positions, err := readingPositions(ctx, conn)
+		if err != nil || len(positions) == 0 {
+			return err
+		}
+
+		for start := 0; start < len(messageIDs); start += deleteChunk {
+			end := start + deleteChunk
+			if end > len(messageIDs) {
+				end = len(messageIDs)
+			}
+			placeholders, args := inClause(messageIDs[start:end])
+
+			rows, err := conn.QueryContext(ctx, "SELECT channel_id, seq FROM messages WHERE id IN ("+placeholders+")", args...)
+			if err != nil {
+				return fmt.Errorf("failed to query messages: %w", err)
+			}
+			for rows.Next() {
+				var channelID string
+				var seq int64
+				if err := rows.Scan(&channelID, &seq); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to scan message: %w", err)
+				}
+				position, ok := positions[channelID]
+				if !ok || seq > position {
+					continue
+				}
+				if sp, exists := spans[channelID]; !exists {
+					spans[channelID] = &span{position: position, lowest: seq}
+				} else if seq < sp.lowest {
+					sp.lowest = seq
+				}
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to query messages: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil || len(spans) == 0 {
+		return err
+	}
+
+	for channelID, sp := range spans {
+		if err := ums.lowerReadingPosition(channelID, sp.position, sp.lowest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lowerReadingPosition 把频道阅读位置从 position 退回到 lowest 之前，区间内的消息逐条写入已读记录
+// 这些消息的已读时间取阅读位置的 last_read_at，已有已读记录的保持原来的已读时间和设备；
+// 阅读位置的 last_read_at 不变，只更新变更时间
+func (ums *UserMessageStorage) lowerReadingPosition(channelID string, position, lowest int64) error {
+	current, err := ums.GetReadingPosition(channelID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	readAt := now
+	if current.LastReadAt != nil {
+		readAt = *current.LastReadAt
+	}
+
+	rows, err := ums.workspace.MessagesDB.Query(
+		"SELECT id FROM messages WHERE channel_id = ? AND seq >= ? AND seq <= ?", channelID, lowest, position)
+	if err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+	var covered []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan message: %w", err)
+		}
+		covered = append(covered, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+
+	// 新的阅读位置指向退回后最近的一条消息
+	var lastReadID sql.NullString
+	err = ums.workspace.MessagesDB.QueryRow(
+		"SELECT id FROM messages WHERE channel_id = ? AND seq < ? ORDER BY seq DESC LIMIT 1", channelID, lowest,
+	).Scan(&lastReadID)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to query messages: %w", err)
+	}
+
+	tx, err := ums.workspace.ReadDB.Begin()
+	if err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`
+		INSERT INTO read_status (message_id, read_at, changed_at) VALUES (?, ?, ?)
+		ON CONFLICT(message_id) DO UPDATE SET read_at = excluded.read_at, changed_at = excluded.changed_at
+		WHERE read_status.read_at IS NULL
+	`)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, id := range covered {
+		if _, err := stmt.Exec(id, readAt, now); err != nil {
+			stmt.Close()
+			tx.Rollback()
+			return fmt.Errorf("failed to keep read status: %w", err)
+		}
+	}
+	stmt.Close()
+
+	_, err = tx.Exec(
+		"UPDATE reading_position SET position = ?, last_read_message_id = ?, updated_at = ? WHERE channel_id = ?",
+		lowest-1, lastReadID, now, channelID)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update reading position: %w", err)
+	}
+	return tx.Commit()
+}
+
+// UnreadCounts 统计各频道的未读消息数，只扫描每个频道阅读位置之后的消息
+func (ums *UserMessageStorage) UnreadCounts(channelIDs []string) (map[string]int, error) {
+	counts := make(map[string]int, len(channelIDs))
+	err := ums.withReadStatus(func(conn *sql.Conn) error {
+		ctx := context.Background()
+		positions, err := readingPositions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		stmt, err := conn.PrepareContext(ctx, countUnreadQuery)
+		if err != nil {
+			return fmt.Errorf("failed to prepare unread count: %w", err)
+		}
+		defer stmt.Close()
+
+		now := nowUTC()
+		for _, channelID := range channelIDs {
+			var count int
+			if err := stmt.QueryRowContext(ctx, channelID, positions[channelID], now).Scan(&count); err != nil {
+				return fmt.Errorf("failed to count unread messages: %w", err)
+			}
+			counts[channelID] = count
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// messageChannelIDs 列出有消息的频道（包括没有频道记录的）
+func (ums *UserMessageStorage) messageChannelIDs() ([]string, error) {
+	rows, err := ums.workspace.MessagesDB.Query("SELECT DISTINCT channel_id FROM messages")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message channels: %w", err)
+	}
+	defer rows.Close()
+
+	var channelIDs []string
+	for rows.Next() {
+		var channelID string
+		if err := rows.Scan(&channelID); err != nil {
+			return nil, fmt.Errorf("failed to scan message channel: %w", err)
+		}
+		channelIDs = append(channelIDs, channelID)
+	}
+	return channelIDs, rows.Err()
+}
+
+// FillUnreadCounts 填充频道的未读消息数，静音的频道不显示未读数
+func (ums *UserMessageStorage) FillUnreadCounts(channels []*models.Channel) error {
+	channelIDs := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		if !channel.Muted {
+			channelIDs = append(channelIDs, channel.ID)
+		}
+	}
+
+	counts, err := ums.UnreadCounts(channelIDs)
+	if err != nil {
+		return err
+	}
+	for _, channel := range channels {
+		channel.UnreadCount = counts[channel.ID]
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"miemie/internal/models"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ReadFilter 按已读状态过滤消息，nil 字段表示不限
+type ReadFilter struct {
+	Starred  *bool
+	Archived *bool
+	Unread   *bool
+}
+
+// IsZero 是否没有任何过滤条件
+func (f *ReadFilter) IsZero() bool {
+	return f == nil || (f.Starred == nil && f.Archived == nil && f.Unread == nil)
+}
+
+// conditions 构建过滤条件，read_status.db 附加为 rs
+func (f *ReadFilter) conditions() []string {
+	if f.IsZero() {
+		return nil
+	}
+
+	var conditions []string
+	in := func(set bool, where string) {
+		op := "IN"
+		if !set {
+			op = "NOT IN"
+		}
+		conditions = append(conditions, "id "+op+" (SELECT message_id FROM rs.read_status WHERE "+where+")")
+	}
+	if f.Starred != nil {
+		in(*f.Starred, "starred_at IS NOT NULL")
+	}
+	if f.Archived != nil {
+		in(*f.Archived, "archived_at IS NOT NULL")
+	}
+	if f.Unread != nil {
+		if *f.Unread {
+			conditions = append(conditions, unreadCondition)
+		} else {
+			conditions = append(conditions, "NOT "+unreadCondition)
+		}
+	}
+	return conditions
+}
+
+// withReadStatus 在消息数据库的独立连接上附加 read_status.db（别名 rs），用于跨库查询
+func (ums *UserMessageStorage) withReadStatus(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := ums.workspace.MessagesDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	readDBPath := filepath.Join(ums.workspace.BasePath, "read_status.db")
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS rs", readDBPath); err != nil {
+		return fmt.Errorf("failed to attach read status database: %w", err)
+	}
+
+	err = fn(conn)
+
+	if _, detachErr := conn.ExecContext(ctx, "DETACH DATABASE rs"); detachErr != nil {
+		// 无法分离时丢弃这个连接，避免带着附加库回到连接池
+		conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	return err
+}
+
+// queryMessages 执行消息查询，有已读状态过滤条件时在附加了 read_status.db 的连接上执行
+func (ums *UserMessageStorage) queryMessages(filter *ReadFilter, query string, args ...interface{}) ([]*models.Message, error) {
+	if filter.IsZero() {
+		rows, err := ums.workspace.MessagesDB.Query(query, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query messages: %w", err)
+		}
+		defer rows.Close()
+		return scanMessages(rows)
+	}
+
+	var messages []*models.Message
+	err := ums.withReadStatus(func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(context.Background(), query, args...)
+		if err != nil {
+			return fmt.Errorf("failed to query messages: %w", err)
+		}
+		defer rows.Close()
+		messages, err = scanMessages(rows)
+		return err
+	})
+	return messages, err
+}
+
+// ExistingMessageIDs 返回 ids 中存在且未过期的消息ID，保持原顺序并去重
+func (ums *UserMessageStorage) ExistingMessageIDs(ids []string) ([]string, error) {
+	existing := make(map[string]bool, len(ids))
+	for start := 0; start < len(ids); start += deleteChunk {
+		end := start + deleteChunk
+		if end > len(ids) {
+			end = len(ids)
+		}
+		placeholders, args := inClause(ids[start:end])
+
+		rows, err := ums.workspace.MessagesDB.Query(
+			"SELECT id FROM messages WHERE id IN ("+placeholders+") AND "+notExpired, append(args, nowUTC())...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query messages: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan message: %w", err)
+			}
+			existing[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query messages: %w", err)
+		}
+	}
+
+	result := make([]string, 0, len(existing))
+	for _, id := range ids {
+		if existing[id] {
+			result = append(result, id)
+			delete(existing, id)
+		}
+	}
+	return result, nil
+}
+
+// SetStarred 标记或取消消息星标，已经是星标时保留原来的星标时间
+func (ums *UserMessageStorage) SetStarred(messageID string, starred bool) (*models.ReadStatus, error) {
+	return ums.setStateTime("starred_at", messageID, starred)
+}
+
+// SetArchived 归档或取消归档消息，已经归档时保留原来的归档时间
+func (ums *UserMessageStorage) SetArchived(messageID string, archived bool) (*models.ReadStatus, error) {
+	return ums.setStateTime("archived_at", messageID, archived)
+}
+
+// setStateTime 设置或清除 read_status 中的时间列，column 只能是 starred_at 或 archived_at
+// 状态确实改变时才更新变更时间；清除后保留记录，增量同步才能把变更告诉其他设备
+func (ums *UserMessageStorage) setStateTime(column, messageID string, set bool) (*models.ReadStatus, error) {
+	var err error
+	now := time.Now()
+	if set {
+		_, err = ums.workspace.ReadDB.Exec(`
+			INSERT INTO read_status (message_id, `+column+`, changed_at) VALUES (?, ?, ?)
+			ON CONFLICT(message_id) DO UPDATE SET `+column+` = excluded.`+column+`, changed_at = excluded.changed_at
+			WHERE read_status.`+column+` IS NULL
+		`, messageID, now, now)
+	} else {
+		_, err = ums.workspace.ReadDB.Exec(
+			"UPDATE read_status SET "+column+" = NULL, changed_at = ? WHERE message_id = ? AND "+column+" IS NOT NULL",
+			now, messageID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update %s: %w", column, err)
+	}
+
+	status, err := ums.GetReadStatus(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if status == nil {
+		status = &models.ReadStatus{MessageID: messageID}
+	}
+	return status, nil
+}
+
+// MarkMultipleAsUnread 批量标记未读，保留星标和归档状态，返回原本已读的消息数
+// 记录保留为 read_at 为空的状态并更新变更时间，增量同步会把未读变更告诉其他设备
+func (ums *UserMessageStorage) MarkMultipleAsUnread(messageIDs []string) (int, error) {
+	if err := ums.lowerReadingPositions(messageIDs); err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	total := 0
+	for start := 0; start < len(messageIDs); start += deleteChunk {
+		end := start + deleteChunk
+		if end > len(messageIDs) {
+			end = len(messageIDs)
+		}
+		chunk := messageIDs[start:end]
+		placeholders, args := inClause(chunk)
+
+		result, err := ums.workspace.ReadDB.Exec(
+			"UPDATE read_status SET read_at = NULL, read_device = NULL, changed_at = ? WHERE read_at IS NOT NULL AND message_id IN ("+placeholders+")",
+			append([]interface{}{now}, args...)...)
+		if err != nil {
+			return total, fmt.Errorf("failed to mark messages unread: %w", err)
+		}
+		n, _ := result.RowsAffected()
+		total += int(n)
+	}
+	return total, nil
+}
+
+// MarkChannelAsRead 将频道的阅读位置推进到最新一条消息，返回因此变为已读的消息ID
+func (ums *UserMessageStorage) MarkChannelAsRead(channelID string) ([]string, error) {
+	query := "SELECT " + messageColumns + " FROM messages WHERE channel_id = ? AND " + notExpired + " ORDER BY seq DESC LIMIT 1"
+	latest, err := scanMessage(ums.workspace.MessagesDB.QueryRow(query, channelID, nowUTC()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest message: %w", err)
+	}
+
+	_, ids, err := ums.AdvanceReadingPosition(latest)
+	return ids, err
+}
+
+// inClause 生成 IN 子句的占位符和参数
+func inClause(ids []string) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return "?" + strings.Repeat(", ?", len(ids)-1), args
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
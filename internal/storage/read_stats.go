@@ -0,0 +1,286 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"miemie/internal/logger"
+	"miemie/internal/models"
+	"strconv"
+	"time"
+)
+
+// StatsDateLayout read_stats 的日期格式，按 UTC 日期统计
+const StatsDateLayout = "2006-01-02"
+
+// 统计历史的时间段
+const (
+	StatsBucketDay   = "day"
+	StatsBucketWeek  = "week" // 从周一开始
+	StatsBucketMonth = "month"
+)
+
+// read_stats_items 中分项统计的类型
+const (
+	statsKindChannel  = "channel"
+	statsKindPriority = "priority"
+)
+
+// statsEntry 计入统计的一条消息
+type statsEntry struct {
+	channelID string
+	priority  int
+}
+
+// recordStats 将消息计入当天的收到或已读统计，统计失败只记录日志，不影响消息本身
+func (ums *UserMessageStorage) recordStats(at time.Time, entries []statsEntry, read bool) {
+	if len(entries) == 0 {
+		return
+	}
+	if err := ums.writeStats(at.UTC().Format(StatsDateLayout), entries, read); err != nil {
+		logger.Warnf("Failed to record read stats for %s: %v", ums.workspace.UserID, err)
+	}
+}
+
+// writeStats 把消息累加到当天的统计，总数和分项都用 UPSERT 原地累加，并发写入不会丢失计数
+func (ums *UserMessageStorage) writeStats(date string, entries []statsEntry, read bool) error {
+	totalColumn, itemColumn := "total_received", "received_count"
+	if read {
+		totalColumn, itemColumn = "total_read", "read_count"
+	}
+
+	items := make(map[[2]string]int)
+	for _, entry := range entries {
+		items[[2]string{statsKindChannel, entry.channelID}]++
+		items[[2]string{statsKindPriority, strconv.Itoa(entry.priority)}]++
+	}
+
+	tx, err := ums.workspace.ReadDB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO read_stats (date, `+totalColumn+`, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT(date) DO UPDATE SET
+			`+totalColumn+` = COALESCE(read_stats.`+totalColumn+`, 0) + excluded.`+totalColumn+`,
+			updated_at = excluded.updated_at
+	`, date, len(entries), time.Now())
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update read stats: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO read_stats_items (date, kind, key, ` + itemColumn + `) VALUES (?, ?, ?, ?)
+		ON CONFLICT(date, kind, key) DO UPDATE SET ` + itemColumn + ` = ` + itemColumn + ` + excluded.` + itemColumn)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	defer stmt.Close()
+	for item, count := range items {
+		if _, err := stmt.Exec(date, item[0], item[1], count); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to update read stats: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// unreadStatsEntries 查询 ids 中当前未读的消息，标记已读后它们才计入已读统计
+// 查询失败只记录日志，本次不计入统计
+func (ums *UserMessageStorage) unreadStatsEntries(messageIDs []string) []statsEntry {
+	var entries []statsEntry
+	err := ums.withReadStatus(func(conn *sql.Conn) error {
+		for start := 0; start < len(messageIDs); start += deleteChunk {
+			end := start + deleteChunk
+			if end > len(messageIDs) {
+				end = len(messageIDs)
+			}
+			placeholders, args := inClause(messageIDs[start:end])
+
+			rows, err := conn.QueryContext(context.Background(),
+				"SELECT channel_id, priority FROM messages WHERE id IN ("+placeholders+") AND "+unreadCondition, args...)
+			if err != nil {
+				return fmt.Errorf("failed to query unread messages: %w", err)
+			}
+			for rows.Next() {
+				var entry statsEntry
+				if err := rows.Scan(&entry.channelID, &entry.priority); err != nil {
+					rows.Close()
+					return fmt.Errorf("failed to scan unread message: %w", err)
+				}
+				entries = append(entries, entry)
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to query unread messages: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logger.Warnf("Failed to collect read stats for %s: %v", ums.workspace.UserID, err)
+		return nil
+	}
+	return entries
+}
+
+// statsBucketStart 日期所在时间段的第一天
+func statsBucketStart(day time.Time, bucket string) time.Time {
+	switch bucket {
+	case StatsBucketWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case StatsBucketMonth:
+		return time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// statsBucketNext 下一个时间段的第一天
+func statsBucketNext(start time.Time, bucket string) time.Time {
+	switch bucket {
+	case StatsBucketWeek:
+		return start.AddDate(0, 0, 7)
+	case StatsBucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// newStatsBucket 创建空的统计时间段
+func newStatsBucket(start, end string) *models.StatsBucket {
+	return &models.StatsBucket{
+		Start:      start,
+		End:        end,
+		Total:      &models.StatsCounter{},
+		Channels:   make(map[string]*models.StatsCounter),
+		Priorities: make(map[string]*models.StatsCounter),
+	}
+}
+
+// addStatsCount 把一天的一项统计累加到时间段
+func addStatsCount(dst map[string]*models.StatsCounter, key string, received, read int) {
+	counter, ok := dst[key]
+	if !ok {
+		counter = &models.StatsCounter{}
+		dst[key] = counter
+	}
+	counter.Received += received
+	counter.Read += read
+}
+
+// fillReadRate 计算时间段内各项的已读率
+func fillReadRate(bucket *models.StatsBucket) {
+	counters := []*models.StatsCounter{bucket.Total}
+	for _, c := range bucket.Channels {
+		counters = append(counters, c)
+	}
+	for _, c := range bucket.Priorities {
+		counters = append(counters, c)
+	}
+	for _, c := range counters {
+		if c.Received > 0 {
+			c.ReadRate = float64(c.Read) / float64(c.Received)
+		}
+	}
+}
+
+// GetStatsHistory 按时间段汇总 from 到 to（UTC 日期，包含两端）的收到和已读统计
+// from 会对齐到所在时间段的第一天，没有数据的时间段也会返回
+func (ums *UserMessageStorage) GetStatsHistory(bucket string, from, to time.Time) (*models.StatsHistory, error) {
+	from = statsBucketStart(from, bucket)
+	fromDate, toDate := from.Format(StatsDateLayout), to.Format(StatsDateLayout)
+
+	history := &models.StatsHistory{
+		Bucket:  bucket,
+		From:    fromDate,
+		To:      toDate,
+		Total:   newStatsBucket(fromDate, toDate),
+		Buckets: []*models.StatsBucket{},
+	}
+	index := make(map[string]*models.StatsBucket)
+	for start := from; !start.After(to); start = statsBucketNext(start, bucket) {
+		end := statsBucketNext(start, bucket).AddDate(0, 0, -1)
+		b := newStatsBucket(start.Format(StatsDateLayout), end.Format(StatsDateLayout))
+		history.Buckets = append(history.Buckets, b)
+		index[b.Start] = b
+	}
+
+	// bucketOf 日期所在的时间段，日期无法解析时返回 nil
+	bucketOf := func(date string) *models.StatsBucket {
+		day, err := time.Parse(StatsDateLayout, date)
+		if err != nil {
+			return nil
+		}
+		return index[statsBucketStart(day, bucket).Format(StatsDateLayout)]
+	}
+
+	rows, err := ums.workspace.ReadDB.Query(`
+		SELECT date, total_read, total_received
+		FROM read_stats WHERE date >= ? AND date <= ? ORDER BY date
+	`, fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query read stats: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var date string
+		var totalRead, totalReceived sql.NullInt64
+		if err := rows.Scan(&date, &totalRead, &totalReceived); err != nil {
+			return nil, fmt.Errorf("failed to scan read stats: %w", err)
+		}
+		b := bucketOf(date)
+		if b == nil {
+			continue
+		}
+		for _, target := range []*models.StatsBucket{b, history.Total} {
+			target.Total.Read += int(totalRead.Int64)
+			target.Total.Received += int(totalReceived.Int64)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query read stats: %w", err)
+	}
+
+	itemRows, err := ums.workspace.ReadDB.Query(`
+		SELECT date, kind, key, received_count, read_count
+		FROM read_stats_items WHERE date >= ? AND date <= ?
+	`, fromDate, toDate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query read stats: %w", err)
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var date, kind, key string
+		var received, read int
+		if err := itemRows.Scan(&date, &kind, &key, &received, &read); err != nil {
+			return nil, fmt.Errorf("failed to scan read stats: %w", err)
+		}
+		b := bucketOf(date)
+		if b == nil {
+			continue
+		}
+		for _, target := range []*models.StatsBucket{b, history.Total} {
+			dst := target.Channels
+			if kind == statsKindPriority {
+				dst = target.Priorities
+			}
+			addStatsCount(dst, key, received, read)
+		}
+	}
+	if err := itemRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query read stats: %w", err)
+	}
+
+	for _, b := range history.Buckets {
+		fillReadRate(b)
+	}
+	fillReadRate(history.Total)
+	return history, nil
+}
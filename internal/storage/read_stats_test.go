@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"miemie/internal/workspace"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriteStatsConcurrentIncrements(t *testing.T) {
+	ums := newTestStorage(t)
+	now := time.Now().UTC()
+
+	const writers = 20
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			channelID := "ops"
+			if i%2 == 0 {
+				channelID = DefaultChannelID
+			}
+			ums.recordStats(now, []statsEntry{{channelID: channelID, priority: 5}}, i%4 == 0)
+		}(i)
+	}
+	wg.Wait()
+
+	history, err := ums.GetStatsHistory(StatsBucketDay, now, now)
+	if err != nil {
+		t.Fatalf("GetStatsHistory: %v", err)
+	}
+	total := history.Total
+	if total.Total.Received+total.Total.Read != writers {
+		t.Fatalf("total = %+v, want %d counted", total.Total, writers)
+	}
+	if total.Total.Read != writers/4 {
+		t.Fatalf("total read = %d, want %d", total.Total.Read, writers/4)
+	}
+	if c := total.Channels["ops"]; c == nil || c.Received != writers/2 {
+		t.Fatalf("ops channel = %+v, want %d received", c, writers/2)
+	}
+	if c := total.Priorities["5"]; c == nil || c.Received+c.Read != writers {
+		t.Fatalf("priority 5 = %+v, want %d counted", c, writers)
+	}
+}
+
+func TestReadStatsMigratesLegacyJSON(t *testing.T) {
+	dir := t.TempDir()
+	manager := workspace.NewManager(dir)
+	ws, err := manager.GetUserWorkspace("alice")
+	if err != nil {
+		t.Fatalf("GetUserWorkspace: %v", err)
+	}
+	_, err = ws.ReadDB.Exec(`
+		INSERT INTO read_stats (date, total_read, total_received, channel_stats, priority_stats)
+		VALUES ('2026-01-05', 1, 3, '{"ops":{"received":3,"read":1}}', '{"5":{"received":3,"read":1}}')
+	`)
+	if err != nil {
+		t.Fatalf("insert legacy stats: %v", err)
+	}
+	manager.Close()
+
+	manager = workspace.NewManager(dir)
+	t.Cleanup(func() { manager.Close() })
+	ws, err = manager.GetUserWorkspace("alice")
+	if err != nil {
+		t.Fatalf("GetUserWorkspace: %v", err)
+	}
+	ums := NewUserMessageStorage(ws)
+
+	day := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	ums.recordStats(day, []statsEntry{{channelID: "ops", priority: 5}}, true)
+
+	history, err := ums.GetStatsHistory(StatsBucketDay, day, day)
+	if err != nil {
+		t.Fatalf("GetStatsHistory: %v", err)
+	}
+	if c := history.Total.Channels["ops"]; c == nil || c.Received != 3 || c.Read != 2 {
+		t.Fatalf("ops channel = %+v, want 3 received and 2 read", c)
+	}
+	if c := history.Total.Priorities["5"]; c == nil || c.Read != 2 {
+		t.Fatalf("priority 5 = %+v, want 2 read", c)
+	}
+	if history.Total.Total.Read != 2 || history.Total.Total.Received != 3 {
+		t.Fatalf("total = %+v, want 3 received and 2 read", history.Total.Total)
+	}
+}
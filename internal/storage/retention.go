@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"fmt"
+	"miemie/internal/logger"
+	"miemie/internal/models"
+	"miemie/internal/workspace"
+	"sync"
+	"time"
+)
+
+// ApplyRetention 按频道的保留策略删除消息及其已读状态，返回被删除的消息ID
+// 消息按时间从新到旧保留 max_messages 条，早于 max_age_days 的消息全部删除；
+// keep_starred 时星标消息始终保留，也不占用 max_messages 的名额
+func (ums *UserMessageStorage) ApplyRetention(channel *models.Channel, now time.Time) ([]string, error) {
+	policy := channel.Retention
+	if policy.IsEmpty() {
+		return nil, nil
+	}
+
+	starred := make(map[string]bool)
+	if policy.KeepStarred {
+		rows, err := ums.workspace.ReadDB.Query("SELECT message_id FROM read_status WHERE starred_at IS NOT NULL")
+		if err != nil {
+			return nil, fmt.Errorf("failed to query starred messages: %w", err)
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan starred message: %w", err)
+			}
+			starred[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query starred messages: %w", err)
+		}
+	}
+
+	var cutoff time.Time
+	if policy.MaxAgeDays > 0 {
+		cutoff = now.AddDate(0, 0, -policy.MaxAgeDays)
+	}
+
+	rows, err := ums.workspace.MessagesDB.Query(
+		"SELECT id, created_at FROM messages WHERE channel_id = ? ORDER BY created_at DESC, id DESC", channel.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query channel messages: %w", err)
+	}
+	var ids []string
+	kept := 0
+	for rows.Next() {
+		var id string
+		var createdAt time.Time
+		if err := rows.Scan(&id, &createdAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan channel message: %w", err)
+		}
+		if starred[id] {
+			continue
+		}
+		tooOld := !cutoff.IsZero() && createdAt.Before(cutoff)
+		tooMany := policy.MaxMessages > 0 && kept >= policy.MaxMessages
+		if tooOld || tooMany {
+			ids = append(ids, id)
+			continue
+		}
+		kept++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query channel messages: %w", err)
+	}
+
+	return ums.deleteMessages(ids)
+}
+
+// RetentionResult 单个工作空间的保留策略执行结果
+type RetentionResult struct {
+	UserID         string `json:"user_id"`
+	Channels       int    `json:"channels"`
+	Deleted        int    `json:"deleted"`
+	ReclaimedBytes int64  `json:"reclaimed_bytes"`
+	Error          string `json:"error,omitempty"`
+}
+
+// RetentionReport 一轮保留策略执行的汇总，只列出有删除或出错的工作空间
+type RetentionReport struct {
+	StartedAt      time.Time          `json:"started_at"`
+	FinishedAt     time.Time          `json:"finished_at"`
+	Workspaces     int                `json:"workspaces"`
+	Channels       int                `json:"channels"`
+	Deleted        int                `json:"deleted"`
+	ReclaimedBytes int64              `json:"reclaimed_bytes"`
+	Users          []*RetentionResult `json:"users"`
+}
+
+// RetentionWorker 定期对磁盘上所有工作空间执行频道保留策略，并压缩有删除的数据库
+type RetentionWorker struct {
+	workspaceManager *workspace.Manager
+	interval         time.Duration
+
+	runMu      sync.Mutex // 同一时间只执行一轮
+	mu         sync.RWMutex
+	lastReport *RetentionReport
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewRetentionWorker 创建并启动保留策略后台任务
+func NewRetentionWorker(workspaceManager *workspace.Manager, interval time.Duration) *RetentionWorker {
+	w := &RetentionWorker{
+		workspaceManager: workspaceManager,
+		interval:         interval,
+		stop:             make(chan struct{}),
+	}
+	go w.loop()
+	return w
+}
+
+// Close 停止后台任务
+func (w *RetentionWorker) Close() {
+	w.closeOnce.Do(func() {
+		close(w.stop)
+	})
+}
+
+// LastReport 获取最近一轮的执行结果，还没有执行过时返回 nil
+func (w *RetentionWorker) LastReport() *RetentionReport {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.lastReport
+}
+
+// loop 按间隔执行保留策略
+func (w *RetentionWorker) loop() {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.Run()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Run 执行一轮保留策略，已有一轮在执行时等待其结束后再执行
+func (w *RetentionWorker) Run() *RetentionReport {
+	w.runMu.Lock()
+	defer w.runMu.Unlock()
+
+	report := &RetentionReport{
+		StartedAt: time.Now(),
+		Users:     []*RetentionResult{},
+	}
+
+	users, err := w.workspaceManager.ListAllUsers()
+	if err != nil {
+		logger.Warnf("Retention: failed to list workspaces: %v", err)
+	}
+
+	for _, userID := range users {
+		select {
+		case <-w.stop:
+			return w.finish(report)
+		default:
+		}
+
+		result := &RetentionResult{UserID: userID}
+		err := w.workspaceManager.WithWorkspace(userID, func(ws *workspace.Workspace) error {
+			return applyWorkspaceRetention(ws, result)
+		})
+		if err != nil {
+			result.Error = err.Error()
+			logger.Warnf("Retention: failed to apply retention for %s: %v", userID, err)
+		}
+
+		report.Workspaces++
+		report.Channels += result.Channels
+		report.Deleted += result.Deleted
+		report.ReclaimedBytes += result.ReclaimedBytes
+		if result.Deleted > 0 || result.Error != "" {
+			report.Users = append(report.Users, result)
+		}
+	}
+
+	return w.finish(report)
+}
+
+// finish 记录并返回本轮结果
+func (w *RetentionWorker) finish(report *RetentionReport) *RetentionReport {
+	report.FinishedAt = time.Now()
+	if report.Deleted > 0 {
+		logger.Infof("Retention: removed %d messages from %d workspaces, reclaimed %d bytes",
+			report.Deleted, len(report.Users), report.ReclaimedBytes)
+	}
+
+	w.mu.Lock()
+	w.lastReport = report
+	w.mu.Unlock()
+	return report
+}
+
+// applyWorkspaceRetention 执行工作空间中所有频道的保留策略，有删除时压缩数据库
+func applyWorkspaceRetention(ws *workspace.Workspace, result *RetentionResult) error {
+	ums := NewUserMessageStorage(ws)
+	channels, err := ums.GetAllChannels()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, channel := range channels {
+		if channel.Retention.IsEmpty() {
+			continue
+		}
+		result.Channels++
+
+		ids, err := ums.ApplyRetention(channel, now)
+		result.Deleted += len(ids)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", channel.ID, err)
+		}
+	}
+
+	if result.Deleted == 0 {
+		return nil
+	}
+
+	reclaimed, err := ws.Compact()
+	if err != nil {
+		return err
+	}
+	result.ReclaimedBytes = reclaimed
+	return nil
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"miemie/internal/models"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrInvalidSearchQuery 搜索语法错误
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+const (
+	highlightStart = "<mark>"
+	highlightEnd   = "</mark>"
+	snippetTokens  = 24
+	snippetRunes   = 48
+)
+
+// trigram 分词要求每个词至少 3 个字符
+const minTrigramRunes = 3
+
+// ftsOperators FTS5 查询语法中的关键字，判断词长时忽略
+var ftsOperators = map[string]bool{"AND": true, "OR": true, "NOT": true, "NEAR": true}
+
+// SearchMessages 在用户消息中全文搜索
+// 支持 FTS5 查询语法（AND/OR/NOT、"短语"、NEAR、列过滤 title:xx）；
+// FTS5 不可用或包含少于 3 个字符的搜索词时退化为 LIKE 匹配（所有词都需出现）。
+func (ums *UserMessageStorage) SearchMessages(q *models.SearchQuery) (*models.SearchResults, error) {
+	if strings.TrimSpace(q.Query) == "" {
+		return nil, fmt.Errorf("%w: empty query", ErrInvalidSearchQuery)
+	}
+
+	terms := searchTerms(q.Query)
+	if ums.workspace.SearchEnabled && !hasShortTerm(terms) {
+		return ums.searchFTS(q)
+	}
+	return ums.searchLike(q, terms)
+}
+
+// searchFTS 使用 FTS5 索引搜索
+func (ums *UserMessageStorage) searchFTS(q *models.SearchQuery) (*models.SearchResults, error) {
+	where, args := searchFilters(q)
+	where = append([]string{"messages_fts MATCH ?"}, where...)
+	args = append([]interface{}{q.Query}, args...)
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	countQuery := `
+	SELECT COUNT(*) FROM messages_fts
+	JOIN messages m ON m.rowid = messages_fts.rowid
+	WHERE ` + whereSQL
+	if err := ums.workspace.MessagesDB.QueryRow(countQuery, args...).Scan(&total); err != nil {
+		return nil, wrapSearchError(err)
+	}
+
+	orderBy := "bm25(messages_fts)"
+	if q.Sort == "newest" {
+		orderBy = "m.created_at DESC"
+	}
+
+	query := fmt.Sprintf(`
+	SELECT m.id, m.channel_id, m.title, m.content, m.message_type, m.priority, m.sender,
+		m.created_at, m.updated_at, m.metadata, m.seq, m.collapse_key, m.expires_at,
+		highlight(messages_fts, 0, ?, ?),
+		snippet(messages_fts, 1, ?, ?, '…', %d),
+		bm25(messages_fts)
+	FROM messages_fts
+	JOIN messages m ON m.rowid = messages_fts.rowid
+	WHERE %s
+	ORDER BY %s
+	LIMIT ? OFFSET ?
+	`, snippetTokens, whereSQL, orderBy)
+
+	queryArgs := append([]interface{}{highlightStart, highlightEnd, highlightStart, highlightEnd}, args...)
+	queryArgs = append(queryArgs, q.Limit, q.Offset)
+
+	rows, err := ums.workspace.MessagesDB.Query(query, queryArgs...)
+	if err != nil {
+		return nil, wrapSearchError(err)
+	}
+	defer rows.Close()
+
+	results := &models.SearchResults{Hits: []*models.SearchHit{}, Total: total, Mode: "fts"}
+	for rows.Next() {
+		hit := &models.SearchHit{}
+		var score float64
+
+		message, err := scanMessage(rows, &hit.HighlightedTitle, &hit.Snippet, &score)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		hit.Message = message
+		// bm25 越小越相关，取反后越大越相关
+		hit.Score = -score
+		hit.Message.UserID = ums.workspace.UserID
+
+		results.Hits = append(results.Hits, hit)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapSearchError(err)
+	}
+
+	return results, nil
+}
+
+// searchLike 使用 LIKE 逐词匹配，按时间倒序返回
+func (ums *UserMessageStorage) searchLike(q *models.SearchQuery, terms []string) (*models.SearchResults, error) {
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("%w: no search terms", ErrInvalidSearchQuery)
+	}
+
+	where, args := searchFilters(q)
+	for _, term := range terms {
+		pattern := "%" + escapeLike(term) + "%"
+		where = append(where, `(m.title LIKE ? ESCAPE '\' OR m.content LIKE ? ESCAPE '\' OR m.sender LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern, pattern)
+	}
+	whereSQL := strings.Join(where, " AND ")
+
+	var total int
+	if err := ums.workspace.MessagesDB.QueryRow("SELECT COUNT(*) FROM messages m WHERE "+whereSQL, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count search results: %w", err)
+	}
+
+	query := `
+	SELECT m.id, m.channel_id, m.title, m.content, m.message_type, m.priority, m.sender,
+		m.created_at, m.updated_at, m.metadata, m.seq, m.collapse_key, m.expires_at
+	FROM messages m
+	WHERE ` + whereSQL + `
+	ORDER BY m.created_at DESC
+	LIMIT ? OFFSET ?
+	`
+	rows, err := ums.workspace.MessagesDB.Query(query, append(args, q.Limit, q.Offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search messages: %w", err)
+	}
+	defer rows.Close()
+
+	matcher := termMatcher(terms)
+	results := &models.SearchResults{Hits: []*models.SearchHit{}, Total: total, Mode: "like"}
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		message.UserID = ums.workspace.UserID
+
+		results.Hits = append(results.Hits, &models.SearchHit{
+			Message:          message,
+			HighlightedTitle: highlightText(message.Title, matcher),
+			Snippet:          snippetText(message.Content, matcher),
+		})
+	}
+
+	return results, rows.Err()
+}
+
+// searchFilters 构建结构化过滤条件
+func searchFilters(q *models.SearchQuery) ([]string, []interface{}) {
+	where := []string{"(m.expires_at IS NULL OR m.expires_at > ?)"}
+	args := []interface{}{nowUTC()}
+
+	if q.ChannelID != "" {
+		where = append(where, "m.channel_id = ?")
+		args = append(args, q.ChannelID)
+	}
+	if q.Sender != "" {
+		where = append(where, "m.sender = ?")
+		args = append(args, q.Sender)
+	}
+	if q.MessageType != "" {
+		where = append(where, "m.message_type = ?")
+		args = append(args, q.MessageType)
+	}
+	if q.MinPriority > 0 {
+		where = append(where, "m.priority >= ?")
+		args = append(args, q.MinPriority)
+	}
+	if q.MaxPriority > 0 {
+		where = append(where, "m.priority <= ?")
+		args = append(args, q.MaxPriority)
+	}
+	if q.Since != nil {
+		where = append(where, "m.created_at >= ?")
+		args = append(args, *q.Since)
+	}
+	if q.Until != nil {
+		where = append(where, "m.created_at <= ?")
+		args = append(args, *q.Until)
+	}
+
+	return where, args
+}
+
+// searchTerms 从查询中提取搜索词（去掉运算符、引号、括号和列前缀）
+func searchTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		if ftsOperators[field] {
+			continue
+		}
+		if idx := strings.Index(field, ":"); idx >= 0 {
+			field = field[idx+1:]
+		}
+		field = strings.Trim(field, `"()*^+-{}`)
+		if field != "" {
+			terms = append(terms, field)
+		}
+	}
+	return terms
+}
+
+// hasShortTerm 是否存在 trigram 索引无法匹配的短词
+func hasShortTerm(terms []string) bool {
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < minTrigramRunes {
+			return true
+		}
+	}
+	return false
+}
+
+// escapeLike 转义 LIKE 通配符
+func escapeLike(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
+
+// termMatcher 构建大小写不敏感的搜索词匹配正则
+func termMatcher(terms []string) *regexp.Regexp {
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	return regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+}
+
+// highlightText 高亮文本中所有匹配的搜索词
+func highlightText(text string, matcher *regexp.Regexp) string {
+	return matcher.ReplaceAllStringFunc(text, func(match string) string {
+		return highlightStart + match + highlightEnd
+	})
+}
+
+// snippetText 截取第一个匹配附近的文本作为摘要
+func snippetText(text string, matcher *regexp.Regexp) string {
+	runes := []rune(text)
+	start := 0
+	if loc := matcher.FindStringIndex(text); loc != nil {
+		start = utf8.RuneCountInString(text[:loc[0]]) - snippetRunes/4
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := start + snippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	snippet := highlightText(string(runes[start:end]), matcher)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// wrapSearchError 将 FTS5 语法错误转换为 ErrInvalidSearchQuery
+func wrapSearchError(err error) error {
+	msg := err.Error()
+	for _, marker := range []string{"fts5:", "syntax error", "unterminated string", "no such column"} {
+		if strings.Contains(msg, marker) {
+			return fmt.Errorf("%w: %v", ErrInvalidSearchQuery, err)
+		}
+	}
+	return fmt.Errorf("failed to search messages: %w", err)
+}
@@ -1,14 +1,21 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"miemie/internal/logger"
 	"miemie/internal/models"
 	"miemie/internal/workspace"
+	"strings"
 	"time"
 )
 
+// ErrMessageSuperseded 频道中已有折叠键相同且更新的消息
+var ErrMessageSuperseded = errors.New("message superseded by a newer message with the same collapse key")
+
 type UserMessageStorage struct {
 	workspace *workspace.Workspace
 }
@@ -19,104 +26,201 @@ func NewUserMessageStorage(ws *workspace.Workspace) *UserMessageStorage {
 	}
 }
 
+// CreateMessage 写入消息并分配工作空间序号（写入 message.Seq）
+// 带折叠键的消息替换同一频道中折叠键相同的旧消息，被替换的消息ID写入 message.Replaces，旧消息的阅读状态迁移到新消息并清除已读；
+// 旧消息比新消息更新时返回 ErrMessageSuperseded。全文索引由 messages 表上的触发器在同一事务内同步
 func (ums *UserMessageStorage) CreateMessage(message *models.Message) error {
 	metadataJSON, _ := json.Marshal(message.Metadata)
 
-	query := `
-	INSERT INTO messages (id, channel_id, title, content, message_type, priority, sender, created_at, updated_at, metadata)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-	`
+	tx, err := ums.workspace.MessagesDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
 
-	_, err := ums.workspace.MessagesDB.Exec(query,
-		message.ID,
-		message.ChannelID,
-		message.Title,
-		message.Content,
-		message.MessageType,
-		message.Priority,
-		message.Sender,
-		message.CreatedAt,
-		message.UpdatedAt,
-		string(metadataJSON),
-	)
+	// 先写计数器以获取写锁，保证并发写入时序号唯一且递增
+	var seq int64
+	if _, err := tx.Exec("UPDATE message_seq SET value = value + 1 WHERE id = 1"); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to allocate message seq: %w", err)
+	}
+	if err := tx.QueryRow("SELECT value FROM message_seq WHERE id = 1").Scan(&seq); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to allocate message seq: %w", err)
+	}
+
+	// 同一频道中折叠键相同的旧消息原地替换：沿用旧行并分配新序号，同步和重放都能看到替换后的消息
+	var replacedID string
+	if message.CollapseKey != "" {
+		var replacedAt time.Time
+		err := tx.QueryRow("SELECT id, created_at FROM messages WHERE channel_id = ? AND collapse_key = ?",
+			message.ChannelID, message.CollapseKey).Scan(&replacedID, &replacedAt)
+		if err != nil && err != sql.ErrNoRows {
+			tx.Rollback()
+			return fmt.Errorf("failed to find collapsed message: %w", err)
+		}
+		// 重试等原因晚到的旧消息不能覆盖更新的消息
+		if replacedID != "" && replacedAt.After(message.CreatedAt) {
+			tx.Rollback()
+			return ErrMessageSuperseded
+		}
+	}
+
+	var collapseKey, expiresAt interface{}
+	if message.CollapseKey != "" {
+		collapseKey = message.CollapseKey
+	}
+	if message.ExpiresAt != nil {
+		expiresAt = message.ExpiresAt.UTC()
+	}
+
+	if replacedID != "" {
+		// 同一条消息重试时原地写入，保留之前记录的被替换消息
+		var replaces interface{}
+		if replacedID != message.ID {
+			replaces = replacedID
+		}
+		_, err = tx.Exec(`
+		UPDATE messages SET id = ?, title = ?, content = ?, message_type = ?, priority = ?, sender = ?,
+			created_at = ?, updated_at = ?, metadata = ?, seq = ?, expires_at = ?, replaces = COALESCE(?, replaces)
+		WHERE id = ?`,
+			message.ID,
+			message.Title,
+			message.Content,
+			message.MessageType,
+			message.Priority,
+			message.Sender,
+			message.CreatedAt,
+			message.UpdatedAt,
+			string(metadataJSON),
+			seq,
+			expiresAt,
+			replaces,
+			replacedID,
+		)
+	} else {
+		query := `
+		INSERT INTO messages (id, channel_id, title, content, message_type, priority, sender, created_at, updated_at, metadata, seq, collapse_key, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`
+
+		_, err = tx.Exec(query,
+			message.ID,
+			message.ChannelID,
+			message.Title,
+			message.Content,
+			message.MessageType,
+			message.Priority,
+			message.Sender,
+			message.CreatedAt,
+			message.UpdatedAt,
+			string(metadataJSON),
+			seq,
+			collapseKey,
+			expiresAt,
+		)
+	}
 
 	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("failed to create message: %w", err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create message: %w", err)
+	}
+	message.Seq = seq
+
+	if replacedID != "" && replacedID != message.ID {
+		message.Replaces = replacedID
+	}
+	// 消息已经提交，阅读状态迁移失败只记录日志，重试时会再次迁移
+	if err := ums.MoveReplacedReadStatus(message); err != nil {
+		logger.Warnf("Failed to move read status of replaced message %s: %v", message.Replaces, err)
+	}
+
+	ums.recordStats(time.Now(), []statsEntry{{channelID: message.ChannelID, priority: message.Priority}}, false)
+
 	// 更新频道的最后消息时间
 	return ums.updateChannelLastMessage(message.ChannelID, message.CreatedAt)
 }
 
-func (ums *UserMessageStorage) GetMessages(channelID string, limit, offset int) ([]*models.Message, error) {
+// GetMessagesAfterSeq 按序号正序获取 afterSeq 之后的消息（用于断线重放和长轮询）
+// 指定 channelIDs 时只返回这些频道的消息
+func (ums *UserMessageStorage) GetMessagesAfterSeq(afterSeq int64, limit int, channelIDs ...string) ([]*models.Message, error) {
 	query := `
-	SELECT id, channel_id, title, content, message_type, priority, sender, created_at, updated_at, metadata
+	SELECT ` + messageColumns + `
 	FROM messages
-	WHERE channel_id = ?
-	ORDER BY created_at DESC
-	LIMIT ? OFFSET ?
-	`
+	WHERE seq > ? AND ` + notExpired
+	args := []interface{}{afterSeq, nowUTC()}
 
-	rows, err := ums.workspace.MessagesDB.Query(query, channelID, limit, offset)
+	if len(channelIDs) > 0 {
+		query += " AND channel_id IN (?" + strings.Repeat(", ?", len(channelIDs)-1) + ")"
+		for _, channelID := range channelIDs {
+			args = append(args, channelID)
+		}
+	}
+
+	query += " ORDER BY seq ASC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := ums.workspace.MessagesDB.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []*models.Message
-	for rows.Next() {
-		message := &models.Message{}
-		var metadataJSON sql.NullString
-
-		err := rows.Scan(
-			&message.ID,
-			&message.ChannelID,
-			&message.Title,
-			&message.Content,
-			&message.MessageType,
-			&message.Priority,
-			&message.Sender,
-			&message.CreatedAt,
-			&message.UpdatedAt,
-			&metadataJSON,
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
+	return scanMessages(rows)
+}
 
-		if metadataJSON.Valid {
-			json.Unmarshal([]byte(metadataJSON.String), &message.Metadata)
+// GetLatestSeq 获取最近分配的消息序号
+func (ums *UserMessageStorage) GetLatestSeq() (int64, error) {
+	var seq int64
+	err := ums.workspace.MessagesDB.QueryRow("SELECT value FROM message_seq WHERE id = 1").Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get latest seq: %w", err)
+	}
+	return seq, nil
+}
+
+// GetMessageSeq 获取消息的序号
+func (ums *UserMessageStorage) GetMessageSeq(id string) (int64, error) {
+	var seq int64
+	err := ums.workspace.MessagesDB.QueryRow("SELECT seq FROM messages WHERE id = ?", id).Scan(&seq)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("message not found")
 		}
+		return 0, fmt.Errorf("failed to get message seq: %w", err)
+	}
+	return seq, nil
+}
 
-		messages = append(messages, message)
+// GetMessages 按偏移分页获取频道消息，filter 可以为 nil
+func (ums *UserMessageStorage) GetMessages(channelID string, limit, offset int, filter *ReadFilter) ([]*models.Message, error) {
+	where := "channel_id = ? AND " + notExpired
+	for _, condition := range filter.conditions() {
+		where += " AND " + condition
 	}
 
-	return messages, nil
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE ` + where + `
+	ORDER BY created_at DESC
+	LIMIT ? OFFSET ?
+	`
+
+	return ums.queryMessages(filter, query, channelID, nowUTC(), limit, offset)
 }
 
 func (ums *UserMessageStorage) GetMessage(id string) (*models.Message, error) {
 	query := `
-	SELECT id, channel_id, title, content, message_type, priority, sender, created_at, updated_at, metadata
+	SELECT ` + messageColumns + `
 	FROM messages
-	WHERE id = ?
+	WHERE id = ? AND ` + notExpired + `
 	`
 
-	message := &models.Message{}
-	var metadataJSON sql.NullString
-
-	err := ums.workspace.MessagesDB.QueryRow(query, id).Scan(
-		&message.ID,
-		&message.ChannelID,
-		&message.Title,
-		&message.Content,
-		&message.MessageType,
-		&message.Priority,
-		&message.Sender,
-		&message.CreatedAt,
-		&message.UpdatedAt,
-		&metadataJSON,
-	)
-
+	message, err := scanMessage(ums.workspace.MessagesDB.QueryRow(query, id, nowUTC()))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("message not found")
@@ -124,50 +228,134 @@ func (ums *UserMessageStorage) GetMessage(id string) (*models.Message, error) {
 		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
 
-	if metadataJSON.Valid {
-		json.Unmarshal([]byte(metadataJSON.String), &message.Metadata)
+	return message, nil
+}
+
+// ReplacedMessageID 获取消息写入时被折叠替换的旧消息ID，没有替换时返回空字符串
+func (ums *UserMessageStorage) ReplacedMessageID(id string) (string, error) {
+	var replaces sql.NullString
+	err := ums.workspace.MessagesDB.QueryRow("SELECT replaces FROM messages WHERE id = ?", id).Scan(&replaces)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get replaced message: %w", err)
 	}
+	return replaces.String, nil
+}
 
-	return message, nil
+// MoveReplacedReadStatus 把被替换消息的阅读状态迁移到 message 上：只清除已读，保留收藏和归档
+// 旧消息的状态迁移后即不存在，重复调用不会改动新消息的状态
+func (ums *UserMessageStorage) MoveReplacedReadStatus(message *models.Message) error {
+	if message.Replaces == "" || message.Replaces == message.ID {
+		return nil
+	}
+	_, err := ums.workspace.ReadDB.Exec(`
+	UPDATE read_status SET message_id = ?, read_at = NULL, read_device = NULL, changed_at = ?
+	WHERE message_id = ? AND NOT EXISTS (SELECT 1 FROM read_status WHERE message_id = ?)`,
+		message.ID, time.Now(), message.Replaces, message.ID)
+	if err != nil {
+		return fmt.Errorf("failed to move read status: %w", err)
+	}
+	return nil
+}
+
+// MessageExists 检查消息是否已存在
+func (ums *UserMessageStorage) MessageExists(id string) (bool, error) {
+	var count int
+	err := ums.workspace.MessagesDB.QueryRow("SELECT COUNT(*) FROM messages WHERE id = ?", id).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check message: %w", err)
+	}
+	return count > 0, nil
 }
 
 func (ums *UserMessageStorage) CreateChannel(channel *models.Channel) error {
 	query := `
-	INSERT INTO channels (id, name, description, created_by, created_at)
-	VALUES (?, ?, ?, ?, ?)
+	INSERT INTO channels (id, slug, name, description, created_by, created_at,
+		retention_max_age_days, retention_max_messages, retention_keep_starred)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
+	var slug interface{}
+	if channel.Slug != "" {
+		slug = channel.Slug
+	}
+
+	policy := channel.Retention
+	if policy == nil {
+		policy = &models.RetentionPolicy{}
+	}
+
 	_, err := ums.workspace.MessagesDB.Exec(query,
 		channel.ID,
+		slug,
 		channel.Name,
 		channel.Description,
 		channel.CreatedBy,
 		channel.CreatedAt,
+		policy.MaxAgeDays,
+		policy.MaxMessages,
+		policy.KeepStarred,
 	)
 
 	return err
 }
 
-func (ums *UserMessageStorage) GetChannel(id string) (*models.Channel, error) {
-	query := `
-	SELECT id, name, description, created_by, created_at, last_message_at
-	FROM channels
-	WHERE id = ?
-	`
+// channelColumns 频道查询的列，与 scanChannel 的顺序一致
+// 静音状态来自 user_channels，截止时间已过的静音视为未静音
+const channelColumns = "id, slug, name, description, created_by, created_at, last_message_at, retention_max_age_days, retention_max_messages, retention_keep_starred, " +
+	"(SELECT is_muted FROM user_channels uc WHERE uc.channel_id = channels.id), " +
+	"(SELECT muted_until FROM user_channels uc WHERE uc.channel_id = channels.id)"
 
+// scanChannel 扫描一行频道记录，未设置保留策略时 Retention 为 nil
+func scanChannel(scanner interface{ Scan(...interface{}) error }) (*models.Channel, error) {
 	channel := &models.Channel{}
-	err := ums.workspace.MessagesDB.QueryRow(query, id).Scan(
+	var maxAgeDays, maxMessages sql.NullInt64
+	var keepStarred, muted sql.NullBool
+	var mutedUntil sql.NullTime
+	var slug sql.NullString
+	err := scanner.Scan(
 		&channel.ID,
+		&slug,
 		&channel.Name,
 		&channel.Description,
 		&channel.CreatedBy,
 		&channel.CreatedAt,
 		&channel.LastMessageAt,
+		&maxAgeDays,
+		&maxMessages,
+		&keepStarred,
+		&muted,
+		&mutedUntil,
 	)
+	if err != nil {
+		return nil, err
+	}
+	channel.Slug = slug.String
 
+	if muted.Bool && (!mutedUntil.Valid || mutedUntil.Time.After(time.Now())) {
+		channel.Muted = true
+		if mutedUntil.Valid {
+			channel.MutedUntil = &mutedUntil.Time
+		}
+	}
+
+	policy := &models.RetentionPolicy{
+		MaxAgeDays:  int(maxAgeDays.Int64),
+		MaxMessages: int(maxMessages.Int64),
+		KeepStarred: keepStarred.Bool,
+	}
+	if !policy.IsEmpty() {
+		channel.Retention = policy
+	}
+	return channel, nil
+}
+
+func (ums *UserMessageStorage) GetChannel(id string) (*models.Channel, error) {
+	query := "SELECT " + channelColumns + " FROM channels WHERE id = ?"
+
+	channel, err := scanChannel(ums.workspace.MessagesDB.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("channel not found")
+			return nil, ErrChannelNotFound
 		}
 		return nil, fmt.Errorf("failed to get channel: %w", err)
 	}
@@ -176,11 +364,7 @@ func (ums *UserMessageStorage) GetChannel(id string) (*models.Channel, error) {
 }
 
 func (ums *UserMessageStorage) GetAllChannels() ([]*models.Channel, error) {
-	query := `
-	SELECT id, name, description, created_by, created_at, last_message_at
-	FROM channels
-	ORDER BY last_message_at DESC, created_at DESC
-	`
+	query := "SELECT " + channelColumns + " FROM channels ORDER BY last_message_at DESC, created_at DESC"
 
 	rows, err := ums.workspace.MessagesDB.Query(query)
 	if err != nil {
@@ -190,15 +374,7 @@ func (ums *UserMessageStorage) GetAllChannels() ([]*models.Channel, error) {
 
 	var channels []*models.Channel
 	for rows.Next() {
-		channel := &models.Channel{}
-		err := rows.Scan(
-			&channel.ID,
-			&channel.Name,
-			&channel.Description,
-			&channel.CreatedBy,
-			&channel.CreatedAt,
-			&channel.LastMessageAt,
-		)
+		channel, err := scanChannel(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan channel: %w", err)
 		}
@@ -209,21 +385,60 @@ func (ums *UserMessageStorage) GetAllChannels() ([]*models.Channel, error) {
 	return channels, nil
 }
 
+// SetChannelRetention 设置频道的保留策略，policy 为空时取消策略
+func (ums *UserMessageStorage) SetChannelRetention(channelID string, policy *models.RetentionPolicy) error {
+	if policy.IsEmpty() {
+		policy = &models.RetentionPolicy{}
+	}
+
+	result, err := ums.workspace.MessagesDB.Exec(`
+		UPDATE channels
+		SET retention_max_age_days = ?, retention_max_messages = ?, retention_keep_starred = ?
+		WHERE id = ?
+	`, policy.MaxAgeDays, policy.MaxMessages, policy.KeepStarred, channelID)
+	if err != nil {
+		return fmt.Errorf("failed to set channel retention: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("channel not found")
+	}
+	return nil
+}
+
+// CountChannels 统计频道数量
+func (ums *UserMessageStorage) CountChannels() (int, error) {
+	var count int
+	if err := ums.workspace.MessagesDB.QueryRow("SELECT COUNT(*) FROM channels").Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count channels: %w", err)
+	}
+	return count, nil
+}
+
 func (ums *UserMessageStorage) updateChannelLastMessage(channelID string, messageTime time.Time) error {
 	query := `UPDATE channels SET last_message_at = ? WHERE id = ?`
 	_, err := ums.workspace.MessagesDB.Exec(query, messageTime, channelID)
 	return err
 }
 
+// markReadQuery 写入已读时间和变更时间，保留星标、归档等其他状态
+const markReadQuery = `
+	INSERT INTO read_status (message_id, read_at, read_device, changed_at)
+	VALUES (?, ?, ?, ?)
+	ON CONFLICT(message_id) DO UPDATE SET read_at = excluded.read_at, read_device = excluded.read_device,
+		changed_at = excluded.changed_at
+`
+
 // 添加已读状态
 func (ums *UserMessageStorage) MarkAsRead(messageID, deviceID string) error {
+	entries := ums.unreadStatsEntries([]string{messageID})
 	now := time.Now()
-	query := `
-	INSERT OR REPLACE INTO read_status (message_id, read_at, read_device)
-	VALUES (?, ?, ?)
-	`
-	_, err := ums.workspace.ReadDB.Exec(query, messageID, now, deviceID)
-	return err
+	if _, err := ums.workspace.ReadDB.Exec(markReadQuery, messageID, now, deviceID, now); err != nil {
+		return err
+	}
+	ums.recordStats(now, entries, true)
+
+	ums.workspace.NotifyRead([]string{messageID})
+	return nil
 }
 
 // 批量标记已读
@@ -232,16 +447,14 @@ func (ums *UserMessageStorage) MarkMultipleAsRead(messageIDs []string, deviceID
 		return nil
 	}
 
+	entries := ums.unreadStatsEntries(messageIDs)
 	now := time.Now()
 	tx, err := ums.workspace.ReadDB.Begin()
 	if err != nil {
 		return err
 	}
 
-	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO read_status (message_id, read_at, read_device)
-		VALUES (?, ?, ?)
-	`)
+	stmt, err := tx.Prepare(markReadQuery)
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -249,99 +462,88 @@ func (ums *UserMessageStorage) MarkMultipleAsRead(messageIDs []string, deviceID
 	defer stmt.Close()
 
 	for _, messageID := range messageIDs {
-		_, err = stmt.Exec(messageID, now, deviceID)
+		_, err = stmt.Exec(messageID, now, deviceID, now)
 		if err != nil {
 			tx.Rollback()
 			return err
 		}
 	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	ums.recordStats(now, entries, true)
+
+	ums.workspace.NotifyRead(messageIDs)
+	return nil
 }
 
-// 获取未读消息数量
+// 获取未读消息数量，channelID 为空时统计所有未静音的频道
 func (ums *UserMessageStorage) GetUnreadCount(channelID string) (int, error) {
-	// 获取所有消息ID，然后检查哪些未读
-	var totalMessages []string
-	var query string
-	var args []interface{}
-
+	channelIDs := []string{channelID}
 	if channelID == "" {
-		query = "SELECT id FROM messages"
-		args = []interface{}{}
-	} else {
-		query = "SELECT id FROM messages WHERE channel_id = ?"
-		args = []interface{}{channelID}
-	}
-
-	rows, err := ums.workspace.MessagesDB.Query(query, args...)
-	if err != nil {
-		return 0, err
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var messageID string
-		if err := rows.Scan(&messageID); err != nil {
-			continue
+		all, err := ums.messageChannelIDs()
+		if err != nil {
+			return 0, err
 		}
-		totalMessages = append(totalMessages, messageID)
-	}
-
-	if len(totalMessages) == 0 {
-		return 0, nil
-	}
-
-	// 检查哪些消息已读
-	placeholders := ""
-	for i := range totalMessages {
-		if i > 0 {
-			placeholders += ","
+		// 总数不包括静音的频道
+		muted, err := ums.mutedChannels()
+		if err != nil {
+			return 0, err
+		}
+		channelIDs = channelIDs[:0]
+		for _, id := range all {
+			if !muted[id] {
+				channelIDs = append(channelIDs, id)
+			}
 		}
-		placeholders += "?"
-	}
-
-	readQuery := fmt.Sprintf("SELECT COUNT(*) FROM read_status WHERE message_id IN (%s)", placeholders)
-	readArgs := make([]interface{}, len(totalMessages))
-	for i, msgID := range totalMessages {
-		readArgs[i] = msgID
 	}
 
-	var readCount int
-	err = ums.workspace.ReadDB.QueryRow(readQuery, readArgs...).Scan(&readCount)
+	counts, err := ums.UnreadCounts(channelIDs)
 	if err != nil {
 		return 0, err
 	}
 
-	return len(totalMessages) - readCount, nil
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	return total, nil
 }
 
-// 检查消息是否已读
+// 检查消息是否已读：在频道阅读位置之前，或者单独标记过已读
 func (ums *UserMessageStorage) IsMessageRead(messageID string) (bool, error) {
-	var count int
-	err := ums.workspace.ReadDB.QueryRow("SELECT COUNT(*) FROM read_status WHERE message_id = ?", messageID).Scan(&count)
-	return count > 0, err
+	var unread bool
+	err := ums.withReadStatus(func(conn *sql.Conn) error {
+		return conn.QueryRowContext(context.Background(),
+			"SELECT "+unreadCondition+" FROM messages WHERE id = ?", messageID).Scan(&unread)
+	})
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return !unread, err
 }
 
 // 获取消息的已读状态
 func (ums *UserMessageStorage) GetReadStatus(messageID string) (*models.ReadStatus, error) {
 	var readStatus models.ReadStatus
-	var archivedAt, starredAt sql.NullTime
-	var metadataJSON sql.NullString
+	var readAt, archivedAt, starredAt, changedAt sql.NullTime
+	var readDevice, metadataJSON sql.NullString
 
 	query := `
-	SELECT message_id, read_at, read_device, archived_at, starred_at, metadata
+	SELECT message_id, read_at, read_device, archived_at, starred_at, metadata, changed_at
 	FROM read_status
 	WHERE message_id = ?
 	`
 
 	err := ums.workspace.ReadDB.QueryRow(query, messageID).Scan(
 		&readStatus.MessageID,
-		&readStatus.ReadAt,
-		&readStatus.ReadDevice,
+		&readAt,
+		&readDevice,
 		&archivedAt,
 		&starredAt,
 		&metadataJSON,
+		&changedAt,
 	)
 
 	if err != nil {
@@ -351,6 +553,10 @@ func (ums *UserMessageStorage) GetReadStatus(messageID string) (*models.ReadStat
 		return nil, err
 	}
 
+	if readAt.Valid {
+		readStatus.ReadAt = &readAt.Time
+	}
+	readStatus.ReadDevice = readDevice.String
 	if archivedAt.Valid {
 		readStatus.ArchivedAt = &archivedAt.Time
 	}
@@ -360,6 +566,9 @@ func (ums *UserMessageStorage) GetReadStatus(messageID string) (*models.ReadStat
 	if metadataJSON.Valid {
 		json.Unmarshal([]byte(metadataJSON.String), &readStatus.Metadata)
 	}
+	if changedAt.Valid {
+		readStatus.ChangedAt = &changedAt.Time
+	}
 
 	return &readStatus, nil
 }
@@ -377,8 +586,7 @@ func (ums *UserMessageStorage) GetUserStats() (map[string]interface{}, error) {
 	stats["total_messages"] = totalMessages
 
 	// 总频道数
-	var totalChannels int
-	err = ums.workspace.MessagesDB.QueryRow("SELECT COUNT(*) FROM channels").Scan(&totalChannels)
+	totalChannels, err := ums.CountChannels()
 	if err != nil {
 		return nil, err
 	}
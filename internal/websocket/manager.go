@@ -2,6 +2,7 @@ package websocket
 
 import (
 	"encoding/json"
+	"miemie/internal/config"
 	"miemie/internal/logger"
 	"miemie/internal/models"
 	"net/http"
@@ -13,19 +14,43 @@ import (
 )
 
 var upgrader = websocket.Upgrader{
+	// 浏览器通过 ["bearer", <token>] 子协议携带凭证（见 middleware.WebSocketBearerProtocol），只回应 bearer
+	Subprotocols: []string{"bearer"},
 	CheckOrigin: func(r *http.Request) bool {
 		return true // 允许所有来源，生产环境需要更严格的检查
 	},
 }
 
+// 默认连接参数，与配置文件中的默认值一致
+const (
+	defaultMaxConnectionsPerUser = 10
+	defaultPingInterval          = 30 * time.Second
+	defaultReadTimeout           = 60 * time.Second
+	defaultWriteTimeout          = 10 * time.Second
+)
+
 type Client struct {
 	ID     string
 	UserID string
+	DeviceID string // 连接时通过 device_id 参数指定，默认为客户端ID
 	Conn   *websocket.Conn
-	Send   chan []byte
+	Send   chan Frame // 只由 Hub 关闭
 	Hub    *Manager
 	Active bool
 _mu    sync.RWMutex
+
+	closeCode   int    // Hub 关闭 Send 时写给客户端的关闭码
+	closeReason string
+	subscribedAll bool            // 接收全部频道，连接时默认开启，显式订阅频道后关闭
+	channels      map[string]bool // 显式订阅的频道，subscribedAll 关闭且为空时不接收任何推送
+
+	resume *resumePoint // 连接时请求的断线重放位置
+}
+
+// Frame 待发送给客户端的数据帧
+type Frame struct {
+	Data []byte
+	Seq  int64 // 消息推送的序号，其他帧为 0
 }
 
 func (c *Client) IsActive() bool {
@@ -40,30 +65,133 @@ func (c *Client) SetActive(active bool) {
 	c.Active = active
 }
 
+// setClose 记录关闭原因，在关闭 Send 前由 Hub 调用
+func (c *Client) setClose(code int, reason string) {
+	c._mu.Lock()
+	defer c._mu.Unlock()
+	c.closeCode = code
+	c.closeReason = reason
+}
+
+// closeMessage 构造关闭帧
+func (c *Client) closeMessage() []byte {
+	c._mu.RLock()
+	defer c._mu.RUnlock()
+	if c.closeCode == 0 {
+		return websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	}
+	return websocket.FormatCloseMessage(c.closeCode, c.closeReason)
+}
+
 type Manager struct {
 	clients    map[*Client]bool
 	userClients map[string]map[*Client]bool // 用户ID到客户端的映射
+	userSubscriptions map[string]map[*Subscription]bool // SSE、长轮询等订阅
 	broadcast  chan []byte
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
+
+	maxConnectionsPerUser int
+	pingInterval          time.Duration
+	readTimeout           time.Duration
+	writeTimeout          time.Duration
+
+	commandHandler CommandHandler
+	replaySource   ReplaySource
+
+	done      chan struct{} // Stop 时关闭
+	stopped   chan struct{} // Run 退出后关闭
+	startOnce sync.Once
+	stopOnce  sync.Once
 }
 
 func NewManager() *Manager {
-	return &Manager{
+	return NewManagerWithConfig(nil)
+}
+
+// NewManagerWithConfig 使用配置创建WebSocket管理器，配置为空或取值无效时使用默认值
+func NewManagerWithConfig(cfg *config.Config) *Manager {
+	m := &Manager{
 		clients:    make(map[*Client]bool),
 		userClients: make(map[string]map[*Client]bool),
+		userSubscriptions: make(map[string]map[*Subscription]bool),
 		broadcast:  make(chan []byte, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+
+		maxConnectionsPerUser: defaultMaxConnectionsPerUser,
+		pingInterval:          defaultPingInterval,
+		readTimeout:           defaultReadTimeout,
+		writeTimeout:          defaultWriteTimeout,
+
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if cfg != nil {
+		wsCfg := cfg.WebSocket
+		if wsCfg.MaxConnectionsPerUser > 0 {
+			m.maxConnectionsPerUser = wsCfg.MaxConnectionsPerUser
+		}
+		if wsCfg.PingIntervalSeconds > 0 {
+			m.pingInterval = wsCfg.GetPingInterval()
+		}
+		if wsCfg.ReadTimeoutSeconds > 0 {
+			m.readTimeout = wsCfg.GetReadTimeout()
+		}
+		if wsCfg.WriteTimeoutSeconds > 0 {
+			m.writeTimeout = wsCfg.GetWriteTimeout()
+		}
+	}
+
+	// 心跳必须早于读取超时，否则空闲连接会被误判为断开
+	if m.pingInterval >= m.readTimeout {
+		m.pingInterval = m.readTimeout * 9 / 10
+	}
+
+	return m
+}
+
+// Start 启动 Hub 事件循环
+func (m *Manager) Start() {
+	m.startOnce.Do(func() {
+		go m.Run()
+		logger.Infof("WebSocket hub started (max %d connections per user, ping %v, read timeout %v, write timeout %v)",
+			m.maxConnectionsPerUser, m.pingInterval, m.readTimeout, m.writeTimeout)
+	})
+}
+
+// Stop 停止 Hub 并断开所有客户端
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.done)
+	})
+
+	// 未启动过时无需等待
+	started := true
+	m.startOnce.Do(func() { started = false })
+	if started {
+		<-m.stopped
 	}
 }
 
 func (m *Manager) Run() {
+	defer close(m.stopped)
+
 	for {
 		select {
 		case client := <-m.register:
 			m.mu.Lock()
+			if len(m.userClients[client.UserID]) >= m.maxConnectionsPerUser {
+				m.mu.Unlock()
+				logger.Warnf("Rejecting client %s: user %s already has %d connections", client.ID, client.UserID, m.maxConnectionsPerUser)
+				client.setClose(websocket.ClosePolicyViolation, "too many connections")
+				client.SetActive(false)
+				close(client.Send)
+				continue
+			}
+
 			m.clients[client] = true
 
 			// 添加到用户映射
@@ -77,54 +205,120 @@ func (m *Manager) Run() {
 
 		case client := <-m.unregister:
 			m.mu.Lock()
-			if _, ok := m.clients[client]; ok {
-				delete(m.clients, client)
-
-				// 从用户映射中移除
-				if userMap, exists := m.userClients[client.UserID]; exists {
-					delete(userMap, client)
-					if len(userMap) == 0 {
-						delete(m.userClients, client.UserID)
-					}
-				}
-
-				close(client.Send)
-				client.SetActive(false)
-				logger.Infof("Client disconnected: %s (user: %s), total clients: %d", client.ID, client.UserID, len(m.clients))
-			}
+			m.removeClient(client)
 			m.mu.Unlock()
 
 		case message := <-m.broadcast:
+			var slow []*Client
 			m.mu.RLock()
 			for client := range m.clients {
 				if client.IsActive() {
 					select {
-					case client.Send <- message:
+					case client.Send <- Frame{Data: message}:
 					default:
-						// 发送失败，移除客户端
-						close(client.Send)
-						delete(m.clients, client)
-						client.SetActive(false)
+						slow = append(slow, client)
 					}
 				}
 			}
 			m.mu.RUnlock()
+
+			// 发送缓冲已满的客户端直接断开
+			if len(slow) > 0 {
+				m.mu.Lock()
+				for _, client := range slow {
+					client.setClose(websocket.CloseTryAgainLater, "send buffer full")
+					m.removeClient(client)
+				}
+				m.mu.Unlock()
+			}
+
+		case <-m.done:
+			m.mu.Lock()
+			for client := range m.clients {
+				client.setClose(websocket.CloseGoingAway, "server shutting down")
+				m.removeClient(client)
+			}
+			for _, userSubs := range m.userSubscriptions {
+				for sub := range userSubs {
+					m.removeSubscription(sub)
+				}
+			}
+			m.mu.Unlock()
+			logger.Info("WebSocket hub stopped")
+			return
 		}
 	}
 }
 
+// removeClient 移除客户端并关闭其发送通道，调用方需持有写锁
+// 只有已注册的客户端才会被关闭，因此重复移除是安全的
+func (m *Manager) removeClient(client *Client) {
+	if _, ok := m.clients[client]; !ok {
+		return
+	}
+
+	delete(m.clients, client)
+
+	// 从用户映射中移除
+	if userMap, exists := m.userClients[client.UserID]; exists {
+		delete(userMap, client)
+		if len(userMap) == 0 {
+			delete(m.userClients, client.UserID)
+		}
+	}
+
+	client.SetActive(false)
+	close(client.Send)
+	logger.Infof("Client disconnected: %s (user: %s), total clients: %d", client.ID, client.UserID, len(m.clients))
+}
+
+// unregisterClient 请求 Hub 移除客户端，Hub 已停止时直接返回
+func (m *Manager) unregisterClient(client *Client) {
+	select {
+	case m.unregister <- client:
+	case <-m.done:
+	}
+}
+
 func (m *Manager) HandleWebSocket(c *gin.Context) {
 	w := c.Writer
 	r := c.Request
 
-	// 从上下文获取用户ID
+	// 用户ID由认证中间件设置
 	userID := c.GetString("user_id")
 	if userID == "" {
-		// 如果上下文没有用户ID，尝试从URL参数获取
-		userID = c.Query("user_id")
-		if userID == "" {
-			userID = "default"
-		}
+		userID = "default"
+	}
+
+	select {
+	case <-m.done:
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"code":    503,
+			"message": "WebSocket service is shutting down",
+		})
+		return
+	default:
+	}
+
+	// 提前检查连接数，超限时直接返回 HTTP 错误；最终以 Hub 注册时的检查为准
+	if m.GetUserClientCount(userID) >= m.maxConnectionsPerUser {
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"code":    429,
+			"message": "Too many WebSocket connections",
+			"limit":   m.maxConnectionsPerUser,
+		})
+		return
+	}
+
+	// 升级之前完成所有参数检查，升级后只能通过关闭帧报告错误
+	resume, err := parseResumePoint(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "Invalid resume parameters",
+			"error":   err.Error(),
+		})
+		return
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -133,50 +327,143 @@ func (m *Manager) HandleWebSocket(c *gin.Context) {
 		return
 	}
 
+	clientID := generateClientID()
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		deviceID = clientID
+	}
+
 	client := &Client{
-		ID:     generateClientID(),
+		ID:     clientID,
 		UserID: userID,
+		DeviceID: deviceID,
 		Conn:   conn,
-		Send:   make(chan []byte, 256),
+		Send:   make(chan Frame, 256),
 		Hub:    m,
 		Active: true,
+		resume: resume,
+
+		subscribedAll: true,
 	}
 
-	m.register <- client
+	select {
+	case m.register <- client:
+	case <-m.done:
+		conn.WriteMessage(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+		conn.Close()
+		return
+	}
 
 	// 启动读写协程
 	go client.writePump()
 	go client.readPump()
 }
 
-func (m *Manager) BroadcastMessage(message *models.Message) {
+// BroadcastMessage 推送消息给接收者的在线客户端和订阅，返回成功推送的数量
+// 替换了同一折叠键旧消息的消息以 update 事件推送
+func (m *Manager) BroadcastMessage(message *models.Message) int {
 	data, err := json.Marshal(map[string]interface{}{
-		"type": "message",
+		"type": message.EventType(),
 		"data": message,
 	})
 	if err != nil {
 		logger.Infof("Failed to marshal message: %v", err)
-		return
+		return 0
 	}
 
+	pushed := 0
+	var slow []*Client
+
 	// 只发送给对应用户的客户端
 	m.mu.RLock()
-	defer m.mu.RUnlock()
-
 	if userClients, exists := m.userClients[message.UserID]; exists {
 		for client := range userClients {
-			if client.IsActive() {
+			if client.IsActive() && client.wantsChannel(message.ChannelID) {
 				select {
-				case client.Send <- data:
+				case client.Send <- Frame{Data: data, Seq: message.Seq}:
+					pushed++
 				default:
-					// 发送失败，移除客户端
-					client.SetActive(false)
+					slow = append(slow, client)
 				}
 			}
 		}
-	} else {
+	}
+	subPushed, slowSubs := m.publishToSubscriptions(message)
+	pushed += subPushed
+	if len(m.userClients[message.UserID]) == 0 && len(m.userSubscriptions[message.UserID]) == 0 {
 		logger.Infof("No active clients for user: %s", message.UserID)
 	}
+	m.mu.RUnlock()
+
+	// 订阅缓冲已满时关闭订阅，订阅方通过序号从存储补齐
+	if len(slowSubs) > 0 {
+		m.mu.Lock()
+		for _, sub := range slowSubs {
+			logger.Warnf("Subscription %s (user: %s) buffer full, closing", sub.ID, sub.UserID)
+			m.removeSubscription(sub)
+		}
+		m.mu.Unlock()
+	}
+
+	// 发送缓冲已满，交给 Hub 断开（Send 只由 Hub 关闭）
+	for _, client := range slow {
+		logger.Warnf("Client %s (user: %s) send buffer full, disconnecting", client.ID, client.UserID)
+		client.SetActive(false)
+		client.setClose(websocket.CloseTryAgainLater, "send buffer full")
+		go m.unregisterClient(client)
+	}
+
+	return pushed
+}
+
+// NotifyExpired 通知用户的在线客户端消息已过期并被清理，返回成功推送的数量
+// 过期事件不带序号，发送缓冲已满的客户端会错过通知，重连后拉取的列表中已不包含这些消息
+func (m *Manager) NotifyExpired(userID string, messageIDs []string) int {
+	data, err := json.Marshal(map[string]interface{}{
+		"type": models.EventExpired,
+		"data": map[string]interface{}{
+			"message_ids": messageIDs,
+		},
+	})
+	if err != nil {
+		logger.Infof("Failed to marshal expired event: %v", err)
+		return 0
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	pushed := 0
+	for client := range m.userClients[userID] {
+		if !client.IsActive() {
+			continue
+		}
+		select {
+		case client.Send <- Frame{Data: data}:
+			pushed++
+		default:
+		}
+	}
+	return pushed
+}
+
+// sendToClient 向单个客户端发送数据，客户端已移除或缓冲已满时返回 false
+// 持有读锁期间 Hub 无法关闭 Send，因此不会向已关闭的通道写入
+func (m *Manager) sendToClient(client *Client, data []byte) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !m.clients[client] {
+		return false
+	}
+
+	select {
+	case client.Send <- Frame{Data: data}:
+		return true
+	default:
+		return false
+	}
 }
 
 func (m *Manager) GetClientCount() int {
@@ -208,64 +495,78 @@ func (m *Manager) GetOnlineUsers() []string {
 
 func (c *Client) readPump() {
 	defer func() {
-		c.Hub.unregister <- c
+		c.Hub.unregisterClient(c)
 		c.Conn.Close()
 	}()
 
 	// 设置读取超时
-	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	readTimeout := c.Hub.readTimeout
+	c.Conn.SetReadLimit(maxCommandSize)
+	c.Conn.SetReadDeadline(time.Now().Add(readTimeout))
 	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		c.Conn.SetReadDeadline(time.Now().Add(readTimeout))
 		return nil
 	})
 
 	for {
-		_, _, err := c.Conn.ReadMessage()
+		messageType, data, err := c.Conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				logger.Infof("WebSocket error: %v", err)
 			}
 			break
 		}
+
+		// 收到任何数据都说明连接存活
+		c.Conn.SetReadDeadline(time.Now().Add(readTimeout))
+
+		if messageType != websocket.TextMessage {
+			continue
+		}
+		c.reply(c.handleCommand(data))
 	}
 }
 
 func (c *Client) writePump() {
-	ticker := time.NewTicker(54 * time.Second)
+	ticker := time.NewTicker(c.Hub.pingInterval)
+	writeTimeout := c.Hub.writeTimeout
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
 	}()
 
+	// 先重放断线期间的消息，期间到达的实时推送在 Send 中排队，序号已重放过的跳过
+	var replayedSeq int64
+	if c.resume != nil {
+		var err error
+		if replayedSeq, err = c.replay(); err != nil {
+			logger.Infof("Replay for client %s (user: %s) aborted: %v", c.ID, c.UserID, err)
+			return
+		}
+	}
+
 	for {
 		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		case frame, ok := <-c.Send:
+			c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
 			if !ok {
 				// Hub关闭了连接
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+				c.Conn.WriteMessage(websocket.CloseMessage, c.closeMessage())
 				return
 			}
-			w.Write(message)
 
-			// 发送队列中的其他消息
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write(<-c.Send)
+			if frame.Seq > 0 && frame.Seq <= replayedSeq {
+				continue
 			}
 
-			if err := w.Close(); err != nil {
+			// 每条消息单独一帧，客户端可以逐帧解析JSON
+			if err := c.Conn.WriteMessage(websocket.TextMessage, frame.Data); err != nil {
 				return
 			}
 
 		case <-ticker.C:
 			// 发送心跳
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.Conn.SetWriteDeadline(time.Now().Add(writeTimeout))
 			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
@@ -0,0 +1,289 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"miemie/internal/logger"
+	"time"
+)
+
+// 客户端命令类型
+const (
+	CommandSubscribe   = "subscribe"   // 订阅频道，data: {"channels": [...]}
+	CommandUnsubscribe = "unsubscribe" // 取消订阅，data: {"channels": [...]}
+	CommandMarkRead    = "mark_read"   // 标记已读，data: {"message_ids": [...]}
+	CommandAck         = "ack"         // 确认收到，data: {"message_ids": [...]}
+	CommandHistory     = "history"     // 拉取历史，data: HistoryRequest
+	CommandPing        = "ping"        // 应用层心跳，data: {"client_time": 毫秒时间戳}
+)
+
+// AllChannels 订阅命令中表示全部频道
+const AllChannels = "*"
+
+// maxCommandSize 单个命令帧的最大字节数
+const maxCommandSize = 64 * 1024
+
+// Command 客户端发送的命令
+type Command struct {
+	ID   string          `json:"id"` // 客户端生成，响应中原样返回
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// Response 命令响应，通过 id 与命令对应
+type Response struct {
+	Type    string      `json:"type"` // 固定为 response
+	ID      string      `json:"id"`
+	Command string      `json:"command"`
+	OK      bool        `json:"ok"`
+	Code    int         `json:"code"`
+	Data    interface{} `json:"data,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// HistoryRequest 历史消息分页请求
+type HistoryRequest struct {
+	ChannelID string `json:"channel_id"`
+	Cursor    string `json:"cursor,omitempty"`
+	Direction string `json:"direction,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+// CommandError 带状态码的命令错误
+type CommandError struct {
+	Code    int
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return e.Message
+}
+
+// NewCommandError 创建命令错误
+func NewCommandError(code int, format string, args ...interface{}) *CommandError {
+	return &CommandError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// CommandHandler 需要访问存储和投递系统的命令由上层实现
+type CommandHandler interface {
+	MarkRead(userID, deviceID string, messageIDs []string) (interface{}, error)
+	Ack(userID, deviceID string, messageIDs []string) (interface{}, error)
+	History(userID string, req *HistoryRequest) (interface{}, error)
+	// ResolveChannels 把频道ID或标识解析为频道ID，不存在的频道和 AllChannels 原样返回
+	ResolveChannels(userID string, refs []string) ([]string, error)
+}
+
+// SetCommandHandler 注册命令处理器
+func (m *Manager) SetCommandHandler(handler CommandHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commandHandler = handler
+}
+
+// getCommandHandler 获取命令处理器
+func (m *Manager) getCommandHandler() CommandHandler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.commandHandler
+}
+
+type channelsPayload struct {
+	Channels []string `json:"channels"`
+}
+
+type messageIDsPayload struct {
+	MessageIDs []string `json:"message_ids"`
+}
+
+type pingPayload struct {
+	ClientTime int64 `json:"client_time"`
+}
+
+// handleCommand 解析并执行一条命令，返回响应
+func (c *Client) handleCommand(raw []byte) *Response {
+	var cmd Command
+	if err := json.Unmarshal(raw, &cmd); err != nil {
+		return errorResponse(&cmd, NewCommandError(400, "invalid command: %v", err))
+	}
+	if cmd.Type == "" {
+		return errorResponse(&cmd, NewCommandError(400, "missing command type"))
+	}
+
+	data, err := c.dispatchCommand(&cmd)
+	if err != nil {
+		return errorResponse(&cmd, err)
+	}
+
+	return &Response{
+		Type:    "response",
+		ID:      cmd.ID,
+		Command: cmd.Type,
+		OK:      true,
+		Code:    200,
+		Data:    data,
+	}
+}
+
+// dispatchCommand 按类型执行命令
+func (c *Client) dispatchCommand(cmd *Command) (interface{}, error) {
+	switch cmd.Type {
+	case CommandPing:
+		var payload pingPayload
+		if err := decodeCommandData(cmd, &payload); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"client_time": payload.ClientTime,
+			"server_time": time.Now().UnixMilli(),
+		}, nil
+
+	case CommandSubscribe, CommandUnsubscribe:
+		var payload channelsPayload
+		if err := decodeCommandData(cmd, &payload); err != nil {
+			return nil, err
+		}
+		if len(payload.Channels) == 0 {
+			return nil, NewCommandError(400, "channels is required")
+		}
+		channels := payload.Channels
+		if handler := c.Hub.getCommandHandler(); handler != nil {
+			resolved, err := handler.ResolveChannels(c.UserID, channels)
+			if err != nil {
+				return nil, err
+			}
+			channels = resolved
+		}
+		if cmd.Type == CommandSubscribe {
+			c.subscribe(channels)
+		} else {
+			c.unsubscribe(channels)
+		}
+		channels, all := c.Subscriptions()
+		return map[string]interface{}{"channels": channels, "all_channels": all}, nil
+
+	case CommandMarkRead, CommandAck:
+		var payload messageIDsPayload
+		if err := decodeCommandData(cmd, &payload); err != nil {
+			return nil, err
+		}
+		if len(payload.MessageIDs) == 0 {
+			return nil, NewCommandError(400, "message_ids is required")
+		}
+		handler := c.Hub.getCommandHandler()
+		if handler == nil {
+			return nil, NewCommandError(503, "command not available")
+		}
+		if cmd.Type == CommandMarkRead {
+			return handler.MarkRead(c.UserID, c.DeviceID, payload.MessageIDs)
+		}
+		return handler.Ack(c.UserID, c.DeviceID, payload.MessageIDs)
+
+	case CommandHistory:
+		var payload HistoryRequest
+		if err := decodeCommandData(cmd, &payload); err != nil {
+			return nil, err
+		}
+		handler := c.Hub.getCommandHandler()
+		if handler == nil {
+			return nil, NewCommandError(503, "command not available")
+		}
+		return handler.History(c.UserID, &payload)
+
+	default:
+		return nil, NewCommandError(400, "unknown command type: %s", cmd.Type)
+	}
+}
+
+// decodeCommandData 解析命令参数
+func decodeCommandData(cmd *Command, v interface{}) error {
+	if len(cmd.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(cmd.Data, v); err != nil {
+		return NewCommandError(400, "invalid %s data: %v", cmd.Type, err)
+	}
+	return nil
+}
+
+// errorResponse 构造失败响应
+func errorResponse(cmd *Command, err error) *Response {
+	code := 500
+	if cmdErr, ok := err.(*CommandError); ok {
+		code = cmdErr.Code
+	}
+	return &Response{
+		Type:    "response",
+		ID:      cmd.ID,
+		Command: cmd.Type,
+		OK:      false,
+		Code:    code,
+		Error:   err.Error(),
+	}
+}
+
+// subscribe 订阅频道；连接后未订阅任何频道时接收全部频道，第一次订阅后只接收订阅的频道
+// 订阅 "*" 恢复接收全部频道
+func (c *Client) subscribe(channels []string) {
+	c._mu.Lock()
+	defer c._mu.Unlock()
+	for _, channelID := range channels {
+		if channelID == AllChannels {
+			c.subscribedAll = true
+			c.channels = nil
+			return
+		}
+	}
+	c.subscribedAll = false
+	if c.channels == nil {
+		c.channels = make(map[string]bool)
+	}
+	for _, channelID := range channels {
+		c.channels[channelID] = true
+	}
+}
+
+// unsubscribe 取消订阅频道，取消最后一个频道后不再接收推送；取消 "*" 停止接收全部频道
+func (c *Client) unsubscribe(channels []string) {
+	c._mu.Lock()
+	defer c._mu.Unlock()
+	for _, channelID := range channels {
+		if channelID == AllChannels {
+			c.subscribedAll = false
+			c.channels = make(map[string]bool)
+			return
+		}
+	}
+	for _, channelID := range channels {
+		delete(c.channels, channelID)
+	}
+}
+
+// Subscriptions 返回显式订阅的频道，以及是否接收全部频道
+func (c *Client) Subscriptions() ([]string, bool) {
+	c._mu.RLock()
+	defer c._mu.RUnlock()
+	channels := make([]string, 0, len(c.channels))
+	for channelID := range c.channels {
+		channels = append(channels, channelID)
+	}
+	return channels, c.subscribedAll
+}
+
+// wantsChannel 客户端是否接收该频道的推送
+func (c *Client) wantsChannel(channelID string) bool {
+	c._mu.RLock()
+	defer c._mu.RUnlock()
+	return c.subscribedAll || c.channels[channelID]
+}
+
+// reply 发送命令响应
+func (c *Client) reply(resp *Response) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		logger.Warnf("Failed to marshal response for client %s: %v", c.ID, err)
+		return
+	}
+	if !c.Hub.sendToClient(c, data) {
+		logger.Warnf("Failed to send %s response to client %s (user: %s)", resp.Command, c.ID, c.UserID)
+	}
+}
@@ -0,0 +1,41 @@
+package websocket
+
+import "testing"
+
+func TestUnsubscribeLastChannelReceivesNothing(t *testing.T) {
+	c := &Client{subscribedAll: true}
+	if !c.wantsChannel("ops") {
+		t.Fatal("new client should receive every channel")
+	}
+
+	c.subscribe([]string{"ops"})
+	if !c.wantsChannel("ops") || c.wantsChannel("deploys") {
+		t.Fatal("after subscribe only ops should be received")
+	}
+
+	c.unsubscribe([]string{"ops"})
+	if c.wantsChannel("ops") || c.wantsChannel("deploys") {
+		t.Fatal("after unsubscribing the last channel nothing should be received")
+	}
+	if channels, all := c.Subscriptions(); len(channels) != 0 || all {
+		t.Fatalf("Subscriptions() = %v, %v, want none", channels, all)
+	}
+}
+
+func TestSubscribeAllChannels(t *testing.T) {
+	c := &Client{subscribedAll: true}
+	c.subscribe([]string{"ops"})
+
+	c.subscribe([]string{AllChannels})
+	if !c.wantsChannel("deploys") {
+		t.Fatal("subscribing to * should receive every channel")
+	}
+	if _, all := c.Subscriptions(); !all {
+		t.Fatal("Subscriptions() should report all channels")
+	}
+
+	c.unsubscribe([]string{AllChannels})
+	if c.wantsChannel("deploys") {
+		t.Fatal("unsubscribing from * should stop every channel")
+	}
+}
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"miemie/internal/models"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	replayPageSize    = 200
+	maxReplayMessages = 1000 // 超出后客户端应改用 /api/v3/messages/sync 补齐
+)
+
+// ReplaySource 提供断线重放所需的消息
+type ReplaySource interface {
+	MessagesAfterSeq(userID string, afterSeq int64, limit int) ([]*models.Message, error)
+	MessageSeq(userID, messageID string) (int64, error)
+}
+
+// resumePoint 客户端上次收到的位置，last_seq 优先于 last_message_id
+type resumePoint struct {
+	Seq       int64
+	MessageID string
+}
+
+// SetReplaySource 注册重放数据源
+func (m *Manager) SetReplaySource(source ReplaySource) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.replaySource = source
+}
+
+// getReplaySource 获取重放数据源
+func (m *Manager) getReplaySource() ReplaySource {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.replaySource
+}
+
+// parseResumePoint 解析连接参数中的 last_seq / last_message_id，未提供时返回 nil
+func parseResumePoint(c *gin.Context) (*resumePoint, error) {
+	if lastSeq := c.Query("last_seq"); lastSeq != "" {
+		seq, err := strconv.ParseInt(lastSeq, 10, 64)
+		if err != nil || seq < 0 {
+			return nil, fmt.Errorf("last_seq must be a non-negative integer")
+		}
+		return &resumePoint{Seq: seq}, nil
+	}
+	if lastMessageID := c.Query("last_message_id"); lastMessageID != "" {
+		return &resumePoint{MessageID: lastMessageID}, nil
+	}
+	return nil, nil
+}
+
+// replay 在切换到实时推送前补发断线期间的消息，返回已重放到的序号
+// 只在 writePump 中调用，直接写连接以保证重放消息先于排队的实时推送
+func (c *Client) replay() (int64, error) {
+	result := map[string]interface{}{"replayed": 0}
+
+	lastSeq, err := c.resolveResumeSeq()
+	if err != nil {
+		result["error"] = err.Error()
+		return 0, c.writeJSON(map[string]interface{}{"type": "replay_complete", "data": result})
+	}
+
+	source := c.Hub.getReplaySource()
+	if source == nil {
+		result["error"] = "replay not available"
+	}
+	replayed := 0
+	truncated := false
+	for source != nil {
+		messages, err := source.MessagesAfterSeq(c.UserID, lastSeq, replayPageSize)
+		if err != nil {
+			result["error"] = err.Error()
+			break
+		}
+
+		for _, message := range messages {
+			if replayed >= maxReplayMessages {
+				truncated = true
+				break
+			}
+			lastSeq = message.Seq
+			if !c.wantsChannel(message.ChannelID) {
+				continue
+			}
+			message.UserID = c.UserID
+			if err := c.writeJSON(map[string]interface{}{
+				"type":   "message",
+				"data":   message,
+				"replay": true,
+			}); err != nil {
+				return 0, err
+			}
+			replayed++
+		}
+
+		if truncated || len(messages) < replayPageSize {
+			break
+		}
+	}
+
+	result["replayed"] = replayed
+	result["last_seq"] = lastSeq
+	result["truncated"] = truncated
+	if err := c.writeJSON(map[string]interface{}{"type": "replay_complete", "data": result}); err != nil {
+		return 0, err
+	}
+
+	// 截断时后续消息不能跳过，只跳过真正发出的部分
+	return lastSeq, nil
+}
+
+// resolveResumeSeq 将重放位置转换为序号
+func (c *Client) resolveResumeSeq() (int64, error) {
+	if c.resume.MessageID == "" {
+		return c.resume.Seq, nil
+	}
+
+	source := c.Hub.getReplaySource()
+	if source == nil {
+		return 0, fmt.Errorf("replay not available")
+	}
+	seq, err := source.MessageSeq(c.UserID, c.resume.MessageID)
+	if err != nil {
+		return 0, fmt.Errorf("unknown last_message_id: %v", err)
+	}
+	return seq, nil
+}
+
+// writeJSON 直接向连接写入一帧JSON，只能在 writePump 协程中调用
+func (c *Client) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.Conn.SetWriteDeadline(time.Now().Add(c.Hub.writeTimeout))
+	return c.Conn.WriteMessage(websocket.TextMessage, data)
+}
@@ -0,0 +1,118 @@
+package websocket
+
+import (
+	"errors"
+	"miemie/internal/logger"
+	"miemie/internal/models"
+)
+
+// subscriptionBufferSize 订阅的推送缓冲，溢出时关闭订阅，由订阅方从存储中补齐
+const subscriptionBufferSize = 256
+
+var (
+	// ErrHubStopped Hub 已停止，无法再订阅
+	ErrHubStopped = errors.New("websocket hub stopped")
+	// ErrTooManySubscriptions 用户的订阅数超过 max_connections_per_user
+	ErrTooManySubscriptions = errors.New("too many subscriptions")
+)
+
+// Subscription SSE、长轮询等非WebSocket传输的推送订阅
+// 与WebSocket客户端共用 BroadcastMessage 的扇出，C 在取消订阅、Hub 停止或缓冲溢出时关闭
+type Subscription struct {
+	ID     string
+	UserID string
+	C      <-chan *models.Message
+
+	send     chan *models.Message // 只由 Hub 关闭
+	channels map[string]bool      // 订阅的频道，为空时接收全部
+}
+
+// wantsChannel 订阅是否接收该频道的消息
+func (s *Subscription) wantsChannel(channelID string) bool {
+	return len(s.channels) == 0 || s.channels[channelID]
+}
+
+// Subscribe 为用户创建推送订阅，channels 为空时接收全部频道
+func (m *Manager) Subscribe(userID string, channels []string) (*Subscription, error) {
+	send := make(chan *models.Message, subscriptionBufferSize)
+	sub := &Subscription{
+		ID:     "sub_" + generateClientID(),
+		UserID: userID,
+		C:      send,
+		send:   send,
+	}
+	if len(channels) > 0 {
+		sub.channels = make(map[string]bool, len(channels))
+		for _, channelID := range channels {
+			sub.channels[channelID] = true
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	select {
+	case <-m.done:
+		return nil, ErrHubStopped
+	default:
+	}
+
+	if len(m.userSubscriptions[userID]) >= m.maxConnectionsPerUser {
+		return nil, ErrTooManySubscriptions
+	}
+
+	if _, exists := m.userSubscriptions[userID]; !exists {
+		m.userSubscriptions[userID] = make(map[*Subscription]bool)
+	}
+	m.userSubscriptions[userID][sub] = true
+
+	logger.Infof("Subscription created: %s (user: %s)", sub.ID, userID)
+	return sub, nil
+}
+
+// Unsubscribe 取消订阅，重复调用是安全的
+func (m *Manager) Unsubscribe(sub *Subscription) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.removeSubscription(sub)
+}
+
+// removeSubscription 移除订阅并关闭其通道，调用方需持有写锁
+func (m *Manager) removeSubscription(sub *Subscription) {
+	userSubs, exists := m.userSubscriptions[sub.UserID]
+	if !exists || !userSubs[sub] {
+		return
+	}
+
+	delete(userSubs, sub)
+	if len(userSubs) == 0 {
+		delete(m.userSubscriptions, sub.UserID)
+	}
+	close(sub.send)
+	logger.Infof("Subscription closed: %s (user: %s)", sub.ID, sub.UserID)
+}
+
+// publishToSubscriptions 推送消息给用户的订阅，返回成功推送的数量，调用方需持有读锁
+func (m *Manager) publishToSubscriptions(message *models.Message) (int, []*Subscription) {
+	pushed := 0
+	var slow []*Subscription
+	for sub := range m.userSubscriptions[message.UserID] {
+		if !sub.wantsChannel(message.ChannelID) {
+			continue
+		}
+		select {
+		case sub.send <- message:
+			pushed++
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	return pushed, slow
+}
+
+// GetUserSubscriptionCount 获取用户的订阅数量
+func (m *Manager) GetUserSubscriptionCount(userID string) int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.userSubscriptions[userID])
+}
@@ -59,6 +59,18 @@ func (wc *WorkspaceCache) Get(userID string) (*Workspace, bool) {
 	return entry.Workspace, true
 }
 
+// Peek 获取缓存条目的副本，不更新访问时间
+func (wc *WorkspaceCache) Peek(userID string) (CacheEntry, bool) {
+	wc.mu.RLock()
+	defer wc.mu.RUnlock()
+
+	entry, exists := wc.entries[userID]
+	if !exists {
+		return CacheEntry{}, false
+	}
+	return *entry, true
+}
+
 // Put 存储工作空间
 func (wc *WorkspaceCache) Put(userID string, ws *Workspace) {
 	wc.mu.Lock()
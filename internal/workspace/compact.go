@@ -0,0 +1,64 @@
+package workspace
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// databaseFiles 工作空间的数据库文件，WAL 文件在检查点之后会被截断
+var databaseFiles = []string{
+	"messages.db", "messages.db-wal",
+	"read_status.db", "read_status.db-wal",
+}
+
+// DatabaseBytes 统计消息和已读状态数据库（包括 WAL）占用的字节数
+func (ws *Workspace) DatabaseBytes() int64 {
+	var total int64
+	for _, name := range databaseFiles {
+		if info, err := os.Stat(filepath.Join(ws.BasePath, name)); err == nil {
+			total += info.Size()
+		}
+	}
+	return total
+}
+
+// Compact 压缩消息和已读状态数据库，返回回收的字节数
+// VACUUM 重建数据库文件，最后把 WAL 写回主库并截断。全文索引按 rowid 关联 messages 表，
+// VACUUM 可能重新分配 rowid，因此压缩后重建索引
+func (ws *Workspace) Compact() (int64, error) {
+	before := ws.DatabaseBytes()
+
+	if err := compactDB(ws.MessagesDB); err != nil {
+		return 0, fmt.Errorf("failed to compact messages database: %w", err)
+	}
+	if ws.SearchEnabled {
+		if err := ws.RebuildSearchIndex(); err != nil {
+			return 0, err
+		}
+		if _, err := ws.MessagesDB.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			return 0, fmt.Errorf("failed to checkpoint messages database: %w", err)
+		}
+	}
+	if err := compactDB(ws.ReadDB); err != nil {
+		return 0, fmt.Errorf("failed to compact read status database: %w", err)
+	}
+
+	reclaimed := before - ws.DatabaseBytes()
+	if reclaimed < 0 {
+		reclaimed = 0
+	}
+	return reclaimed, nil
+}
+
+// compactDB 执行 VACUUM 和 WAL 检查点
+func compactDB(db *sql.DB) error {
+	if _, err := db.Exec("VACUUM"); err != nil {
+		return err
+	}
+	if _, err := db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return err
+	}
+	return nil
+}
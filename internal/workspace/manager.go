@@ -2,10 +2,12 @@ package workspace
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"miemie/internal/config"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,13 +20,24 @@ type Workspace struct {
 	Database   *sql.DB
 	MessagesDB *sql.DB
 	ReadDB     *sql.DB
+	// SearchEnabled 是否可用 FTS5 全文索引
+	SearchEnabled bool
+	readHook   ReadHook
 	mu         sync.RWMutex
 }
 
+// ReadHook 消息被标记为已读后的回调（用于投递回执等跨模块通知）
+type ReadHook func(userID string, messageIDs []string)
+
+// ErrWorkspaceLimit 工作空间数量已达到 user.max_workspaces
+var ErrWorkspaceLimit = errors.New("workspace limit reached")
+
 type Manager struct {
 	basePath string
 	cache     *WorkspaceCache
 	mu        sync.RWMutex
+	maxWorkspaces int // 磁盘上工作空间的数量上限，0 表示不限制
+	readHook  ReadHook
 }
 
 func NewManager(basePath string) *Manager {
@@ -35,10 +48,12 @@ func NewManagerWithConfig(basePath string, cfg *config.Config) *Manager {
 	// 配置缓存参数 - 使用配置文件中的值，如果配置为空则使用默认值
 	var maxSize int
 	var ttl time.Duration
+	var maxWorkspaces int
 
 	if cfg != nil {
 		maxSize = cfg.Cache.Workspace.MaxSize
 		ttl = cfg.Cache.GetTTL()
+		maxWorkspaces = cfg.User.MaxWorkspaces
 	} else {
 		maxSize = 1000                 // 默认最大缓存1000个工作空间
 		ttl = 30 * time.Minute        // 默认30分钟过期时间
@@ -47,6 +62,21 @@ func NewManagerWithConfig(basePath string, cfg *config.Config) *Manager {
 	return &Manager{
 		basePath: basePath,
 		cache:    NewWorkspaceCache(maxSize, ttl),
+		maxWorkspaces: maxWorkspaces,
+	}
+}
+
+// SetReadHook 注册已读回调，之后打开的工作空间都会带上该回调
+func (m *Manager) SetReadHook(hook ReadHook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readHook = hook
+}
+
+// NotifyRead 触发工作空间的已读回调
+func (ws *Workspace) NotifyRead(messageIDs []string) {
+	if ws.readHook != nil && len(messageIDs) > 0 {
+		ws.readHook(ws.UserID, messageIDs)
 	}
 }
 
@@ -81,6 +111,9 @@ func (m *Manager) GetUserWorkspace(userID string) (*Workspace, error) {
 func (m *Manager) createUserWorkspace(userID string) (*Workspace, error) {
 	// 创建用户目录结构
 	userPath := filepath.Join(m.basePath, userID)
+	if err := m.checkWorkspaceLimit(userPath); err != nil {
+		return nil, err
+	}
 	if err := os.MkdirAll(userPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create user directory: %w", err)
 	}
@@ -121,6 +154,7 @@ func (m *Manager) createUserWorkspace(userID string) (*Workspace, error) {
 		Database:   nil, // 保留兼容性
 		MessagesDB: messagesDB,
 		ReadDB:     readDB,
+		readHook:   m.readHook,
 	}
 
 	// 初始化数据库表结构
@@ -133,6 +167,26 @@ func (m *Manager) createUserWorkspace(userID string) (*Workspace, error) {
 	return ws, nil
 }
 
+// checkWorkspaceLimit 新建工作空间前检查数量上限，已存在的工作空间不受影响
+// 调用方持有 m.mu，统计和创建之间不会并发新建其他工作空间
+func (m *Manager) checkWorkspaceLimit(userPath string) error {
+	if m.maxWorkspaces <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(userPath); err == nil {
+		return nil
+	}
+
+	users, err := m.ListAllUsers()
+	if err != nil {
+		return err
+	}
+	if len(users) >= m.maxWorkspaces {
+		return ErrWorkspaceLimit
+	}
+	return nil
+}
+
 func (ws *Workspace) initDatabase() error {
 	// 🔧 启用WAL模式以提高并发性能
 	if err := ws.enableWALMode(); err != nil {
@@ -235,6 +289,51 @@ func (ws *Workspace) initMessagesTable() error {
 		}
 	}
 
+	// 消息序号
+	if err := ws.migrateMessageSeq(); err != nil {
+		return err
+	}
+
+	// 频道内按序号的索引，用于未读数
+	if err := ws.migrateChannelSeqIndex(); err != nil {
+		return err
+	}
+
+	// 消息折叠键
+	if err := ws.migrateCollapseKey(); err != nil {
+		return err
+	}
+
+	// 折叠替换的旧消息ID
+	if err := ws.migrateMessageReplaces(); err != nil {
+		return err
+	}
+
+	// 消息过期时间
+	if err := ws.migrateExpiresAt(); err != nil {
+		return err
+	}
+
+	// 频道保留策略
+	if err := ws.migrateChannelRetention(); err != nil {
+		return err
+	}
+
+	// 频道静音截止时间
+	if err := ws.migrateChannelMute(); err != nil {
+		return err
+	}
+
+	// 频道标识
+	if err := ws.migrateChannelSlug(); err != nil {
+		return err
+	}
+
+	// 创建全文索引
+	if err := ws.initSearchIndex(); err != nil {
+		return err
+	}
+
 	// 确保默认频道存在
 	return ws.ensureDefaultChannel()
 }
@@ -244,7 +343,7 @@ func (ws *Workspace) initReadStatusTable() error {
 	createReadStatusTable := `
 	CREATE TABLE IF NOT EXISTS read_status (
 		message_id TEXT PRIMARY KEY,
-		read_at DATETIME NOT NULL,
+		read_at DATETIME,
 		read_device TEXT,
 		archived_at DATETIME,
 		starred_at DATETIME,
@@ -258,6 +357,8 @@ func (ws *Workspace) initReadStatusTable() error {
 		date TEXT PRIMARY KEY,
 		total_read INTEGER DEFAULT 0,
 		channel_stats TEXT,
+		total_received INTEGER DEFAULT 0,
+		priority_stats TEXT,
 		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	`
@@ -279,7 +380,22 @@ func (ws *Workspace) initReadStatusTable() error {
 		}
 	}
 
-	return nil
+	// 星标、归档与已读状态相互独立
+	if err := ws.migrateReadStatusState(); err != nil {
+		return err
+	}
+
+	// 已读状态变更时间，用于增量同步
+	if err := ws.migrateReadStatusChanges(); err != nil {
+		return err
+	}
+	if err := ws.migrateReadingPositionChanges(); err != nil {
+		return err
+	}
+	if err := ws.migrateReadStats(); err != nil {
+		return err
+	}
+	return ws.migrateReadStatsItems()
 }
 
 func (ws *Workspace) ensureDefaultChannel() error {
@@ -293,9 +409,9 @@ func (ws *Workspace) ensureDefaultChannel() error {
 	if count == 0 {
 		// 创建默认频道
 		_, err = ws.MessagesDB.Exec(`
-			INSERT INTO channels (id, name, description, created_by)
-			VALUES (?, ?, ?, ?)
-		`, "default", "默认频道", "系统默认消息频道", "system")
+			INSERT INTO channels (id, slug, name, description, created_by)
+			VALUES (?, ?, ?, ?, ?)
+		`, "default", "default", "默认频道", "系统默认消息频道", "system")
 		return err
 	}
 
@@ -344,6 +460,115 @@ func (m *Manager) ListWorkspaces() []string {
 	return m.cache.ListActiveUsers()
 }
 
+// ListAllUsers 列出磁盘上所有已存在工作空间的用户（包括未缓存的）
+func (m *Manager) ListAllUsers() ([]string, error) {
+	entries, err := os.ReadDir(m.basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to read user storage directory: %w", err)
+	}
+
+	users := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		users = append(users, entry.Name())
+	}
+
+	return users, nil
+}
+
+// IsValidUserID 检查用户ID能否安全地作为工作空间目录名
+func IsValidUserID(userID string) bool {
+	if userID == "" || userID == "." || userID == ".." || strings.HasPrefix(userID, ".") {
+		return false
+	}
+	return !strings.ContainsAny(userID, "/\\\x00")
+}
+
+// WorkspaceInfo 工作空间概况，查询时不会打开或创建工作空间
+type WorkspaceInfo struct {
+	UserID     string     `json:"user_id"`
+	Exists     bool       `json:"exists"`
+	Cached     bool       `json:"cached"`
+	CachedAt   *time.Time `json:"cached_at,omitempty"`
+	LastAccess *time.Time `json:"last_access,omitempty"`
+	DiskBytes  int64      `json:"disk_bytes"`
+}
+
+// InspectWorkspace 获取工作空间的缓存状态和磁盘占用
+func (m *Manager) InspectWorkspace(userID string) (*WorkspaceInfo, error) {
+	info := &WorkspaceInfo{UserID: userID}
+
+	if entry, found := m.cache.Peek(userID); found {
+		info.Cached = true
+		info.CachedAt = &entry.CreatedAt
+		info.LastAccess = &entry.LastAccess
+	}
+
+	userPath := filepath.Join(m.basePath, userID)
+	if _, err := os.Stat(userPath); err != nil {
+		if os.IsNotExist(err) {
+			return info, nil
+		}
+		return nil, fmt.Errorf("failed to stat workspace: %w", err)
+	}
+	info.Exists = true
+
+	err := filepath.WalkDir(userPath, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if fileInfo, err := d.Info(); err == nil {
+			info.DiskBytes += fileInfo.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure workspace: %w", err)
+	}
+
+	return info, nil
+}
+
+// WithWorkspace 对磁盘上已存在的工作空间执行 fn，供后台维护任务遍历使用
+// 已缓存的工作空间直接使用；未缓存的临时打开，结束后关闭，不放入缓存
+func (m *Manager) WithWorkspace(userID string, fn func(ws *Workspace) error) error {
+	ws, cached, err := m.openExistingWorkspace(userID)
+	if err != nil {
+		return err
+	}
+	if !cached {
+		defer ws.Close()
+	}
+
+	return fn(ws)
+}
+
+// openExistingWorkspace 在 m.mu 保护下检查缓存并打开已存在的工作空间，与 GetUserWorkspace 的创建互斥
+func (m *Manager) openExistingWorkspace(userID string) (*Workspace, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, found := m.cache.Peek(userID); found {
+		return entry.Workspace, true, nil
+	}
+
+	userPath := filepath.Join(m.basePath, userID)
+	if _, err := os.Stat(userPath); err != nil {
+		return nil, false, fmt.Errorf("failed to stat workspace: %w", err)
+	}
+
+	ws, err := m.createUserWorkspace(userID)
+	if err != nil {
+		return nil, false, err
+	}
+	return ws, false, nil
+}
+
 // RemoveWorkspace 移除工作空间
 func (m *Manager) RemoveWorkspace(userID string) error {
 	m.cache.Remove(userID)
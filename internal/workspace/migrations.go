@@ -0,0 +1,340 @@
+package workspace
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// AddColumnIfMissing 表中不存在该列时添加（column 为 "名称 类型"）
+func AddColumnIfMissing(db *sql.DB, table, column string) error {
+	name := strings.Fields(column)[0]
+
+	var exists bool
+	err := db.QueryRow(`SELECT COUNT(*) > 0 FROM pragma_table_info(?) WHERE name = ?`, table, name).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check %s.%s column: %w", table, name, err)
+	}
+	if exists {
+		return nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, column)); err != nil {
+		return fmt.Errorf("failed to add %s.%s column: %w", table, name, err)
+	}
+	return nil
+}
+
+// migrateMessageSeq 为消息添加工作空间内单调递增的序号
+// 序号由 message_seq 计数器分配，删除消息后也不会复用
+func (ws *Workspace) migrateMessageSeq() error {
+	if err := AddColumnIfMissing(ws.MessagesDB, "messages", "seq INTEGER"); err != nil {
+		return err
+	}
+
+	createCounter := `
+	CREATE TABLE IF NOT EXISTS message_seq (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		value INTEGER NOT NULL
+	);
+	INSERT OR IGNORE INTO message_seq (id, value) VALUES (1, 0);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_seq ON messages(seq);
+	`
+	if _, err := ws.MessagesDB.Exec(createCounter); err != nil {
+		return fmt.Errorf("failed to create message sequence: %w", err)
+	}
+
+	// 旧消息按到达顺序回填序号
+	var missing int
+	if err := ws.MessagesDB.QueryRow("SELECT COUNT(*) FROM messages WHERE seq IS NULL").Scan(&missing); err != nil {
+		return fmt.Errorf("failed to check message sequence: %w", err)
+	}
+	if missing == 0 {
+		return nil
+	}
+
+	tx, err := ws.MessagesDB.Begin()
+	if err != nil {
+		return err
+	}
+
+	var next int64
+	if err := tx.QueryRow("SELECT MAX(value, (SELECT COALESCE(MAX(seq), 0) FROM messages)) FROM message_seq WHERE id = 1").Scan(&next); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to read message sequence: %w", err)
+	}
+
+	rows, err := tx.Query("SELECT rowid FROM messages WHERE seq IS NULL ORDER BY created_at, rowid")
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to backfill message sequence: %w", err)
+	}
+	var rowids []int64
+	for rows.Next() {
+		var rowid int64
+		if err := rows.Scan(&rowid); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return fmt.Errorf("failed to backfill message sequence: %w", err)
+		}
+		rowids = append(rowids, rowid)
+	}
+	rows.Close()
+
+	for _, rowid := range rowids {
+		next++
+		if _, err := tx.Exec("UPDATE messages SET seq = ? WHERE rowid = ?", next, rowid); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to backfill message sequence: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE message_seq SET value = ? WHERE id = 1", next); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update message sequence: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// migrateCollapseKey 添加消息折叠键，同一频道中折叠键相同的消息只保留最新一条
+func (ws *Workspace) migrateCollapseKey() error {
+	if err := AddColumnIfMissing(ws.MessagesDB, "messages", "collapse_key TEXT"); err != nil {
+		return err
+	}
+
+	createIndex := `
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_messages_collapse ON messages(channel_id, collapse_key)
+	WHERE collapse_key IS NOT NULL;
+	`
+	if _, err := ws.MessagesDB.Exec(createIndex); err != nil {
+		return fmt.Errorf("failed to create collapse key index: %w", err)
+	}
+	return nil
+}
+
+// migrateMessageReplaces 记录折叠替换的旧消息ID，重试写入时据此迁移旧消息的阅读状态
+func (ws *Workspace) migrateMessageReplaces() error {
+	return AddColumnIfMissing(ws.MessagesDB, "messages", "replaces TEXT")
+}
+
+// migrateExpiresAt 添加消息过期时间，过期消息由后台清理
+func (ws *Workspace) migrateExpiresAt() error {
+	if err := AddColumnIfMissing(ws.MessagesDB, "messages", "expires_at DATETIME"); err != nil {
+		return err
+	}
+
+	createIndex := `
+	CREATE INDEX IF NOT EXISTS idx_messages_expires ON messages(expires_at)
+	WHERE expires_at IS NOT NULL;
+	`
+	if _, err := ws.MessagesDB.Exec(createIndex); err != nil {
+		return fmt.Errorf("failed to create expiry index: %w", err)
+	}
+	return nil
+}
+
+// migrateChannelRetention 为频道添加消息保留策略
+func (ws *Workspace) migrateChannelRetention() error {
+	columns := []string{
+		"retention_max_age_days INTEGER",
+		"retention_max_messages INTEGER",
+		"retention_keep_starred BOOLEAN",
+	}
+	for _, column := range columns {
+		if err := AddColumnIfMissing(ws.MessagesDB, "channels", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateReadStatusState 允许 read_at 为空，星标或归档的消息可以保持未读
+// SQLite 不能直接去掉 NOT NULL 约束，需要重建表
+func (ws *Workspace) migrateReadStatusState() error {
+	var notNull bool
+	err := ws.ReadDB.QueryRow(`SELECT "notnull" FROM pragma_table_info('read_status') WHERE name = 'read_at'`).Scan(&notNull)
+	if err != nil {
+		return fmt.Errorf("failed to check read_status.read_at column: %w", err)
+	}
+
+	if notNull {
+		rebuild := `
+		CREATE TABLE read_status_new (
+			message_id TEXT PRIMARY KEY,
+			read_at DATETIME,
+			read_device TEXT,
+			archived_at DATETIME,
+			starred_at DATETIME,
+			metadata TEXT
+		);
+		INSERT INTO read_status_new (message_id, read_at, read_device, archived_at, starred_at, metadata)
+		SELECT message_id, read_at, read_device, archived_at, starred_at, metadata FROM read_status;
+		DROP TABLE read_status;
+		ALTER TABLE read_status_new RENAME TO read_status;
+		`
+		tx, err := ws.ReadDB.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(rebuild); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate read_status table: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to migrate read_status table: %w", err)
+		}
+	}
+
+	createIndexes := `
+	CREATE INDEX IF NOT EXISTS idx_read_status_starred ON read_status(starred_at) WHERE starred_at IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_read_status_archived ON read_status(archived_at) WHERE archived_at IS NOT NULL;
+	`
+	if _, err := ws.ReadDB.Exec(createIndexes); err != nil {
+		return fmt.Errorf("failed to create read status indexes: %w", err)
+	}
+	return nil
+}
+
+// migrateReadStatusChanges 记录已读、未读、星标和归档状态的变更时间，增量同步按变更时间拉取
+// 旧记录的变更时间取已读时间，与按已读时间生成的同步位置保持一致
+func (ws *Workspace) migrateReadStatusChanges() error {
+	if err := AddColumnIfMissing(ws.ReadDB, "read_status", "changed_at DATETIME"); err != nil {
+		return err
+	}
+
+	migrate := `
+	UPDATE read_status SET changed_at = COALESCE(read_at, starred_at, archived_at) WHERE changed_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_read_status_changed ON read_status(changed_at, message_id);
+	`
+	if _, err := ws.ReadDB.Exec(migrate); err != nil {
+		return fmt.Errorf("failed to migrate read status changes: %w", err)
+	}
+	return nil
+}
+
+// migrateReadingPositionChanges 记录阅读位置的变更时间，增量同步按变更时间拉取
+func (ws *Workspace) migrateReadingPositionChanges() error {
+	if err := AddColumnIfMissing(ws.ReadDB, "reading_position", "updated_at DATETIME"); err != nil {
+		return err
+	}
+
+	migrate := `
+	UPDATE reading_position SET updated_at = last_read_at WHERE updated_at IS NULL;
+	CREATE INDEX IF NOT EXISTS idx_reading_position_updated ON reading_position(updated_at, channel_id);
+	`
+	if _, err := ws.ReadDB.Exec(migrate); err != nil {
+		return fmt.Errorf("failed to migrate reading position changes: %w", err)
+	}
+	return nil
+}
+
+// migrateChannelSeqIndex 按频道和序号建立索引，未读数只需要扫描阅读位置之后的消息
+func (ws *Workspace) migrateChannelSeqIndex() error {
+	if _, err := ws.MessagesDB.Exec("CREATE INDEX IF NOT EXISTS idx_messages_channel_seq ON messages(channel_id, seq)"); err != nil {
+		return fmt.Errorf("failed to create channel sequence index: %w", err)
+	}
+	return nil
+}
+
+// migrateReadStats 阅读统计增加收到的消息数和按优先级的统计
+func (ws *Workspace) migrateReadStats() error {
+	columns := []string{
+		"total_received INTEGER DEFAULT 0",
+		"priority_stats TEXT",
+	}
+	for _, column := range columns {
+		if err := AddColumnIfMissing(ws.ReadDB, "read_stats", column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateReadStatsItems 按频道和优先级的统计改为每项一行，累加时不需要读出整个 JSON 再写回
+// 旧版本 channel_stats/priority_stats 中的 JSON 迁移到 read_stats_items 后清空
+func (ws *Workspace) migrateReadStatsItems() error {
+	migrate := `
+	CREATE TABLE IF NOT EXISTS read_stats_items (
+		date TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		key TEXT NOT NULL,
+		received_count INTEGER NOT NULL DEFAULT 0,
+		read_count INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (date, kind, key)
+	);
+	INSERT INTO read_stats_items (date, kind, key, received_count, read_count)
+	SELECT s.date, 'channel', j.key, COALESCE(json_extract(j.value, '$.received'), 0), COALESCE(json_extract(j.value, '$.read'), 0)
+	FROM read_stats s, json_each(s.channel_stats) j
+	WHERE json_valid(s.channel_stats)
+	ON CONFLICT(date, kind, key) DO UPDATE SET
+		received_count = received_count + excluded.received_count,
+		read_count = read_count + excluded.read_count;
+	INSERT INTO read_stats_items (date, kind, key, received_count, read_count)
+	SELECT s.date, 'priority', j.key, COALESCE(json_extract(j.value, '$.received'), 0), COALESCE(json_extract(j.value, '$.read'), 0)
+	FROM read_stats s, json_each(s.priority_stats) j
+	WHERE json_valid(s.priority_stats)
+	ON CONFLICT(date, kind, key) DO UPDATE SET
+		received_count = received_count + excluded.received_count,
+		read_count = read_count + excluded.read_count;
+	UPDATE read_stats SET channel_stats = NULL, priority_stats = NULL
+	WHERE channel_stats IS NOT NULL OR priority_stats IS NOT NULL;
+	`
+	tx, err := ws.ReadDB.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(migrate); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to migrate read stats items: %w", err)
+	}
+	return tx.Commit()
+}
+
+// migrateChannelMute 频道静音可以设置截止时间
+func (ws *Workspace) migrateChannelMute() error {
+	return AddColumnIfMissing(ws.MessagesDB, "user_channels", "muted_until DATETIME")
+}
+
+// migrateChannelSlug 为频道添加工作空间内唯一的标识，默认频道的标识为 default
+func (ws *Workspace) migrateChannelSlug() error {
+	if err := AddColumnIfMissing(ws.MessagesDB, "channels", "slug TEXT"); err != nil {
+		return err
+	}
+	if _, err := ws.MessagesDB.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_channels_slug ON channels(slug) WHERE slug IS NOT NULL"); err != nil {
+		return fmt.Errorf("failed to create channel slug index: %w", err)
+	}
+	if _, err := ws.MessagesDB.Exec("UPDATE channels SET slug = id WHERE id = 'default' AND slug IS NULL"); err != nil {
+		return fmt.Errorf("failed to set default channel slug: %w", err)
+	}
+	return nil
+}
+
+// migrateSearchUpdateTrigger 旧版本的 messages_fts_au 在任意列更新时都会重建索引行，
+// CREATE TRIGGER IF NOT EXISTS 不会替换已有触发器，需要删除后按当前定义重建
+func (ws *Workspace) migrateSearchUpdateTrigger() error {
+	var definition string
+	err := ws.MessagesDB.QueryRow(
+		"SELECT sql FROM sqlite_master WHERE type = 'trigger' AND name = 'messages_fts_au'",
+	).Scan(&definition)
+	if err != nil {
+		return fmt.Errorf("failed to check search update trigger: %w", err)
+	}
+	if strings.Contains(definition, "UPDATE OF") {
+		return nil
+	}
+
+	tx, err := ws.MessagesDB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if _, err := tx.Exec("DROP TRIGGER IF EXISTS messages_fts_au"); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to drop search update trigger: %w", err)
+	}
+	if _, err := tx.Exec("CREATE TRIGGER messages_fts_au" + searchUpdateTrigger); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create search update trigger: %w", err)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,93 @@
+package workspace
+
+import (
+	"fmt"
+	"miemie/internal/logger"
+)
+
+// searchUpdateTrigger messages_fts_au 触发器的定义（不含 CREATE TRIGGER 和名称）
+// 只在索引列变化时更新索引，避免写入序号、过期时间等列时重复索引
+const searchUpdateTrigger = ` AFTER UPDATE OF title, content, sender ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, title, content, sender)
+		VALUES ('delete', old.rowid, old.title, old.content, old.sender);
+		INSERT INTO messages_fts(rowid, title, content, sender)
+		VALUES (new.rowid, new.title, new.content, new.sender);
+	END;
+`
+
+// initSearchIndex 创建消息全文索引（FTS5 外部内容表）
+// 索引通过触发器与 messages 表保持同步；首次创建时回填已有消息。
+// 未启用 sqlite_fts5 编译标签时 FTS5 不可用，搜索会退化为 LIKE 匹配。
+func (ws *Workspace) initSearchIndex() error {
+	// 以插入触发器是否存在判断索引是否与 messages 同步
+	var synced int
+	err := ws.MessagesDB.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'messages_fts_ai'",
+	).Scan(&synced)
+	if err != nil {
+		return fmt.Errorf("failed to check search index: %w", err)
+	}
+
+	// trigram 分词对中文等无空格文本也能做子串匹配
+	createIndex := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		title, content, sender,
+		content='messages', content_rowid='rowid',
+		tokenize='trigram'
+	);
+	`
+	if _, err := ws.MessagesDB.Exec(createIndex); err != nil {
+		logger.Warnf("Full-text search unavailable for workspace %s, falling back to LIKE: %v", ws.UserID, err)
+		ws.SearchEnabled = false
+		// 索引由支持 FTS5 的版本创建过时，触发器会导致写入失败，需要先移除
+		return ws.dropSearchTriggers()
+	}
+
+	createTriggers := `
+	CREATE TRIGGER IF NOT EXISTS messages_fts_ai AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, title, content, sender)
+		VALUES (new.rowid, new.title, new.content, new.sender);
+	END;
+	CREATE TRIGGER IF NOT EXISTS messages_fts_ad AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, title, content, sender)
+		VALUES ('delete', old.rowid, old.title, old.content, old.sender);
+	END;
+	` + "CREATE TRIGGER IF NOT EXISTS messages_fts_au" + searchUpdateTrigger
+	if _, err := ws.MessagesDB.Exec(createTriggers); err != nil {
+		return fmt.Errorf("failed to create search index triggers: %w", err)
+	}
+
+	// 已有工作空间中的更新触发器按当前定义重建
+	if err := ws.migrateSearchUpdateTrigger(); err != nil {
+		return err
+	}
+
+	// 旧工作空间首次建立索引（或触发器曾被移除）时回填
+	if synced == 0 {
+		if err := ws.RebuildSearchIndex(); err != nil {
+			return err
+		}
+	}
+
+	ws.SearchEnabled = true
+	return nil
+}
+
+// RebuildSearchIndex 根据 messages 表重建全文索引
+// rowid 在 VACUUM 后可能变化，执行 VACUUM 后需要重建
+func (ws *Workspace) RebuildSearchIndex() error {
+	if _, err := ws.MessagesDB.Exec("INSERT INTO messages_fts(messages_fts) VALUES('rebuild')"); err != nil {
+		return fmt.Errorf("failed to rebuild search index: %w", err)
+	}
+	return nil
+}
+
+// dropSearchTriggers 移除索引同步触发器
+func (ws *Workspace) dropSearchTriggers() error {
+	for _, trigger := range []string{"messages_fts_ai", "messages_fts_ad", "messages_fts_au"} {
+		if _, err := ws.MessagesDB.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+			return fmt.Errorf("failed to drop search trigger %s: %w", trigger, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package workspace
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SyncCheckpoint 设备的增量同步检查点，保存在工作空间的 .sync 目录
+type SyncCheckpoint struct {
+	DeviceID string    `json:"device_id"`
+	Token    string    `json:"token"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// checkpointPath 返回设备检查点文件路径
+func (ws *Workspace) checkpointPath(deviceID string) (string, error) {
+	if !IsValidUserID(deviceID) {
+		return "", fmt.Errorf("invalid device id: %q", deviceID)
+	}
+	return filepath.Join(ws.BasePath, ".sync", deviceID+".json"), nil
+}
+
+// LoadSyncCheckpoint 读取设备的同步检查点，不存在时返回 nil
+func (ws *Workspace) LoadSyncCheckpoint(deviceID string) (*SyncCheckpoint, error) {
+	path, err := ws.checkpointPath(deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read sync checkpoint: %w", err)
+	}
+
+	checkpoint := &SyncCheckpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to parse sync checkpoint: %w", err)
+	}
+	return checkpoint, nil
+}
+
+// SaveSyncCheckpoint 保存设备的同步检查点（先写临时文件再重命名）
+func (ws *Workspace) SaveSyncCheckpoint(deviceID, token string) error {
+	path, err := ws.checkpointPath(deviceID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(&SyncCheckpoint{
+		DeviceID: deviceID,
+		Token:    token,
+		SyncedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create sync directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write sync checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save sync checkpoint: %w", err)
+	}
+	return nil
+}
@@ -1,12 +1,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"miemie/internal/api"
+	"miemie/internal/auth"
 	"miemie/internal/config"
 	"miemie/internal/logger"
+	"miemie/internal/middleware"
+	"miemie/internal/ratelimit"
 	"miemie/internal/websocket"
+	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -30,11 +39,14 @@ func main() {
 
 	logger.Info("User storage directory created successfully")
 
-	// 初始化WebSocket管理器
-	wsManager := websocket.NewManager()
+	// 初始化并启动WebSocket管理器
+	wsManager := websocket.NewManagerWithConfig(cfg)
+	wsManager.Start()
 
 	// 创建Gin路由
-	r := gin.Default()
+	// 与 gin.Default 相同，但访问日志隐去查询参数中的凭证
+	r := gin.New()
+	r.Use(middleware.AccessLogger(), gin.Recovery())
 
 	// 启用CORS
 	if cfg.API.CORS.Enabled {
@@ -59,7 +71,7 @@ func main() {
 			if len(cfg.API.CORS.AllowedMethods) > 0 {
 				methods = strings.Join(cfg.API.CORS.AllowedMethods, ", ")
 			} else {
-				methods = "GET, POST, PUT, DELETE, OPTIONS"
+				methods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
 			}
 			c.Header("Access-Control-Allow-Methods", methods)
 
@@ -70,6 +82,7 @@ func main() {
 				headers = "Content-Type, Authorization"
 			}
 			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Expose-Headers", "X-User-ID, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Retry-After, Idempotent-Replayed")
 
 			if c.Request.Method == "OPTIONS" {
 				c.AbortWithStatus(204)
@@ -80,13 +93,7 @@ func main() {
 		})
 	}
 
-	// 设置路由
-	api.SetupSimpleRoutes(r, cfg, wsManager)
-
-	// WebSocket路由
-	r.GET("/ws", wsManager.HandleWebSocket)
-
-	// 健康检查
+	// 健康检查，注册在认证中间件之前，无需密钥
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"status": "ok",
@@ -94,9 +101,47 @@ func main() {
 		})
 	})
 
+	// 设置路由
+	handler := api.SetupSimpleRoutes(r, cfg, wsManager)
+
+	// WebSocket路由
+	r.GET("/ws", middleware.RequireScope(auth.ScopeRead), handler.RateLimit(ratelimit.ClassRead), wsManager.HandleWebSocket)
+
 	// 启动服务器
-	logger.Infof("Starting server on port %s", cfg.Server.Port)
-	if err := r.Run(":" + cfg.Server.Port); err != nil {
-		logger.Fatalf("Failed to start server: %v", err)
+	srv := &http.Server{
+		Addr:    ":" + cfg.Server.Port,
+		Handler: r,
+	}
+
+	// SSE 和长轮询请求在订阅关闭后才会返回，Shutdown 开始时先停止 Hub
+	srv.RegisterOnShutdown(wsManager.Stop)
+
+	go func() {
+		logger.Infof("Starting server on port %s", cfg.Server.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// 等待退出信号
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	logger.Info("Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Warnf("Server shutdown error: %v", err)
 	}
-}
\ No newline at end of file
+
+	// WebSocket 连接已被接管，不受 Shutdown 管理，需要单独断开
+	wsManager.Stop()
+
+	if err := handler.Close(); err != nil {
+		logger.Warnf("Failed to close API handler: %v", err)
+	}
+
+	logger.Info("Server stopped")
+}
@@ -7,7 +7,7 @@ echo "正在启动消息接收系统..."
 # 检查可执行文件是否存在
 if [ ! -f "miemie" ]; then
     echo "错误：找不到可执行文件 'miemie'"
-    echo "请先运行 'go build -o miemie main.go' 编译项目"
+    echo "请先运行 './build.sh' 编译项目"
     exit 1
 fi
 
@@ -2,6 +2,7 @@
 
 # 快速压力测试脚本 - 测试修复后的逻辑
 # 测试5用户，每人20条数据
+# 需要开发模式(api.auth.allow_user_id_header: true)并关闭限流(api.rate_limit.enabled: false)
 
 set -e
 
@@ -252,7 +253,7 @@ main() {
     echo
     echo "获取系统统计信息..."
     echo "投递系统统计:"
-    curl -s "$API_BASE/api/v3/delivery/stats" | jq '.data' || echo "获取投递统计失败"
+    curl -s "$API_BASE/api/admin/v1/delivery/stats" | jq '.data' || echo "获取投递统计失败"
 
     echo
     echo "============================================"
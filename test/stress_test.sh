@@ -2,6 +2,7 @@
 
 # 消息系统压力测试脚本
 # 测试30用户，每人100条数据
+# 需要开发模式(api.auth.allow_user_id_header: true)并关闭限流(api.rate_limit.enabled: false)
 
 set -e
 
@@ -171,11 +172,11 @@ get_system_stats() {
 
     # 获取投递系统统计
     echo "投递系统统计:"
-    curl -s "$API_BASE/api/v3/delivery/stats" | jq '.data' || echo "获取投递统计失败"
+    curl -s "$API_BASE/api/admin/v1/delivery/stats" | jq '.data' || echo "获取投递统计失败"
 
     echo
     echo "缓存系统统计:"
-    curl -s "$API_BASE/api/v3/workspace/cache/stats" | jq '.data' || echo "获取缓存统计失败"
+    curl -s "$API_BASE/api/admin/v1/workspaces/cache" | jq '.data' || echo "获取缓存统计失败"
 
     echo
     echo "数据库文件统计:"